@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -9,7 +11,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
 
 	"github.com/cespare/goclj/format"
 	"github.com/cespare/goclj/parse"
@@ -31,9 +37,40 @@ type config struct {
 	extensions           map[string]struct{}
 	indentOverrides      map[string]format.IndentStyle
 	threadFirstOverrides map[string]format.ThreadFirstStyle
+	defnLike             map[string]bool
+	bodyIndentPrefixes   []string
+	indentArityBodies    bool
+	importStyle          format.ImportStyle
+	ignore               *ignoreList
 	transforms           map[format.Transform]bool
+	noDefaultTransforms  bool
 	list                 bool
 	write                bool
+	backup               bool
+	lint                 bool
+	commas               bool
+	check                bool
+	staged               bool
+	json                 bool
+	// patch, if non-nil, receives a unified diff of all the changes
+	// (instead of printing or writing them).
+	patch io.Writer
+	// changed records whether the formatting of any processed file
+	// differed from cljfmt's.
+	changed bool
+	// written lists the files rewritten by -w.
+	written []string
+	// listed collects the results for -json. Files that could not be
+	// formatted are included with an error rather than stopping cljfmt.
+	listed []listEntry
+	failed bool
+}
+
+// A listEntry is the -json output for a single file.
+type listEntry struct {
+	Path    string `json:"path"`
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
 }
 
 func main() {
@@ -42,53 +79,190 @@ func main() {
 	configFile := pathFlag{
 		p: defaultConfigPath(),
 	}
+	var (
+		patchPath      string
+		stdinName      string
+		diff           bool
+		listTransforms bool
+	)
 	conf := config{
-		extensions: map[string]struct{}{
-			".clj":  {},
-			".cljs": {},
-			".cljc": {},
-			".edn":  {},
-		},
+		extensions: defaultExtensions(),
 		transforms: make(map[format.Transform]bool),
 	}
 	flag.Var(&configFile, "c", "path to config file")
+	flag.BoolVar(&conf.check, "check", false,
+		"exit with status 1 if any file's formatting differs from cljfmt's")
+	flag.BoolVar(&diff, "d", false,
+		"print a unified diff of the changes instead of formatting")
 	flag.BoolVar(&conf.list, "l", false,
 		"print files whose formatting differs from cljfmt's")
+	flag.BoolVar(&conf.json, "json", false,
+		"with -l, print a JSON array describing every processed file")
 	flag.BoolVar(&conf.write, "w", false,
 		"write result to (source) file instead of stdout")
+	flag.BoolVar(&conf.backup, "backup", false,
+		"with -w, save each changed file to <file>.orig before writing it")
+	flag.BoolVar(&conf.lint, "lint", false,
+		"print warnings about likely problems instead of formatting")
+	flag.BoolVar(&conf.commas, "preserve-commas", false,
+		"keep commas (which are otherwise removed as whitespace)")
+	flag.StringVar(&patchPath, "patch", "",
+		"write a unified diff of all changes to this file instead of formatting")
+	flag.BoolVar(&conf.staged, "staged", false,
+		"process the Clojure files staged in git instead of the given paths")
+	flag.StringVar(&stdinName, "stdin-name", "",
+		"name (path) to use for standard input in output and error messages")
 	flag.Var(transformFlag{conf.transforms, true}, "enable-transform",
 		"turn on the named transform")
 	flag.Var(transformFlag{conf.transforms, false}, "disable-transform",
 		"turn off the named transform")
+	flag.BoolVar(&conf.noDefaultTransforms, "no-default-transforms", false,
+		"turn off all the default transforms (only -enable-transform ones apply)")
+	flag.BoolVar(&listTransforms, "list-transforms", false,
+		"print the available transforms and exit")
 	flag.Usage = usage
 	flag.Parse()
 
+	if listTransforms {
+		if err := printTransforms(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	conf.parseDotConfigFile(configFile)
+	// Deferred first so that it runs after any other cleanup.
+	defer conf.exitIfChanged()
 
-	if flag.NArg() == 0 {
+	if conf.backup && !conf.write {
+		log.Fatal("cannot use -backup without -w")
+	}
+	if conf.json {
+		if !conf.list {
+			log.Fatal("cannot use -json without -l")
+		}
+		defer func() {
+			if err := conf.writeJSON(os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if diff {
+		if conf.write {
+			log.Fatal("cannot use -w with -d")
+		}
+		if patchPath != "" {
+			log.Fatal("cannot use -patch with -d")
+		}
+		conf.patch = os.Stdout
+	}
+
+	if conf.staged && flag.NArg() > 0 {
+		log.Fatal("cannot use -staged with path arguments")
+	}
+	if flag.NArg() == 0 && !conf.staged {
+		if conf.json {
+			log.Fatal("cannot use -json with standard input")
+		}
 		if conf.write {
 			log.Fatal("cannot use -w with standard input")
 		}
+		if patchPath != "" {
+			log.Fatal("cannot use -patch with standard input")
+		}
 		conf.list = false
-		if err := conf.processFile("<stdin>", os.Stdin); err != nil {
+		if stdinName == "" {
+			stdinName = "<stdin>"
+		}
+		if err := conf.processFile(stdinName, os.Stdin); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
-	for _, path := range flag.Args() {
+	if stdinName != "" {
+		log.Fatal("cannot use -stdin-name with file arguments or -staged")
+	}
+	process := func() error {
+		if conf.staged {
+			return conf.processStaged()
+		}
+		return conf.processPaths(flag.Args())
+	}
+	var err error
+	if patchPath != "" {
+		if conf.write {
+			log.Fatal("cannot use -w with -patch")
+		}
+		err = conf.writePatch(patchPath, process)
+	} else {
+		err = process()
+	}
+	if err != nil {
+		// Exit through the deferred calls above.
+		log.Print(err)
+		conf.failed = true
+	}
+}
+
+// processPaths formats the files and directories named by paths. It stops
+// at the first error.
+func (c *config) processPaths(paths []string) error {
+	for _, path := range paths {
 		stat, err := os.Stat(path)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		if stat.IsDir() {
-			conf.walkDir(path)
+			if err := c.walkDir(path); err != nil {
+				return err
+			}
 			continue
 		}
-		if err := conf.processFile(path, nil); err != nil {
-			log.Fatal(err)
+		if err := c.processFile(path, nil); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// writePatch calls process with c set up to write a unified diff of the
+// changes to the file patchPath. The patch is flushed and closed even if
+// process fails, so that it holds the diffs of the files before the failure.
+func (c *config) writePatch(patchPath string, process func() error) error {
+	f, err := os.Create(patchPath)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	c.patch = bw
+	err = process()
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// defaultExtensions returns the set of file extensions that walkDir
+// formats unless the config file sets :extensions.
+func defaultExtensions() map[string]struct{} {
+	return map[string]struct{}{
+		".clj":  {},
+		".cljs": {},
+		".cljc": {},
+		".edn":  {},
+	}
+}
+
+// exitIfChanged exits with status 1 if c.check is set and some file's
+// formatting differed.
+func (c *config) exitIfChanged() {
+	if c.failed || (c.check && c.changed) {
+		os.Exit(1)
+	}
 }
 
 func defaultConfigPath() string {
@@ -106,28 +280,111 @@ type transformFlag struct {
 	b bool
 }
 
+// transformNames maps the names used by -enable-transform,
+// -disable-transform, and the config file's :transforms to Transforms.
+var transformNames = map[string]format.Transform{
+	"sort-import-require":                format.TransformSortImportRequire,
+	"enforce-ns-style":                   format.TransformEnforceNSStyle,
+	"remove-trailing-newlines":           format.TransformRemoveTrailingNewlines,
+	"fix-defn-arglist-newline":           format.TransformFixDefnArglistNewline,
+	"fix-defmethod-dispatch-val-newline": format.TransformFixDefmethodDispatchValNewline,
+	"remove-extra-blank-lines":           format.TransformRemoveExtraBlankLines,
+	"fix-if-newline-consistency":         format.TransformFixIfNewlineConsistency,
+	"use-to-require":                     format.TransformUseToRequire,
+	"remove-unused-requires":             format.TransformRemoveUnusedRequires,
+	"wrap-long-lines":                    format.TransformWrapLongLines,
+	"break-thread-chains":                format.TransformBreakThreadChains,
+	"align-map-values":                   format.TransformAlignMapValues,
+	"remove-redundant-do":                format.TransformRemoveRedundantDo,
+	"fn-literal-to-fn":                   format.TransformFnLiteralToFn,
+	"expand-thread-first":                format.TransformExpandThreadFirst,
+	"introduce-thread-first":             format.TransformIntroduceThreadFirst,
+	"sort-set-literals":                  format.TransformSortSetLiterals,
+	"blank-line-between-top-level":       format.TransformBlankLineBetweenTopLevel,
+	"remove-binding-blank-lines":         format.TransformRemoveBindingBlankLines,
+	"if-to-when":                         format.TransformIfToWhen,
+	"consolidate-requires":               format.TransformConsolidateRequires,
+	"normalize-comment-spacing":          format.TransformNormalizeCommentSpacing,
+	"align-trailing-comments":            format.TransformAlignTrailingComments,
+	"remove-comment-forms":               format.TransformRemoveCommentForms,
+	"split-requires":                     format.TransformSplitRequires,
+	"compact-single-require":             format.TransformCompactSingleRequire,
+	"normalize-char-literals":            format.TransformNormalizeCharLiterals,
+	"use-to-require-strict":              format.TransformUseToRequireStrict,
+	"expand-require-prefix-lists":        format.TransformExpandRequirePrefixLists,
+	"normalize-imports":                  format.TransformNormalizeImports,
+	"preserve-require-groups":            format.TransformPreserveRequireGroups,
+	"sort-ignoring-case":                 format.TransformSortIgnoringCase,
+	"merge-metadata":                     format.TransformMergeMetadata,
+	"normalize-destructuring":            format.TransformNormalizeDestructuring,
+	"align-are-tables":                   format.TransformAlignAreTables,
+}
+
+// transformDescriptions is the one-line summary of each transform
+// printed by -list-transforms.
+var transformDescriptions = map[format.Transform]string{
+	format.TransformSortImportRequire:              "sort :import, :require, and :require-macros declarations",
+	format.TransformEnforceNSStyle:                 "apply common ns style rules",
+	format.TransformRemoveTrailingNewlines:         "move closing brackets up onto the last line",
+	format.TransformFixDefnArglistNewline:          "move defn arg vectors onto the first line",
+	format.TransformFixDefmethodDispatchValNewline: "move defmethod dispatch values onto the first line",
+	format.TransformRemoveExtraBlankLines:          "collapse runs of blank lines into one",
+	format.TransformFixIfNewlineConsistency:        "put both arms of an if on their own lines, or neither",
+	format.TransformUseToRequire:                   "rewrite :use as :require where possible",
+	format.TransformRemoveUnusedRequires:           "remove requires that appear to be unused",
+	format.TransformWrapLongLines:                  "break lines that are too long",
+	format.TransformBreakThreadChains:              "put each step of a long thread-first chain on its own line",
+	format.TransformAlignMapValues:                 "align the values of one-pair-per-line maps",
+	format.TransformRemoveRedundantDo:              "remove a do that is the entire body of an implicit do",
+	format.TransformFnLiteralToFn:                  "rewrite #() literals as fn forms",
+	format.TransformExpandThreadFirst:              "rewrite thread-first forms as nested calls",
+	format.TransformIntroduceThreadFirst:           "rewrite nested calls as thread-first forms",
+	format.TransformSortSetLiterals:                "sort the elements of simple set literals",
+	format.TransformBlankLineBetweenTopLevel:       "put a blank line between top-level forms",
+	format.TransformRemoveBindingBlankLines:        "remove blank lines inside binding vectors",
+	format.TransformIfToWhen:                       "rewrite one-armed if forms as when",
+	format.TransformConsolidateRequires:            "merge multiple :require clauses into one",
+	format.TransformNormalizeCommentSpacing:        "put one space between a comment's semicolons and its text",
+	format.TransformAlignTrailingComments:          "align the end-of-line comments of consecutive lines",
+	format.TransformRemoveCommentForms:             "remove (comment ...) forms",
+	format.TransformSplitRequires:                  "put each require on its own line without sorting",
+	format.TransformCompactSingleRequire:           "keep a :require with a single entry on one line",
+	format.TransformNormalizeCharLiterals:          "write character literals in a canonical way",
+	format.TransformUseToRequireStrict:             "like use-to-require, but leave bare uses alone",
+	format.TransformExpandRequirePrefixLists:       "rewrite prefix lists in :require as separate requires",
+	format.TransformNormalizeImports:               "write all :import clauses in the configured :import-style",
+	format.TransformPreserveRequireGroups:          "sort blank-line-separated groups of requires separately",
+	format.TransformSortIgnoringCase:               "sort requires and imports by dotted segment, ignoring case",
+	format.TransformMergeMetadata:                  "merge adjacent keyword and map metadata into one map",
+	format.TransformNormalizeDestructuring:         "put each entry of a multi-line destructuring map on its own line",
+	format.TransformAlignAreTables:                 "lay out the tables of clojure.test/are forms in aligned rows",
+}
+
+// printTransforms prints the name, default status, and description of
+// every transform, in the order the transforms are defined.
+func printTransforms(w io.Writer) error {
+	names := make([]string, 0, len(transformNames))
+	for name := range transformNames {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return transformNames[names[i]] < transformNames[names[j]]
+	})
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		t := transformNames[name]
+		status := "off"
+		if format.DefaultTransforms[t] {
+			status = "on"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, status, transformDescriptions[t])
+	}
+	return tw.Flush()
+}
+
 func (tf transformFlag) Set(v string) error {
-	var t format.Transform
-	switch v {
-	case "sort-import-require":
-		t = format.TransformSortImportRequire
-	case "enforce-ns-style":
-		t = format.TransformEnforceNSStyle
-	case "remove-trailing-newlines":
-		t = format.TransformRemoveTrailingNewlines
-	case "fix-defn-arglist-newline":
-		t = format.TransformFixDefnArglistNewline
-	case "fix-defmethod-dispatch-val-newline":
-		t = format.TransformFixDefmethodDispatchValNewline
-	case "remove-extra-blank-lines":
-		t = format.TransformRemoveExtraBlankLines
-	case "fix-if-newline-consistency":
-		t = format.TransformFixIfNewlineConsistency
-	case "use-to-require":
-		t = format.TransformUseToRequire
-	case "remove-unused-requires":
-		t = format.TransformRemoveUnusedRequires
-	default:
+	t, ok := transformNames[v]
+	if !ok {
 		return fmt.Errorf("unrecognized transform %q", v)
 	}
 	tf.m[t] = tf.b
@@ -170,70 +427,341 @@ func (c *config) parseDotConfigFile(pf pathFlag) {
 	}
 }
 
-var (
-	buf1 bytes.Buffer
-	buf2 bytes.Buffer
-)
+// writeFileAtomic is like ioutil.WriteFile, but it writes to a temporary
+// file in the same directory and renames it over name, so that name is never
+// left partially written.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) (err error) {
+	f, err := tempFileFor(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// tempFileFor creates a temporary file in the same directory as name.
+func tempFileFor(name string) (*os.File, error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	return ioutil.TempFile(dir, "."+base+".cljfmt-")
+}
+
+// A tempWriter receives the formatted code for a file being rewritten in
+// place. While the output matches the original code, it is only compared;
+// at the first difference, tempWriter creates a temporary file next to the
+// original and writes the output there, so that a large file's formatted
+// code is never held in memory.
+type tempWriter struct {
+	name string
+	src  []byte
+	// n is the length of the prefix of src that matches the output
+	// so far.
+	n int
+	f *os.File
+}
+
+func (w *tempWriter) Write(b []byte) (int, error) {
+	if w.f != nil {
+		return w.f.Write(b)
+	}
+	rest := w.src[w.n:]
+	i := 0
+	for i < len(b) && i < len(rest) && b[i] == rest[i] {
+		i++
+	}
+	if i == len(b) {
+		w.n += i
+		return len(b), nil
+	}
+	if err := w.create(w.src[:w.n+i]); err != nil {
+		return 0, err
+	}
+	if _, err := w.f.Write(b[i:]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// create creates the temporary file and writes prefix to it.
+func (w *tempWriter) create(prefix []byte) error {
+	f, err := tempFileFor(w.name)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	_, err = f.Write(prefix)
+	return err
+}
+
+// finish completes the output. If it differs from the original, finish
+// returns the name of the temporary file holding it (with permissions
+// perm); otherwise, it returns "".
+func (w *tempWriter) finish(perm os.FileMode) (string, error) {
+	if w.f == nil && w.n < len(w.src) {
+		// The output is a prefix of the original.
+		if err := w.create(w.src[:w.n]); err != nil {
+			return "", err
+		}
+	}
+	if w.f == nil {
+		return "", nil
+	}
+	if err := w.f.Chmod(perm); err != nil {
+		return "", err
+	}
+	if err := w.f.Close(); err != nil {
+		return "", err
+	}
+	return w.f.Name(), nil
+}
+
+// abort removes the temporary file, if any.
+func (w *tempWriter) abort() {
+	if w.f != nil {
+		w.f.Close()
+		os.Remove(w.f.Name())
+	}
+}
+
+// backupSuffix is appended to the name of a file to get the name of its
+// backup (for -backup).
+const backupSuffix = ".orig"
+
+// A fileResult is the outcome of formatting (or linting) a single file.
+type fileResult struct {
+	filename string
+	perm     os.FileMode
+	before   []byte
+	after    []byte
+	changed  bool
+	// tmp, if set, is a temporary file holding the formatted code
+	// (instead of after). It is used for -w (see formatToTemp).
+	tmp      string
+	warnings []format.Diagnostic
+}
+
+// removeTemp removes res.tmp, if there is one.
+func (res *fileResult) removeTemp() {
+	if res.tmp != "" {
+		os.Remove(res.tmp)
+	}
+}
 
-// processFile formats the given file.
-// If in == nil, the input is the file of the given name.
 func (c *config) processFile(filename string, in io.Reader) error {
-	var perm os.FileMode = 0644
-	if in == nil {
+	res, err := c.formatFile(filename, in)
+	if err != nil {
+		return c.fileError(filename, err)
+	}
+	return c.report(res)
+}
+
+// fileError handles an error formatting filename. With -json, the error is
+// recorded in the output (and cljfmt will exit with status 1 at the end);
+// otherwise it is returned.
+func (c *config) fileError(filename string, err error) error {
+	if !c.json {
+		return err
+	}
+	c.listed = append(c.listed, listEntry{Path: filename, Error: err.Error()})
+	c.failed = true
+	return nil
+}
+
+// writeJSON writes the results collected for -json to w.
+func (c *config) writeJSON(w io.Writer) error {
+	listed := c.listed
+	if listed == nil {
+		listed = []listEntry{}
+	}
+	b, err := json.MarshalIndent(listed, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
+
+// lineEnding returns the line ending used by most of the lines in b: either
+// "\r\n" or "\n".
+func lineEnding(b []byte) string {
+	crlf := bytes.Count(b, []byte("\r\n"))
+	if crlf > bytes.Count(b, []byte("\n"))-crlf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// formatFile reads and formats a file. If in is nil, the file is read from
+// disk. formatFile does not modify c, so it may be called concurrently.
+func (c *config) formatFile(filename string, in io.Reader) (*fileResult, error) {
+	res := &fileResult{filename: filename, perm: 0644}
+	fromDisk := in == nil
+	if fromDisk {
 		f, err := os.Open(filename)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer f.Close()
 		stat, err := f.Stat()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		perm = stat.Mode().Perm()
+		res.perm = stat.Mode().Perm()
 		in = f
 	}
 
-	buf1.Reset()
-	buf2.Reset()
+	before, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	res.before = before
+	opts := parse.IncludeNonSemantic
+	if c.commas {
+		opts |= parse.IncludeCommas
+	}
+	if c.lint {
+		t, err := parse.Reader(bytes.NewReader(before), filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		res.warnings = format.Lint(t)
+		return res, nil
+	}
 
-	if _, err := io.Copy(&buf1, in); err != nil {
+	configure := func(p *format.Printer) {
+		p.IndentChar = ' '
+		p.LineEnding = lineEnding(before)
+		p.IndentOverrides = c.indentOverrides
+		p.ThreadFirstStyleOverrides = c.threadFirstOverrides
+		p.DefnLikeOverrides = c.defnLike
+		p.BodyIndentPrefixes = c.bodyIndentPrefixes
+		p.IndentArityBodies = c.indentArityBodies
+		p.ImportStyle = c.importStyle
+		// PrintTree fills in the default transforms, so give it a copy.
+		p.Transforms = make(map[format.Transform]bool, len(c.transforms))
+		if c.noDefaultTransforms {
+			for k := range format.DefaultTransforms {
+				p.Transforms[k] = false
+			}
+		}
+		for k, v := range c.transforms {
+			p.Transforms[k] = v
+		}
+	}
+	if c.write && c.patch == nil && fromDisk {
+		if err := formatToTemp(res, opts, configure); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	res.after, err = format.Source(filename, before, opts, configure)
+	if err != nil {
+		return nil, err
+	}
+	res.changed = !bytes.Equal(before, res.after)
+	return res, nil
+}
+
+// formatToTemp formats res.before for -w. Rather than keeping the
+// formatted code in memory, it writes it to the temporary file res.tmp,
+// which report renames over the original. If the code is already
+// formatted, no file is created.
+func formatToTemp(res *fileResult, opts parse.ParseOpts, configure func(p *format.Printer)) error {
+	w := &tempWriter{name: res.filename, src: res.before}
+	if err := format.Fprint(w, res.filename, res.before, opts, configure); err != nil {
+		w.abort()
 		return err
 	}
-	r := bytes.NewReader(buf1.Bytes())
-	t, err := parse.Reader(r, filename, parse.IncludeNonSemantic)
+	tmp, err := w.finish(res.perm)
 	if err != nil {
+		w.abort()
 		return err
 	}
+	res.tmp = tmp
+	res.changed = tmp != ""
+	return nil
+}
 
-	p := format.NewPrinter(&buf2)
-	p.IndentChar = ' '
-	p.IndentOverrides = c.indentOverrides
-	p.ThreadFirstStyleOverrides = c.threadFirstOverrides
-	p.Transforms = c.transforms
-	if err := p.PrintTree(t); err != nil {
-		return err
+// report prints, writes, or records the result of formatting a file,
+// according to the configuration.
+func (c *config) report(res *fileResult) error {
+	if c.lint {
+		for _, w := range res.warnings {
+			fmt.Println(w)
+		}
+		return nil
+	}
+	changed := res.changed
+	if c.json {
+		c.listed = append(c.listed, listEntry{Path: res.filename, Changed: changed})
 	}
-	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
-		if c.list {
-			fmt.Println(filename)
+	if changed {
+		c.changed = true
+		if c.list && !c.json {
+			fmt.Println(res.filename)
 		}
 		if c.write {
-			if err := ioutil.WriteFile(filename, buf2.Bytes(), perm); err != nil {
+			if c.backup {
+				err := ioutil.WriteFile(res.filename+backupSuffix, res.before, res.perm)
+				if err != nil {
+					res.removeTemp()
+					return err
+				}
+			}
+			if res.tmp != "" {
+				if err := os.Rename(res.tmp, res.filename); err != nil {
+					res.removeTemp()
+					return err
+				}
+			} else if err := writeFileAtomic(res.filename, res.after, res.perm); err != nil {
+				return err
+			}
+			c.written = append(c.written, res.filename)
+		}
+		if c.patch != nil {
+			if err := writeUnifiedDiff(c.patch, res.filename, res.before, res.after); err != nil {
 				return err
 			}
 		}
 	}
-	if !c.list && !c.write {
-		io.Copy(os.Stdout, &buf2)
+	if !c.list && !c.write && !c.check && c.patch == nil {
+		os.Stdout.Write(res.after)
 	}
 	return nil
 }
 
-func (c *config) walkDir(path string) {
+// walkDir formats all the Clojure files under path. The files are formatted
+// concurrently, but the results are reported in the order in which they
+// were found. It stops at the first error.
+func (c *config) walkDir(path string) error {
+	var files []string
 	walk := func(path string, f os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if c.ignore.match(path) {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if f.IsDir() {
 			return nil
 		}
@@ -242,11 +770,75 @@ func (c *config) walkDir(path string) {
 			return nil
 		}
 		if _, ok := c.extensions[filepath.Ext(name)]; ok {
-			return c.processFile(path, nil)
+			files = append(files, path)
 		}
-		return nil // not a Clojure file
+		return nil
 	}
 	if err := filepath.Walk(path, walk); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	return c.processFiles(files)
+}
+
+type fileOrErr struct {
+	res *fileResult
+	err error
+}
+
+// processFiles formats files using up to GOMAXPROCS goroutines and reports
+// the results in order. It stops at the first error.
+func (c *config) processFiles(files []string) error {
+	// Each file gets a channel for its result. The semaphore bounds the
+	// number of files which have been started but not yet reported.
+	results := make([]chan fileOrErr, len(files))
+	for i := range results {
+		results[i] = make(chan fileOrErr, 1)
+	}
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, name := range files {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			wg.Add(1)
+			go func(name string, ch chan<- fileOrErr) {
+				defer wg.Done()
+				res, err := c.formatFile(name, nil)
+				ch <- fileOrErr{res, err}
+			}(name, results[i])
+		}
+	}()
+	for i := range files {
+		r := <-results[i]
+		if r.err == nil {
+			r.err = c.report(r.res)
+		} else {
+			r.err = c.fileError(files[i], r.err)
+		}
+		if r.err != nil {
+			// Clean up the temporary files (for -w) of any files
+			// that were formatted but will not be reported.
+			close(done)
+			wg.Wait()
+			for _, ch := range results[i+1:] {
+				select {
+				case r := <-ch:
+					if r.res != nil {
+						r.res.removeTemp()
+					}
+				default:
+				}
+			}
+			return r.err
+		}
+		<-sem
 	}
+	close(done)
+	return nil
 }
@@ -0,0 +1,1065 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+func TestPatch(t *testing.T) {
+	var patch bytes.Buffer
+	c := &config{
+		transforms: make(map[format.Transform]bool),
+		patch:      &patch,
+	}
+	for _, f := range []struct {
+		name     string
+		contents string
+	}{
+		{
+			"src/a.clj",
+			"(ns a)\n\n\n\n(defn f\n  [x] (inc x))\n",
+		},
+		{
+			"src/unchanged.clj",
+			"(ns unchanged)\n",
+		},
+		{
+			"src/b/c.clj",
+			"(ns b.c)\n\n(def x 1)\n(def y 2)\n(def z 3)\n(def w 4)\n\n(foo bar\n     )\n" +
+				"(def a 1)\n(def b 2)\n(def c 3)\n(def d 4)\n(def e 5)\n(def f 6)\n(def g 7)\n" +
+				"(let [x 1]\n    x)",
+		},
+	} {
+		if err := c.processFile(f.name, strings.NewReader(f.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const want = `--- a/src/a.clj
++++ b/src/a.clj
+@@ -1,6 +1,4 @@
+ (ns a)
+ 
+-
+-
+-(defn f
+-  [x] (inc x))
++(defn f [x]
++  (inc x))
+--- a/src/b/c.clj
++++ b/src/b/c.clj
+@@ -5,8 +5,7 @@
+ (def z 3)
+ (def w 4)
+ 
+-(foo bar
+-     )
++(foo bar)
+ (def a 1)
+ (def b 2)
+ (def c 3)
+@@ -15,4 +14,4 @@
+ (def f 6)
+ (def g 7)
+ (let [x 1]
+-    x)
+\ No newline at end of file
++  x)
+`
+	if got := patch.String(); got != want {
+		t.Errorf("got patch:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPatchError(t *testing.T) {
+	// The diffs of the files before a failure are written out.
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good := filepath.Join(dir, "a.clj")
+	if err := ioutil.WriteFile(good, []byte("(foo\n )\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+	}
+	patchPath := filepath.Join(dir, "out.diff")
+	paths := []string{good, filepath.Join(dir, "missing.clj")}
+	err = c.writePatch(patchPath, func() error { return c.processPaths(paths) })
+	if !os.IsNotExist(err) {
+		t.Fatalf("got err=%v; want a not-exist error", err)
+	}
+	b, err := ioutil.ReadFile(patchPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "+(foo)\n"; !strings.HasSuffix(string(b), want) {
+		t.Errorf("got patch:\n%s\nwant it to end with %q", b, want)
+	}
+}
+
+func TestDiffDir(t *testing.T) {
+	var diff bytes.Buffer
+	c := &config{
+		extensions: map[string]struct{}{".clj": {}, ".cljc": {}},
+		transforms: make(map[format.Transform]bool),
+		patch:      &diff,
+	}
+	before := readDir(t, "testdata/diff")
+	if err := c.walkDir("testdata/diff"); err != nil {
+		t.Fatal(err)
+	}
+	const want = `--- a/testdata/diff/a.clj
++++ b/testdata/diff/a.clj
+@@ -1,6 +1,4 @@
+ (ns a)
+ 
+-
+-
+-(defn f
+-  [x] (inc x))
++(defn f [x]
++  (inc x))
+--- a/testdata/diff/sub/c.cljc
++++ b/testdata/diff/sub/c.cljc
+@@ -1,4 +1,3 @@
+ (ns sub.c)
+ 
+-(foo bar
+-     )
++(foo bar)
+`
+	if got := diff.String(); got != want {
+		t.Errorf("got diff:\n%s\nwant:\n%s", got, want)
+	}
+	if after := readDir(t, "testdata/diff"); !reflect.DeepEqual(after, before) {
+		t.Error("files were modified")
+	}
+}
+
+func readDir(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		files[path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCheck(t *testing.T) {
+	c := &config{
+		extensions: map[string]struct{}{".clj": {}, ".cljc": {}},
+		transforms: make(map[format.Transform]bool),
+		check:      true,
+	}
+	if err := c.processFile("testdata/diff/unchanged.clj", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.changed {
+		t.Error("formatted file reported as changed")
+	}
+	if err := c.walkDir("testdata/diff"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.changed {
+		t.Error("unformatted files not reported as changed")
+	}
+}
+
+func TestPreserveLineEndings(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{
+			"(ns a)\n\n(defn f\n  [x] x)\n",
+			"(ns a)\n\n(defn f [x]\n  x)\n",
+		},
+		{
+			"(ns a)\r\n\r\n(defn f\r\n  [x] x)\r\n",
+			"(ns a)\r\n\r\n(defn f [x]\r\n  x)\r\n",
+		},
+		{
+			"(ns a)\r\n\r\n(def s\r\n  \"x\r\n  y\")\n",
+			"(ns a)\r\n\r\n(def s\r\n  \"x\r\n  y\")\r\n",
+		},
+	} {
+		res, err := c.formatFile("test.clj", strings.NewReader(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(res.after); got != tc.want {
+			t.Errorf("formatting %q: got %q; want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestStdinName(t *testing.T) {
+	var diff bytes.Buffer
+	c := &config{
+		transforms: make(map[format.Transform]bool),
+		patch:      &diff,
+	}
+	in := strings.NewReader("(ns app.core)\n\n(foo bar\n     )\n")
+	if err := c.processFile("src/app/core.cljs", in); err != nil {
+		t.Fatal(err)
+	}
+	const want = `--- a/src/app/core.cljs
++++ b/src/app/core.cljs
+@@ -1,4 +1,3 @@
+ (ns app.core)
+ 
+-(foo bar
+-     )
++(foo bar)
+`
+	if got := diff.String(); got != want {
+		t.Errorf("got diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	_, err := c.formatFile("src/app/core.cljs", strings.NewReader("(foo"))
+	if err == nil || !strings.Contains(err.Error(), "src/app/core.cljs:1:5") {
+		t.Errorf("got error %v; want one mentioning src/app/core.cljs", err)
+	}
+}
+
+func TestNoDefaultTransforms(t *testing.T) {
+	const in = `(ns app.core
+  (:require [b.core :as b] [a.core :as a]))
+
+
+
+(defn f [x]
+      (if x
+        1 2))
+`
+	const want = `(ns app.core
+  (:require [b.core :as b] [a.core :as a]))
+
+
+
+(defn f [x]
+  (if x
+    1 2))
+`
+	c := &config{
+		transforms:          make(map[format.Transform]bool),
+		noDefaultTransforms: true,
+	}
+	res, err := c.formatFile("core.clj", strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.after); got != want {
+		t.Errorf("with -no-default-transforms, got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Explicitly enabled transforms still apply.
+	c.transforms[format.TransformSortImportRequire] = true
+	res, err = c.formatFile("core.clj", strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res.after), "[a.core :as a]\n            [b.core :as b]") {
+		t.Errorf("sort-import-require not applied:\n%s", res.after)
+	}
+}
+
+func TestWalkDirEDN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"deps.edn":  "{:paths [\"src\"]\n :deps {}\n }\n",
+		"notes.txt": "(not clojure\n )\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var diff bytes.Buffer
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+		patch:      &diff,
+	}
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	got := diff.String()
+	if !strings.Contains(got, "deps.edn") {
+		t.Errorf("deps.edn was not formatted; diff:\n%s", got)
+	}
+	if strings.Contains(got, "notes.txt") {
+		t.Errorf("notes.txt was formatted; diff:\n%s", got)
+	}
+}
+
+func TestConfigTransforms(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	// Set by -disable-transform.
+	c.transforms[format.TransformRemoveUnusedRequires] = false
+	conf := `{:transforms {:use-to-require true
+	                       :remove-unused-requires true
+	                       :sort-import-require false}}`
+	if err := c.parseDotConfig(strings.NewReader(conf), "test"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[format.Transform]bool{
+		format.TransformUseToRequire:         true,
+		format.TransformRemoveUnusedRequires: false,
+		format.TransformSortImportRequire:    false,
+	}
+	if !reflect.DeepEqual(c.transforms, want) {
+		t.Errorf("got transforms %v; want %v", c.transforms, want)
+	}
+
+	for _, conf := range []string{
+		`{:transforms {:no-such-transform true}}`,
+		`{:transforms {:use-to-require "yes"}}`,
+		`{:transforms [:use-to-require true]}`,
+	} {
+		c := &config{transforms: make(map[format.Transform]bool)}
+		if err := c.parseDotConfig(strings.NewReader(conf), "test"); err == nil {
+			t.Errorf("parsing %s: got nil error", conf)
+		}
+	}
+}
+
+func TestConfigImportStyle(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	if err := c.parseDotConfig(strings.NewReader(`{:import-style :individual}`), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if c.importStyle != format.ImportIndividual {
+		t.Errorf("got import style %v; want individual", c.importStyle)
+	}
+	if err := c.parseDotConfig(strings.NewReader(`{:import-style :bogus}`), "test"); err == nil {
+		t.Error("parsing :import-style :bogus: got nil error")
+	}
+}
+
+func TestConfigBodyIndentPrefixes(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	conf := `{:body-indent-prefixes ["fixture-" "validate-"]}`
+	if err := c.parseDotConfig(strings.NewReader(conf), "test"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fixture-", "validate-"}
+	if !reflect.DeepEqual(c.bodyIndentPrefixes, want) {
+		t.Errorf("got body indent prefixes %q; want %q", c.bodyIndentPrefixes, want)
+	}
+	for _, conf := range []string{
+		`{:body-indent-prefixes ["fixture-" :validate-]}`,
+		`{:body-indent-prefixes [""]}`,
+	} {
+		if err := c.parseDotConfig(strings.NewReader(conf), "test"); err == nil {
+			t.Errorf("parsing %s: got nil error", conf)
+		}
+	}
+}
+
+func TestConfigIndentArityBodies(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	if err := c.parseDotConfig(strings.NewReader(`{:indent-arity-bodies true}`), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.indentArityBodies {
+		t.Error("got indentArityBodies = false; want true")
+	}
+	if err := c.parseDotConfig(strings.NewReader(`{:indent-arity-bodies "yes"}`), "test"); err == nil {
+		t.Error(`parsing :indent-arity-bodies "yes": got nil error`)
+	}
+}
+
+func TestConfigExtensions(t *testing.T) {
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+	}
+	conf := `{:extensions ["clj" ".bb"]}`
+	if err := c.parseDotConfig(strings.NewReader(conf), "test"); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.clj", "b.bb", "c.cljs"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("(foo\n )\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var diff bytes.Buffer
+	c.patch = &diff
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	got := diff.String()
+	for _, name := range []string{"a.clj", "b.bb"} {
+		if !strings.Contains(got, name) {
+			t.Errorf("%s was not formatted; diff:\n%s", name, got)
+		}
+	}
+	if strings.Contains(got, "c.cljs") {
+		t.Errorf("c.cljs was formatted; diff:\n%s", got)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+	}
+	conf := `{:ignore ["target/**" "*.gen.clj" "resources/**/generated/*.clj"]}`
+	if err := c.parseDotConfig(strings.NewReader(conf), filepath.Join(dir, ".cljfmt")); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{
+		"src/a.clj",
+		"src/b.gen.clj",
+		"src/target/c.clj",
+		"target/d.clj",
+		"target/classes/e.clj",
+		"resources/x/generated/f.clj",
+		"resources/generated/g.clj",
+		"resources/h.clj",
+	}
+	for _, name := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte("(foo\n )\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var diff bytes.Buffer
+	c.patch = &diff
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	got := diff.String()
+	for _, name := range files {
+		ignored := !strings.Contains(got, name)
+		want := strings.Contains(name, "gen") || strings.HasPrefix(name, "target/")
+		if ignored != want {
+			t.Errorf("%s: got ignored=%t; want %t", name, ignored, want)
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const (
+		unformatted = "(foo\n )\n"
+		formatted   = "(foo)\n"
+	)
+	changed := filepath.Join(dir, "changed.clj")
+	unchanged := filepath.Join(dir, "unchanged.clj")
+	if err := ioutil.WriteFile(changed, []byte(unformatted), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(unchanged, []byte(formatted), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+		write:      true,
+		backup:     true,
+	}
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(changed + backupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != unformatted {
+		t.Errorf("backup contains %q; want %q", b, unformatted)
+	}
+	stat, err := os.Stat(changed + backupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := stat.Mode().Perm(); perm != 0600 {
+		t.Errorf("backup has permissions %v; want %v", perm, os.FileMode(0600))
+	}
+	if b, err := ioutil.ReadFile(changed); err != nil || string(b) != formatted {
+		t.Errorf("after formatting, got (%q, %v); want %q", b, err, formatted)
+	}
+	if _, err := os.Stat(unchanged + backupSuffix); !os.IsNotExist(err) {
+		t.Errorf("backup of unchanged file: got err=%v; want not-exist", err)
+	}
+}
+
+func TestWriteLarge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// About 1MB of unformatted edn.
+	var b strings.Builder
+	b.WriteString("[")
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "{:id %d\n:name \"item-%d\"\n   :tags #{:a :b}}\n", i, i)
+	}
+	b.WriteString("]\n")
+	large := []byte(b.String())
+	want, err := format.Source("large.edn", large, parse.IncludeNonSemantic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"large.edn":     large,
+		"formatted.edn": want,
+		// The formatted code is a prefix of the original.
+		"trailing.clj": []byte("(foo)\n\n\n"),
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+		write:      true,
+	}
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string][]byte{
+		"large.edn":     want,
+		"formatted.edn": want,
+		"trailing.clj":  []byte("(foo)\n"),
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s was not formatted correctly", name)
+		}
+	}
+	sort.Strings(c.written)
+	wantWritten := []string{filepath.Join(dir, "large.edn"), filepath.Join(dir, "trailing.clj")}
+	if !reflect.DeepEqual(c.written, wantWritten) {
+		t.Errorf("got written files %q; want %q", c.written, wantWritten)
+	}
+	// No temporary files are left behind.
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != len(files) {
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		t.Errorf("got files %q after formatting", names)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.clj": "(foo\n )\n",
+		"b.clj": "(foo)\n",
+		"c.clj": "(foo\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+		list:       true,
+		json:       true,
+	}
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if !c.failed {
+		t.Error("parse error not recorded as a failure")
+	}
+	var buf bytes.Buffer
+	if err := c.writeJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode -json output %q: %s", buf.Bytes(), err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d results; want 3:\n%s", len(got), buf.Bytes())
+	}
+	for i, want := range []struct {
+		name    string
+		changed bool
+		err     bool
+	}{
+		{"a.clj", true, false},
+		{"b.clj", false, false},
+		{"c.clj", false, true},
+	} {
+		r := got[i]
+		if path := filepath.Join(dir, want.name); r["path"] != path {
+			t.Errorf("result %d: got path %v; want %q", i, r["path"], path)
+		}
+		if r["changed"] != want.changed {
+			t.Errorf("%s: got changed=%v; want %t", want.name, r["changed"], want.changed)
+		}
+		if _, ok := r["error"]; ok != want.err {
+			t.Errorf("%s: got error %v; want error: %t", want.name, r["error"], want.err)
+		}
+	}
+}
+
+func TestStaged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	const (
+		unformatted = "(foo\n )\n"
+		formatted   = "(foo)\n"
+	)
+	files := map[string]string{
+		"a.clj":        unformatted,
+		"b.clj":        formatted,
+		"notes.txt":    unformatted,
+		"src/c.cljs":   unformatted,
+		"partial.clj":  unformatted,
+		"unstaged.clj": unformatted,
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var calls [][]string
+	defer func(orig func(...string) ([]byte, error)) { runGit = orig }(runGit)
+	runGit = func(args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		if args[0] != "diff" {
+			return nil, nil
+		}
+		if args[1] == "--cached" {
+			return []byte("a.clj\x00b.clj\x00notes.txt\x00partial.clj\x00src/c.cljs\x00"), nil
+		}
+		// partial.clj is partially staged: formatting and adding it
+		// would stage the rest of its changes.
+		return []byte("partial.clj\x00unstaged.clj\x00"), nil
+	}
+
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+		write:      true,
+	}
+	if err := c.processStaged(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.clj":        formatted,
+		"b.clj":        formatted,
+		"notes.txt":    unformatted,
+		"src/c.cljs":   formatted,
+		"partial.clj":  unformatted,
+		"unstaged.clj": unformatted,
+	}
+	for name, contents := range want {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != contents {
+			t.Errorf("%s: got %q; want %q", name, b, contents)
+		}
+	}
+	wantCalls := [][]string{
+		{"diff", "--cached", "--name-only", "--diff-filter=ACM", "--relative", "-z"},
+		{"diff", "--name-only", "--relative", "-z"},
+		{"add", "--", "a.clj", filepath.FromSlash("src/c.cljs")},
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("git calls: got %q; want %q", calls, wantCalls)
+	}
+}
+
+func TestStagedCheck(t *testing.T) {
+	// Without -w, the staged contents are checked, not the working tree.
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	const (
+		unformatted = "(foo\n )\n"
+		formatted   = "(foo)\n"
+	)
+	// a.clj is fixed in the working tree, and b.clj is broken there.
+	working := map[string]string{"a.clj": formatted, "b.clj": unformatted}
+	staged := map[string]string{"a.clj": unformatted, "b.clj": formatted}
+	for name, contents := range working {
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(orig func(...string) ([]byte, error)) { runGit = orig }(runGit)
+	runGit = func(args ...string) ([]byte, error) {
+		switch args[0] {
+		case "diff":
+			return []byte("a.clj\x00b.clj\x00"), nil
+		case "show":
+			return []byte(staged[strings.TrimPrefix(args[1], ":./")]), nil
+		}
+		t.Fatalf("unexpected git call %q", args)
+		return nil, nil
+	}
+
+	var patch bytes.Buffer
+	c := &config{
+		extensions: defaultExtensions(),
+		transforms: make(map[format.Transform]bool),
+		check:      true,
+		patch:      &patch,
+	}
+	if err := c.processStaged(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.changed {
+		t.Error("changed not set")
+	}
+	const want = "--- a/a.clj\n+++ b/a.clj\n@@ -1,2 +1 @@\n-(foo\n- )\n+(foo)\n"
+	if got := patch.String(); got != want {
+		t.Errorf("got patch:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "a.clj")
+	if err := ioutil.WriteFile(name, []byte("(old)\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(name, []byte("(new)\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "(new)\n" {
+		t.Errorf("got contents %q; want %q", b, "(new)\n")
+	}
+	stat, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := stat.Mode().Perm(); perm != 0640 {
+		t.Errorf("got permissions %v; want %v", perm, os.FileMode(0640))
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("got files %q; want only a.clj", names)
+	}
+}
+
+// makeTestDir creates a temporary directory containing n Clojure files,
+// most of which are not formatted.
+func makeTestDir(t testing.TB, n int) string {
+	dir, err := ioutil.TempDir("", "cljfmt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%d", i%7))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "(ns d%d.f%d)\n\n", i%7, i)
+		for j := 0; j < 20; j++ {
+			if (i+j)%3 == 0 {
+				fmt.Fprintf(&b, "(defn f%d\n  [x] (+ x\n %d))\n", j, i)
+			} else {
+				fmt.Fprintf(&b, "(defn f%d [x]\n  (+ x %d))\n\n", j, i)
+			}
+		}
+		name := filepath.Join(sub, fmt.Sprintf("f%d.clj", i))
+		if err := ioutil.WriteFile(name, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWalkDirConcurrent(t *testing.T) {
+	dir := makeTestDir(t, 100)
+	defer os.RemoveAll(dir)
+
+	var want bytes.Buffer
+	serial := &config{
+		extensions: map[string]struct{}{".clj": {}},
+		transforms: make(map[format.Transform]bool),
+		patch:      &want,
+	}
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return err
+		}
+		return serial.processFile(path, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	c := &config{
+		extensions: map[string]struct{}{".clj": {}},
+		transforms: make(map[format.Transform]bool),
+		patch:      &got,
+	}
+	if err := c.walkDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("concurrent walkDir output differs from serial output:\n%s\nwant:\n%s", got.String(), want.String())
+	}
+	if !c.changed {
+		t.Error("changed not set")
+	}
+}
+
+func BenchmarkWalkDir(b *testing.B) {
+	dir := makeTestDir(b, 200)
+	defer os.RemoveAll(dir)
+	c := &config{
+		extensions: map[string]struct{}{".clj": {}},
+		transforms: make(map[format.Transform]bool),
+		patch:      ioutil.Discard,
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.walkDir(dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseIndentStyle(t *testing.T) {
+	for _, tc := range []struct {
+		kw   string
+		want format.IndentStyle
+		ok   bool
+	}{
+		{":list", format.IndentList, true},
+		{":body-1", format.IndentBodyN(1), true},
+		{":body-3", format.IndentBodyN(3), true},
+		{":body-0", 0, false},
+		{":body-x", 0, false},
+		{":bogus", 0, false},
+	} {
+		got, ok := parseIndentStyle(tc.kw)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseIndentStyle(%q): got (%v, %t); want (%v, %t)",
+				tc.kw, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestConfigOverrideNames(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	conf := `{:indent-overrides [["GET" "korma.core/select" "-?>"] :list-body]}`
+	if err := c.parseDotConfig(strings.NewReader(conf), "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		conf string
+		want string
+	}{
+		{
+			`{:indent-overrides ["" :list-body]}`,
+			`invalid name "" in :indent-overrides at test:1:21`,
+		},
+		{
+			`{:indent-overrides [["GET" "POST PUT"] :list-body]}`,
+			`invalid name "POST PUT" in :indent-overrides at test:1:28`,
+		},
+		{
+			`{:thread-first-overrides [":foo" :normal]}`,
+			`invalid name ":foo" in :thread-first-overrides at test:1:27`,
+		},
+	} {
+		c := &config{transforms: make(map[format.Transform]bool)}
+		err := c.parseDotConfig(strings.NewReader(tc.conf), "test")
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("parsing %s: got error %v; want %q", tc.conf, err, tc.want)
+		}
+	}
+}
+
+func TestConfigOverrideSymbolKeys(t *testing.T) {
+	c := &config{transforms: make(map[format.Transform]bool)}
+	conf := `{:indent-overrides {my.ns/foo :list-body
+	                         [GET "POST" :korma.core/select] :list-body
+	                         with-x :body-1}
+	 :thread-first-overrides [-?> :normal]}`
+	if err := c.parseDotConfig(strings.NewReader(conf), "test"); err != nil {
+		t.Fatal(err)
+	}
+	wantIndent := map[string]format.IndentStyle{
+		"my.ns/foo":         format.IndentListBody,
+		"GET":               format.IndentListBody,
+		"POST":              format.IndentListBody,
+		"korma.core/select": format.IndentListBody,
+		"with-x":            format.IndentBodyN(1),
+	}
+	if !reflect.DeepEqual(c.indentOverrides, wantIndent) {
+		t.Errorf("got indent overrides %v; want %v", c.indentOverrides, wantIndent)
+	}
+	wantThreadFirst := map[string]format.ThreadFirstStyle{
+		"-?>": format.ThreadFirstNormal,
+	}
+	if !reflect.DeepEqual(c.threadFirstOverrides, wantThreadFirst) {
+		t.Errorf("got thread-first overrides %v; want %v",
+			c.threadFirstOverrides, wantThreadFirst)
+	}
+}
+
+func TestListTransforms(t *testing.T) {
+	// The Transforms are defined with iota, so their values are their
+	// positions in the const block.
+	f, err := parser.ParseFile(token.NewFileSet(), "../format/transform.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var consts []string
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if strings.HasPrefix(name.Name, "Transform") {
+					consts = append(consts, name.Name)
+				}
+			}
+		}
+	}
+	if len(consts) == 0 {
+		t.Fatal("found no Transform constants")
+	}
+
+	var buf bytes.Buffer
+	if err := printTransforms(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(consts) {
+		t.Errorf("got %d lines of -list-transforms output; want %d", len(lines), len(consts))
+	}
+	for i, name := range consts {
+		tr := format.Transform(i)
+		if transformDescriptions[tr] == "" {
+			t.Errorf("%s has no description", name)
+		}
+		found := false
+		for flagName, tr2 := range transformNames {
+			if tr2 == tr {
+				found = true
+				if i < len(lines) && !strings.HasPrefix(lines[i], flagName+" ") {
+					t.Errorf("line %d of -list-transforms output is %q; want %s", i, lines[i], flagName)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s has no name", name)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 
 	"github.com/cespare/goclj/format"
 	"github.com/cespare/goclj/parse"
@@ -56,10 +58,63 @@ func (c *config) parseDotConfig(r io.Reader, name string) error {
 				if err != nil {
 					return err
 				}
+				if !strings.HasPrefix(ext, ".") {
+					ext = "." + ext
+				}
 				c.extensions[ext] = struct{}{}
 			}
+		case ":ignore":
+			base, err := filepath.Abs(filepath.Dir(name))
+			if err != nil {
+				return err
+			}
+			c.ignore = &ignoreList{base: base}
+			seq, err := sequence(m.Nodes[i+1])
+			if err != nil {
+				return err
+			}
+			for _, n := range seq {
+				pat, err := stringNode(n)
+				if err != nil {
+					return err
+				}
+				c.ignore.patterns = append(c.ignore.patterns, pat)
+			}
+		case ":defn-like":
+			c.defnLike = make(map[string]bool)
+			seq, err := sequence(m.Nodes[i+1])
+			if err != nil {
+				return err
+			}
+			for _, n := range seq {
+				name, err := stringNode(n)
+				if err != nil {
+					return err
+				}
+				c.defnLike[name] = true
+			}
+		case ":body-indent-prefixes":
+			c.bodyIndentPrefixes = nil
+			seq, err := sequence(m.Nodes[i+1])
+			if err != nil {
+				return err
+			}
+			for _, n := range seq {
+				prefix, err := stringNode(n)
+				if err != nil {
+					return err
+				}
+				if prefix == "" {
+					return fmt.Errorf("empty prefix in :body-indent-prefixes")
+				}
+				c.bodyIndentPrefixes = append(c.bodyIndentPrefixes, prefix)
+			}
 		case ":indent-overrides", ":thread-first-overrides":
+			// The pairs may also be written as a map.
 			seq, err := sequence(m.Nodes[i+1])
+			if mn, ok := m.Nodes[i+1].(*parse.MapNode); ok {
+				seq, err = mn.Nodes, nil
+			}
 			if err != nil {
 				return err
 			}
@@ -71,7 +126,7 @@ func (c *config) parseDotConfig(r io.Reader, name string) error {
 			case ":indent-overrides":
 				c.indentOverrides = make(map[string]format.IndentStyle)
 				for k, v := range overrides {
-					style, ok := indentStyles[v]
+					style, ok := parseIndentStyle(v)
 					if !ok {
 						return fmt.Errorf("unknown indent style %q", v)
 					}
@@ -80,13 +135,36 @@ func (c *config) parseDotConfig(r io.Reader, name string) error {
 			case ":thread-first-overrides":
 				c.threadFirstOverrides = make(map[string]format.ThreadFirstStyle)
 				for k, v := range overrides {
-					style, ok := threadFirstStyles[v]
+					style, ok := parseThreadFirstStyle(v)
 					if !ok {
 						return fmt.Errorf("unknown thread-first style %q", v)
 					}
 					c.threadFirstOverrides[k] = style
 				}
 			}
+		case ":import-style":
+			kw, ok := m.Nodes[i+1].(*parse.KeywordNode)
+			if !ok {
+				return unexpectedNodeError{m.Nodes[i+1]}
+			}
+			switch kw.Val {
+			case ":grouped":
+				c.importStyle = format.ImportGrouped
+			case ":individual":
+				c.importStyle = format.ImportIndividual
+			default:
+				return fmt.Errorf("unknown import style %q", kw.Val)
+			}
+		case ":indent-arity-bodies":
+			b, ok := m.Nodes[i+1].(*parse.BoolNode)
+			if !ok {
+				return unexpectedNodeError{m.Nodes[i+1]}
+			}
+			c.indentArityBodies = b.Val
+		case ":transforms":
+			if err := c.parseTransforms(m.Nodes[i+1]); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("unknown configuration key %q", sym.Val)
 		}
@@ -94,6 +172,38 @@ func (c *config) parseDotConfig(r io.Reader, name string) error {
 	return nil
 }
 
+// parseTransforms reads a :transforms map, such as
+// {:use-to-require true :sort-import-require false}. The config file is
+// read after the flags are parsed, so transforms named by
+// -enable-transform or -disable-transform are left alone.
+func (c *config) parseTransforms(node parse.Node) error {
+	m, ok := node.(*parse.MapNode)
+	if !ok {
+		return unexpectedNodeError{node}
+	}
+	if len(m.Nodes)%2 != 0 {
+		return fmt.Errorf("map value at %s has odd number of children", m.Position())
+	}
+	for i := 0; i < len(m.Nodes); i += 2 {
+		kw, ok := m.Nodes[i].(*parse.KeywordNode)
+		if !ok {
+			return unexpectedNodeError{m.Nodes[i]}
+		}
+		t, ok := transformNames[strings.TrimPrefix(kw.Val, ":")]
+		if !ok {
+			return fmt.Errorf("unknown transform %s", kw.Val)
+		}
+		b, ok := m.Nodes[i+1].(*parse.BoolNode)
+		if !ok {
+			return unexpectedNodeError{m.Nodes[i+1]}
+		}
+		if _, ok := c.transforms[t]; !ok {
+			c.transforms[t] = b.Val
+		}
+	}
+	return nil
+}
+
 func parseOverrides(nodes []parse.Node, name string) (map[string]string, error) {
 	if len(nodes)%2 != 0 {
 		return nil, fmt.Errorf("%s value has odd number of children", name)
@@ -102,20 +212,19 @@ func parseOverrides(nodes []parse.Node, name string) (map[string]string, error)
 	for i := 0; i < len(nodes); i += 2 {
 		var names []string
 		seq, err := sequence(nodes[i])
-		if err == nil {
-			for _, n := range seq {
-				s, err := stringNode(n)
-				if err != nil {
-					return nil, err
-				}
-				names = append(names, s)
-			}
-		} else {
-			s, err := stringNode(nodes[i])
+		if err != nil {
+			seq = nodes[i : i+1]
+		}
+		for _, n := range seq {
+			s, err := overrideName(n)
 			if err != nil {
 				return nil, err
 			}
-			names = []string{s}
+			if !isSymbolName(s) {
+				return nil, fmt.Errorf("invalid name %q in %s at %s",
+					s, name, n.Position())
+			}
+			names = append(names, s)
 		}
 		kw, ok := nodes[i+1].(*parse.KeywordNode)
 		if !ok {
@@ -128,6 +237,32 @@ func parseOverrides(nodes []parse.Node, name string) (map[string]string, error)
 	return overrides, nil
 }
 
+// overrideName returns the name given by an override key, which may be
+// written as a string ("foo/bar"), a symbol (foo/bar), or a keyword
+// (:foo/bar).
+func overrideName(node parse.Node) (string, error) {
+	switch node := node.(type) {
+	case *parse.StringNode:
+		return node.Val, nil
+	case *parse.SymbolNode:
+		return node.Val, nil
+	case *parse.KeywordNode:
+		return strings.TrimPrefix(node.Val, ":"), nil
+	}
+	return "", unexpectedNodeError{node}
+}
+
+// isSymbolName reports whether s is a well-formed (possibly
+// namespace-qualified) Clojure symbol.
+func isSymbolName(s string) bool {
+	tree, err := parse.Reader(strings.NewReader(s), "", 0)
+	if err != nil || len(tree.Roots) != 1 {
+		return false
+	}
+	sym, ok := tree.Roots[0].(*parse.SymbolNode)
+	return ok && sym.Val == s
+}
+
 func sequence(node parse.Node) ([]parse.Node, error) {
 	switch node.(type) {
 	case *parse.ListNode, *parse.VectorNode:
@@ -144,21 +279,20 @@ func stringNode(node parse.Node) (string, error) {
 	return sn.Val, nil
 }
 
-var indentStyles = map[string]format.IndentStyle{
-	":normal":    format.IndentNormal,
-	":list":      format.IndentList,
-	":list-body": format.IndentListBody,
-	":let":       format.IndentLet,
-	":letfn":     format.IndentLetfn,
-	":for":       format.IndentFor,
-	":deftype":   format.IndentDeftype,
-	":cond0":     format.IndentCond0,
-	":cond1":     format.IndentCond1,
-	":cond2":     format.IndentCond2,
-	":cond4":     format.IndentCond4,
+// parseIndentStyle looks up the indent style named by the keyword kw,
+// such as :list-body or :body-2.
+func parseIndentStyle(kw string) (format.IndentStyle, bool) {
+	if !strings.HasPrefix(kw, ":") {
+		return 0, false
+	}
+	return format.IndentStyleFromString(kw[1:])
 }
 
-var threadFirstStyles = map[string]format.ThreadFirstStyle{
-	":normal": format.ThreadFirstNormal,
-	":cond->": format.ThreadFirstCondArrow,
+// parseThreadFirstStyle looks up the thread-first style named by the
+// keyword kw, such as :cond->.
+func parseThreadFirstStyle(kw string) (format.ThreadFirstStyle, bool) {
+	if !strings.HasPrefix(kw, ":") {
+		return 0, false
+	}
+	return format.ThreadFirstStyleFromString(kw[1:])
 }
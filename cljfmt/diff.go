@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines surrounding each hunk in a
+// unified diff.
+const diffContext = 3
+
+// writeUnifiedDiff writes a unified diff (in the format understood by patch
+// and git apply) transforming before into after to w. The diff header names
+// the file as a/name and b/name.
+func writeUnifiedDiff(w io.Writer, name string, before, after []byte) error {
+	name = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "/")
+	edits := diffLines(splitLines(before), splitLines(after))
+	hunks := makeHunks(edits)
+	if len(hunks) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "--- a/%s\n+++ b/%s\n", name, name); err != nil {
+		return err
+	}
+	for _, h := range hunks {
+		if _, err := io.WriteString(w, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLines splits b into lines. Each line includes its trailing newline,
+// except possibly the last one.
+func splitLines(b []byte) []string {
+	var lines []string
+	s := string(b)
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// A lineEdit is a single step of an edit script: an unchanged line (' '), a
+// deleted line ('-'), or an inserted line ('+').
+type lineEdit struct {
+	op   byte
+	line string
+}
+
+// diffLines computes a minimal edit script transforming a into b using
+// Myers' algorithm.
+func diffLines(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	// v[offset+k] is the furthest x reached on diagonal k.
+	// trace[d] is a snapshot of v (for diagonals -d-1 through d+1)
+	// before step d; it's used for reconstructing the path.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []lineEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		tv := trace[d]
+		get := func(k int) int { return tv[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, lineEdit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, lineEdit{'+', b[y-1]})
+			} else {
+				edits = append(edits, lineEdit{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// makeHunks groups edits into formatted unified diff hunks.
+func makeHunks(edits []lineEdit) []string {
+	// aLine[i] and bLine[i] are the number of lines of each file
+	// preceding edits[i].
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.op != '+' {
+			aLine[i+1]++
+		}
+		if e.op != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var hunks []string
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		last := i
+		for j := i + 1; j < len(edits) && j <= last+2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				last = j
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, e := range edits[start:end] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		hunks = append(hunks, b.String())
+		i = end
+	}
+	return hunks
+}
+
+// hunkRange formats the range of a hunk which covers n lines after the first
+// skip lines of a file.
+func hunkRange(skip, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", skip)
+	case 1:
+		return fmt.Sprint(skip + 1)
+	}
+	return fmt.Sprintf("%d,%d", skip+1, n)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// An ignoreList is a set of glob patterns naming files that walkDir skips.
+// A pattern containing a slash is matched against the path relative to base
+// (the directory containing the config file); within such a pattern, **
+// matches any number of path elements. A pattern without a slash is matched
+// against the file or directory name alone, at any depth.
+type ignoreList struct {
+	base     string
+	patterns []string
+}
+
+func (il *ignoreList) match(name string) bool {
+	if il == nil {
+		return false
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(il.base, abs)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pat := range il.patterns {
+		if !strings.Contains(pat, "/") {
+			if ok, _ := path.Match(pat, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		pat = strings.TrimPrefix(pat, "/")
+		if matchElems(strings.Split(pat, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchElems(pat, elems []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pat[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], elems[0]); !ok {
+			return false
+		}
+		pat, elems = pat[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
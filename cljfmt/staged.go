@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+)
+
+// runGit runs git with the given arguments and returns its standard output.
+// It is a variable so that tests can stub out git.
+var runGit = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return nil, fmt.Errorf("git %s: %s", args[0], bytes.TrimSpace(ee.Stderr))
+	}
+	return out, err
+}
+
+// stagedFiles returns the Clojure files that are added, copied, or modified
+// in the git index. The names are relative to the current directory, and
+// only files beneath it are included.
+func (c *config) stagedFiles() ([]string, error) {
+	out, err := runGit("diff", "--cached", "--name-only", "--diff-filter=ACM", "--relative", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, file := range gitNames(out) {
+		if _, ok := c.extensions[filepath.Ext(file)]; !ok {
+			continue
+		}
+		if c.ignore.match(file) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// unstagedFiles returns the set of files beneath the current directory
+// whose working-tree contents differ from the index.
+func unstagedFiles() (map[string]struct{}, error) {
+	out, err := runGit("diff", "--name-only", "--relative", "-z")
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]struct{})
+	for _, file := range gitNames(out) {
+		files[file] = struct{}{}
+	}
+	return files, nil
+}
+
+// gitNames splits the NUL-separated output of git diff -z --name-only
+// into file names.
+func gitNames(out []byte) []string {
+	var names []string
+	for _, name := range bytes.Split(out, []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, filepath.FromSlash(string(name)))
+		}
+	}
+	return names
+}
+
+// processStaged formats the staged Clojure files. Without -w, the contents
+// of the files in the index (which are what will be committed) are
+// formatted rather than those in the working tree. With -w, the files that
+// were rewritten are added to the index again. Files which also have
+// unstaged changes are skipped with -w, since adding them would stage those
+// changes as well.
+func (c *config) processStaged() error {
+	files, err := c.stagedFiles()
+	if err != nil {
+		return err
+	}
+	if !c.write {
+		for _, file := range files {
+			// The ./ makes the path relative to the current
+			// directory rather than the top of the repository.
+			staged, err := runGit("show", ":./"+filepath.ToSlash(file))
+			if err != nil {
+				return err
+			}
+			if err := c.processFile(file, bytes.NewReader(staged)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(files) > 0 {
+		unstaged, err := unstagedFiles()
+		if err != nil {
+			return err
+		}
+		kept := files[:0]
+		for _, file := range files {
+			if _, ok := unstaged[file]; ok {
+				log.Printf("skipping %s: it has unstaged changes", file)
+				continue
+			}
+			kept = append(kept, file)
+		}
+		files = kept
+	}
+	if err := c.processFiles(files); err != nil {
+		return err
+	}
+	if len(c.written) == 0 {
+		return nil
+	}
+	_, err = runGit(append([]string{"add", "--"}, c.written...)...)
+	return err
+}
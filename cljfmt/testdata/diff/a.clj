@@ -0,0 +1,6 @@
+(ns a)
+
+
+
+(defn f
+  [x] (inc x))
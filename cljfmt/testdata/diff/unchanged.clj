@@ -0,0 +1,3 @@
+(ns b)
+
+(def x 1)
@@ -0,0 +1,160 @@
+package format
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// alignMapValues implements TransformAlignMapValues (and the alignment of
+// TransformNormalizeDestructuring) by recording the padding needed before
+// each value of m in p.valuePads.
+func (p *Printer) alignMapValues(m *parse.MapNode) {
+	if _, ok := p.destructuring[m]; !ok && !p.Transforms[TransformAlignMapValues] {
+		return
+	}
+	type pair struct {
+		key, val parse.Node
+	}
+	var (
+		pairs []pair
+		key   parse.Node
+		// afterNewline says whether there's been a newline since the
+		// previous pair.
+		afterNewline = false
+	)
+	for _, n := range m.Nodes {
+		switch n.(type) {
+		case *parse.NewlineNode:
+			if key != nil {
+				return // a newline between a key and its value
+			}
+			afterNewline = true
+			continue
+		case *parse.CommentNode:
+			if key != nil {
+				return
+			}
+			continue
+		case *parse.CommaNode:
+			continue
+		case *parse.MetadataNode, *parse.TagNode:
+			return
+		}
+		if key == nil {
+			if len(pairs) > 0 && !afterNewline {
+				return // two pairs on the same line
+			}
+			key = n
+			continue
+		}
+		pairs = append(pairs, pair{key, n})
+		key = nil
+		afterNewline = false
+	}
+	if key != nil || len(pairs) < 2 {
+		return
+	}
+	keyWidths := make([]int, len(pairs))
+	maxWidth := 0
+	for i, pair := range pairs {
+		s, ok := p.printFlat(pair.key)
+		if !ok {
+			return
+		}
+		if _, ok := p.printFlat(pair.val); !ok {
+			return
+		}
+		keyWidths[i] = utf8.RuneCountInString(s)
+		if keyWidths[i] > maxWidth {
+			maxWidth = keyWidths[i]
+		}
+	}
+	for i, pair := range pairs {
+		if pad := maxWidth - keyWidths[i]; pad > 0 {
+			p.valuePads[pair.val] = pad
+		}
+	}
+}
+
+// A trailingComment is a comment that follows other code on its line.
+type trailingComment struct {
+	seq    int // identifies the sequence containing the comment
+	offset int // where the comment begins in the output
+}
+
+// alignTrailingComments implements TransformAlignTrailingComments. It takes
+// the printed output b and the trailing comments written to it (in order)
+// and pads the comments so that those on consecutive lines within the same
+// sequence begin in the same column.
+func alignTrailingComments(b []byte, comments []trailingComment) []byte {
+	type located struct {
+		offset, line, col int
+	}
+	var (
+		groups [][]located
+		// current maps a sequence to the index in groups of its
+		// latest group.
+		current   = make(map[int]int)
+		line      = 0
+		lineStart = 0
+		scanned   = 0
+	)
+	for _, c := range comments {
+		for {
+			i := bytes.IndexByte(b[scanned:c.offset], '\n')
+			if i < 0 {
+				break
+			}
+			line++
+			scanned += i + 1
+			lineStart = scanned
+		}
+		scanned = c.offset
+		loc := located{c.offset, line, utf8.RuneCount(b[lineStart:c.offset])}
+		if gi, ok := current[c.seq]; ok {
+			g := groups[gi]
+			if g[len(g)-1].line == line-1 {
+				groups[gi] = append(g, loc)
+				continue
+			}
+		}
+		current[c.seq] = len(groups)
+		groups = append(groups, []located{loc})
+	}
+
+	pads := make(map[int]int) // offset -> padding
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		maxCol := 0
+		for _, loc := range g {
+			if loc.col > maxCol {
+				maxCol = loc.col
+			}
+		}
+		for _, loc := range g {
+			if pad := maxCol - loc.col; pad > 0 {
+				pads[loc.offset] = pad
+			}
+		}
+	}
+	if len(pads) == 0 {
+		return b
+	}
+	var buf bytes.Buffer
+	prev := 0
+	for _, c := range comments {
+		pad, ok := pads[c.offset]
+		if !ok {
+			continue
+		}
+		buf.Write(b[prev:c.offset])
+		buf.Write(bytes.Repeat([]byte{' '}, pad))
+		prev = c.offset
+	}
+	buf.Write(b[prev:])
+	return buf.Bytes()
+}
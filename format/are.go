@@ -0,0 +1,112 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// areArity returns the number of names in the binding vector of the
+// are-like form n, or 0 if it has no binding vector.
+func areArity(n parse.Node) int {
+	nodes := semanticNodes(n.Children())
+	if len(nodes) < 2 {
+		return 0
+	}
+	v, ok := nodes[1].(*parse.VectorNode)
+	if !ok {
+		return 0
+	}
+	return len(semanticNodes(v.Nodes))
+}
+
+// layoutAreTable implements TransformAlignAreTables. If the table of
+// values in the are-like form l spans several lines, layoutAreTable puts each
+// row (as many values as there are names in the binding vector) on its own
+// line and records the padding needed to align the columns in p.valuePads.
+// Tables with comments, discarded forms, or an incomplete last row are left
+// alone.
+func (p *Printer) layoutAreTable(l *parse.ListNode) {
+	// Find the expression which follows the binding vector.
+	var (
+		bindings *parse.VectorNode
+		start    = -1
+		seen     int
+	)
+	for i, node := range l.Nodes {
+		if !goclj.Semantic(node) {
+			continue
+		}
+		seen++
+		switch seen {
+		case 2:
+			v, ok := node.(*parse.VectorNode)
+			if !ok {
+				return
+			}
+			bindings = v
+		case 3:
+			start = i + 1
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+	arity := len(semanticNodes(bindings.Nodes))
+	if arity == 0 {
+		return
+	}
+	var (
+		cells     []parse.Node
+		multiline bool
+	)
+	for _, node := range l.Nodes[start:] {
+		switch node.(type) {
+		case *parse.NewlineNode:
+			multiline = true
+		case *parse.CommentNode, *parse.CommaNode, *parse.ReaderDiscardNode,
+			*parse.MetadataNode, *parse.TagNode:
+			return
+		default:
+			cells = append(cells, node)
+		}
+	}
+	if !multiline || len(cells)%arity != 0 {
+		return
+	}
+
+	nodes := append([]parse.Node(nil), l.Nodes[:start]...)
+	for i, cell := range cells {
+		if i%arity == 0 {
+			nodes = append(nodes, newline)
+		}
+		nodes = append(nodes, cell)
+	}
+	l.SetChildren(nodes)
+	p.forgetFlat(l)
+
+	// Align the columns, provided each cell fits on a line.
+	widths := make([]int, len(cells))
+	maxWidths := make([]int, arity)
+	for i, cell := range cells {
+		s, ok := p.printFlat(cell)
+		if !ok {
+			return
+		}
+		widths[i] = len(s)
+		if col := i % arity; widths[i] > maxWidths[col] {
+			maxWidths[col] = widths[i]
+		}
+	}
+	for i, cell := range cells {
+		col := i % arity
+		if col == 0 {
+			continue
+		}
+		if pad := maxWidths[col-1] - widths[i-1]; pad > 0 {
+			p.valuePads[cell] = pad
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// removeCommentFormsRec removes the (comment ...) forms within n. If
+// bindings is true, n is the binding vector of a let-like form.
+func (p *Printer) removeCommentFormsRec(n parse.Node, bindings bool) {
+	if isQuoted(n) {
+		return
+	}
+	var bindingVector parse.Node
+	switch n.(type) {
+	case *parse.ListNode, *parse.FnLiteralNode:
+		// Leave a (comment ...) in function position alone.
+		nodes := n.Children()
+		if len(nodes) > 0 {
+			n.SetChildren(append(nodes[:1:1], removeCommentForms(nodes[1:])...))
+		}
+		if goclj.FnFormSymbol(n) {
+			name := nodes[0].(*parse.SymbolNode).Val
+			if style, ok := p.indentStyleForSymbol(name); ok &&
+				(style == IndentLet || style == IndentFor || style == IndentLetfn) {
+				if v := firstVector(nodes[1:]); v != nil {
+					bindingVector = v
+				}
+			}
+		}
+	case *parse.VectorNode:
+		// Removing a form from bindings would shift the pairs (and
+		// in letfn, (comment ...) may define a function).
+		if !bindings {
+			n.SetChildren(removeCommentForms(n.Children()))
+		}
+	case *parse.SetNode:
+		n.SetChildren(removeCommentForms(n.Children()))
+	}
+	// Other nodes, such as maps and reader conditionals, hold pairs
+	// (or a fixed number of children), so nothing can be removed.
+	afterLet := false
+	for _, child := range n.Children() {
+		// In a for-like form, :let introduces more bindings.
+		p.removeCommentFormsRec(child, child == bindingVector || (bindings && afterLet))
+		if goclj.Semantic(child) {
+			afterLet = isKeywordNode(child, ":let")
+		}
+	}
+}
+
+// removeCommentForms returns nodes without any (comment ...) forms. The
+// newlines on either side of each removed form are merged: the longer run is
+// kept, unless the form was at the start or end of nodes, in which case
+// neither is.
+func removeCommentForms(nodes []parse.Node) []parse.Node {
+	var result []parse.Node
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if !goclj.FnFormSymbol(node, "comment") {
+			result = append(result, node)
+			continue
+		}
+		var before, after int
+		for len(result) > 0 && goclj.Newline(result[len(result)-1]) {
+			result = result[:len(result)-1]
+			before++
+		}
+		for i+1 < len(nodes) && goclj.Newline(nodes[i+1]) {
+			i++
+			after++
+		}
+		if len(result) == 0 || i+1 == len(nodes) {
+			continue
+		}
+		if after > before {
+			before = after
+		}
+		for j := 0; j < before; j++ {
+			result = append(result, &parse.NewlineNode{})
+		}
+	}
+	return result
+}
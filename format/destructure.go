@@ -0,0 +1,174 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// fnLike are the forms, besides the defn-like ones, that take arglists.
+var fnLike = map[string]bool{
+	"defn-":    true,
+	"fn":       true,
+	"fn*":      true,
+	"defmacro": true,
+}
+
+func (p *Printer) normalizeDestructuringRec(n parse.Node) {
+	if goclj.FnFormSymbol(n) {
+		name := n.Children()[0].(*parse.SymbolNode).Val
+		if p.isDefnLike(n) || fnLike[name] {
+			for _, arglist := range arglists(n.Children()[1:]) {
+				p.normalizeBindingForm(arglist)
+			}
+		} else if style, ok := p.indentStyleForSymbol(name); ok &&
+			(style == IndentLet || style == IndentFor) {
+			if v := firstVector(n.Children()[1:]); v != nil {
+				for i, node := range semanticNodes(v.Nodes) {
+					if i%2 == 0 {
+						p.normalizeBindingForm(node)
+					}
+				}
+			}
+		}
+	}
+	for _, child := range n.Children() {
+		p.normalizeDestructuringRec(child)
+	}
+}
+
+// arglists returns the arglists of a defn- or fn-like form given the nodes
+// following its first symbol. After skipping the name, docstring, and
+// attribute map, this is either a single vector or, for a multi-arity form,
+// the vector which begins each list.
+func arglists(nodes []parse.Node) []*parse.VectorNode {
+	var vs []*parse.VectorNode
+	for _, node := range semanticNodes(nodes) {
+		switch node := node.(type) {
+		case *parse.SymbolNode, *parse.StringNode, *parse.MapNode:
+			if len(vs) > 0 {
+				return vs
+			}
+		case *parse.VectorNode:
+			if len(vs) == 0 {
+				return []*parse.VectorNode{node}
+			}
+			return vs
+		case *parse.ListNode:
+			if v := firstVector(node.Nodes); v != nil {
+				vs = append(vs, v)
+			}
+		default:
+			return vs
+		}
+	}
+	return vs
+}
+
+func semanticNodes(nodes []parse.Node) []parse.Node {
+	var result []parse.Node
+	for _, node := range nodes {
+		if goclj.Semantic(node) {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// normalizeBindingForm lays out the destructuring maps within the binding
+// form n (see TransformNormalizeDestructuring).
+func (p *Printer) normalizeBindingForm(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.VectorNode:
+		for _, node := range semanticNodes(n.Nodes) {
+			p.normalizeBindingForm(node)
+		}
+	case *parse.MapNode:
+		nodes := semanticNodes(n.Nodes)
+		for _, node := range nodes {
+			// In {{:keys [a]} :b}, the keys are binding forms.
+			// The values of :keys, :or, and so on are not, but
+			// they are left alone anyway.
+			p.normalizeBindingForm(node)
+		}
+		if normalizeDestructuringMap(n) {
+			p.destructuring[n] = struct{}{}
+		}
+	}
+}
+
+// normalizeDestructuringMap puts each entry of the destructuring map m on
+// its own line, with :or and :as last, if m spans more than one line. Maps
+// with comments, metadata, or other unusual contents are left alone. It
+// reports whether m was laid out.
+func normalizeDestructuringMap(m *parse.MapNode) bool {
+	for _, node := range m.Nodes {
+		switch node.(type) {
+		case *parse.CommentNode, *parse.CommaNode, *parse.MetadataNode,
+			*parse.TagNode, *parse.ReaderDiscardNode:
+			return false
+		}
+	}
+	nodes := semanticNodes(m.Nodes)
+	if !containsNewline(m) || len(nodes)%2 != 0 || !isDestructuringMap(nodes) {
+		return false
+	}
+	var entries, or, as [][2]parse.Node
+	for i := 0; i < len(nodes); i += 2 {
+		entry := [2]parse.Node{nodes[i], nodes[i+1]}
+		switch {
+		case isKeywordNode(nodes[i], ":or"):
+			or = append(or, entry)
+		case isKeywordNode(nodes[i], ":as"):
+			as = append(as, entry)
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(append(entries, or...), as...)
+	var result []parse.Node
+	for i, entry := range entries {
+		if i > 0 {
+			result = append(result, newline)
+		}
+		result = append(result, entry[0], entry[1])
+	}
+	m.SetChildren(result)
+	return true
+}
+
+func containsNewline(n parse.Node) bool {
+	if goclj.Newline(n) {
+		return true
+	}
+	for _, child := range n.Children() {
+		if containsNewline(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDestructuringMap reports whether the map whose semantic nodes are given
+// uses any of the destructuring keywords (:keys, :strs, :syms, :or, and :as,
+// or a namespaced version of the first three such as :foo/keys).
+func isDestructuringMap(nodes []parse.Node) bool {
+	for i := 0; i < len(nodes); i += 2 {
+		kw, ok := nodes[i].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		switch kw.Val {
+		case ":keys", ":strs", ":syms", ":or", ":as":
+			return true
+		}
+		if j := strings.LastIndexByte(kw.Val, '/'); j > 0 {
+			switch kw.Val[j+1:] {
+			case "keys", "syms":
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// implicitDoForms maps the names of forms which have an implicit do to the
+// number of arguments that precede the body.
+var implicitDoForms = map[string]int{
+	"binding":         1,
+	"do":              0,
+	"doseq":           1,
+	"dotimes":         1,
+	"let":             1,
+	"locking":         1,
+	"loop":            1,
+	"when":            1,
+	"when-first":      1,
+	"when-let":        1,
+	"when-not":        1,
+	"when-some":       1,
+	"with-local-vars": 1,
+	"with-open":       1,
+	"with-redefs":     1,
+}
+
+func (p *Printer) removeRedundantDoRec(n parse.Node) {
+	if isQuoted(n) {
+		return
+	}
+	if goclj.FnFormSymbol(n) {
+		name := n.Children()[0].(*parse.SymbolNode).Val
+		if args, ok := implicitDoForms[name]; ok {
+			spliceSoleDo(n, args+1, false)
+		} else if goclj.FnFormSymbol(n, "fn", "defn", "defn-", "defmacro") {
+			spliceFnBodies(n)
+		} else if style, ok := p.indentStyles[name]; ok && style == IndentDeftype {
+			for _, child := range n.Children()[1:] {
+				if goclj.FnFormSymbol(child) && isFnArity(child) {
+					spliceSoleDo(child, 2, false) // method name and arg vector
+				}
+			}
+		}
+	}
+	for _, child := range n.Children() {
+		p.removeRedundantDoRec(child)
+	}
+}
+
+// spliceFnBodies handles the body (or bodies, for a multi-arity function) of
+// an fn or defn form.
+func spliceFnBodies(n parse.Node) {
+	defn := !goclj.FnFormSymbol(n, "fn")
+	semanticIdx := 0
+	for _, child := range n.Children() {
+		if !goclj.Semantic(child) {
+			continue
+		}
+		semanticIdx++
+		switch child.(type) {
+		case *parse.SymbolNode:
+			// The head or the name.
+			continue
+		case *parse.StringNode, *parse.MapNode:
+			if defn {
+				// A docstring or attr-map.
+				continue
+			}
+		case *parse.VectorNode:
+			spliceSoleDo(n, semanticIdx, true)
+			return
+		case *parse.ListNode:
+			// Multiple arities.
+			if isFnArity(child) {
+				spliceSoleDo(child, 1, true)
+			}
+			continue
+		}
+		return
+	}
+}
+
+// isFnArity reports whether n looks like ([args] body...) or, if n begins
+// with a symbol, (name [args] body...).
+func isFnArity(n parse.Node) bool {
+	if _, ok := n.(*parse.ListNode); !ok {
+		return false
+	}
+	skip := goclj.FnFormSymbol(n)
+	for _, child := range n.Children() {
+		if !goclj.Semantic(child) {
+			continue
+		}
+		if skip {
+			skip = false
+			continue
+		}
+		return goclj.Vector(child)
+	}
+	return false
+}
+
+// spliceSoleDo replaces a (do ...) form in n with its contents if the do
+// follows the first lead semantic nodes of n and is the last semantic node.
+// If fnBody is true, the do is the body of a function, so it is left alone
+// if it begins with a map: spliced in, that would become a condition map.
+func spliceSoleDo(n parse.Node, lead int, fnBody bool) {
+	for {
+		nodes := n.Children()
+		doIdx := -1
+		semanticIdx := 0
+		for i, node := range nodes {
+			switch node.(type) {
+			case *parse.MetadataNode, *parse.TagNode:
+				return
+			}
+			if !goclj.Semantic(node) {
+				continue
+			}
+			if semanticIdx == lead {
+				doIdx = i
+			}
+			semanticIdx++
+		}
+		if semanticIdx != lead+1 || !goclj.FnFormSymbol(nodes[doIdx], "do") {
+			return
+		}
+		body := nodes[doIdx].Children()[1:]
+		if countSemantic(body) == 0 {
+			return
+		}
+		if fnBody && firstSemanticIsMap(body) {
+			return
+		}
+		if doIdx > 0 && goclj.Newline(nodes[doIdx-1]) {
+			for len(body) > 0 && goclj.Newline(body[0]) {
+				body = body[1:]
+			}
+		}
+		newNodes := make([]parse.Node, 0, len(nodes)+len(body))
+		newNodes = append(newNodes, nodes[:doIdx]...)
+		newNodes = append(newNodes, body...)
+		newNodes = append(newNodes, nodes[doIdx+1:]...)
+		n.SetChildren(newNodes)
+	}
+}
+
+func firstSemanticIsMap(nodes []parse.Node) bool {
+	for _, node := range nodes {
+		if goclj.Semantic(node) {
+			_, ok := node.(*parse.MapNode)
+			return ok
+		}
+	}
+	return false
+}
+
+func countSemantic(nodes []parse.Node) int {
+	n := 0
+	for _, node := range nodes {
+		if goclj.Semantic(node) {
+			n++
+		}
+	}
+	return n
+}
@@ -8,21 +8,39 @@ import (
 )
 
 func (p *Printer) markDocstrings(n parse.Node) {
-	if !goclj.FnFormSymbol(n, "ns", "defmulti", "def", "defmacro", "defn") {
+	if !goclj.FnFormSymbol(n, "ns", "defmulti", "def", "defmacro", "defn", "defn-", "defprotocol") {
 		return
 	}
-	nodes := n.Children()
-	if len(nodes) < 3 {
-		return
+	nodes := n.Children()[1:]
+	// Skip any metadata on the name: (defn ^:private foo "doc" ...).
+	for len(nodes) > 0 && (goclj.Newline(nodes[0]) || isMetadata(nodes[0])) {
+		nodes = nodes[1:]
 	}
-	if !goclj.Symbol(nodes[1]) {
+	if len(nodes) < 2 || !goclj.Symbol(nodes[0]) {
 		return
 	}
+	p.markLeadingDocstring(nodes[1:])
+	if goclj.FnFormSymbol(n, "defprotocol") {
+		for _, node := range nodes[1:] {
+			if sig, ok := node.(*parse.ListNode); ok {
+				p.markMethodDocstring(sig)
+			}
+		}
+	}
+}
+
+// markLeadingDocstring marks the string at the start of nodes (ignoring any
+// metadata before it), if any, as a docstring.
+func (p *Printer) markLeadingDocstring(nodes []parse.Node) {
 	var docstring *parse.StringNode
-	for _, node := range nodes[2:] {
+	for _, node := range nodes {
 		if goclj.Newline(node) {
 			continue
 		}
+		// Metadata may be attached to the docstring itself.
+		if docstring == nil && isMetadata(node) {
+			continue
+		}
 		// Once we've found what looks like a docstring, we need to keep
 		// going to ensure that there is something else inside this
 		// form. Otherwise what we found is not a docstring:
@@ -42,22 +60,69 @@ func (p *Printer) markDocstrings(n parse.Node) {
 	}
 }
 
-func (p *Printer) alignDocstring(docstring string, w int) string {
+// markMethodDocstring marks the docstring of a defprotocol method signature.
+// Unlike other docstrings, it comes last, after the arg vectors:
+//
+//	(area [this] [this units] "Computes the area.")
+func (p *Printer) markMethodDocstring(sig *parse.ListNode) {
+	var semantic []parse.Node
+	for _, node := range sig.Nodes {
+		if goclj.Semantic(node) {
+			semantic = append(semantic, node)
+		}
+	}
+	if len(semantic) < 3 || !goclj.Symbol(semantic[0]) {
+		return
+	}
+	last := len(semantic) - 1
+	for _, node := range semantic[1:last] {
+		if !goclj.Vector(node) {
+			return
+		}
+	}
+	if docstring, ok := semantic[last].(*parse.StringNode); ok {
+		p.docstrings[docstring] = struct{}{}
+	}
+}
+
+func isMetadata(n parse.Node) bool {
+	_, ok := n.(*parse.MetadataNode)
+	return ok
+}
+
+// docstringBase returns the column at which docstring's opening quote was
+// written in the source. Lines indented past that column keep their extra
+// indentation when the docstring is realigned. Docstrings created by
+// transforms have no position, so their new column w is used instead.
+func docstringBase(docstring *parse.StringNode, w int) int {
+	if docstring.Pos == nil {
+		return w
+	}
+	return docstring.Col - 1
+}
+
+// alignDocstring indents the lines after the first of docstring, which is
+// being printed at column w and was written at column base.
+func (p *Printer) alignDocstring(docstring string, w, base int) string {
 	var (
 		lines   = strings.Split(docstring, "\n")
 		aligned = []string{lines[0]}
-		indent  = strings.Repeat(string(p.IndentChar), w)
+		indent  = p.indent(w)
 	)
 	for _, line := range lines[1:] {
 		prefix := indent
 		n := strings.IndexFunc(line, func(r rune) bool { return r != ' ' })
-		if n > w {
-			prefix += strings.Repeat(" ", n-w)
+		if n > base {
+			prefix += strings.Repeat(" ", n-base)
 		}
+		cr := strings.HasSuffix(line, "\r") // keep CRLF line endings
 		line = strings.TrimSpace(line)
 		if line != "" {
 			line = prefix + line
 		}
+		if cr {
+			line += "\r"
+		}
 		aligned = append(aligned, line)
 	}
 	return strings.Join(aligned, "\n")
@@ -0,0 +1,156 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cespare/goclj/parse"
+)
+
+func fnLiteralsToFnRec(n parse.Node) {
+	if isQuoted(n) {
+		return
+	}
+	children := n.Children()
+	changed := false
+	for i, child := range children {
+		if fn, ok := child.(*parse.FnLiteralNode); ok {
+			children[i] = fnLiteralToFn(fn)
+			changed = true
+		}
+	}
+	if changed {
+		n.SetChildren(children)
+	}
+	for _, child := range children {
+		fnLiteralsToFnRec(child)
+	}
+}
+
+// fnLiteralToFn rewrites the fn literal n as an equivalent (fn [...] ...)
+// form. The arg symbols (%, %1, %&, and so on) in n are renamed in place.
+func fnLiteralToFn(n *parse.FnLiteralNode) *parse.ListNode {
+	args := fnLiteralArgs(n)
+	used := make(map[string]struct{})
+	findSymbolNames(n, used)
+	names := fnLiteralParamNames(args, used)
+
+	var params []parse.Node
+	for i := 1; i <= args.max; i++ {
+		name := "_"
+		if _, ok := args.positional[i]; ok {
+			name = names[i]
+		}
+		params = append(params, &parse.SymbolNode{Val: name})
+	}
+	if args.rest {
+		params = append(params,
+			&parse.SymbolNode{Val: "&"},
+			&parse.SymbolNode{Val: names[0]},
+		)
+	}
+	for _, sym := range args.syms {
+		i, _ := fnLiteralArgIndex(sym.Val)
+		sym.Val = names[i]
+	}
+	return &parse.ListNode{
+		Pos: n.Pos,
+		Nodes: []parse.Node{
+			&parse.SymbolNode{Val: "fn"},
+			&parse.VectorNode{Nodes: params},
+			&parse.ListNode{Pos: n.Pos, Nodes: n.Nodes},
+		},
+	}
+}
+
+// fnLiteralArgInfo describes the arguments used in the body of a fn literal.
+type fnLiteralArgInfo struct {
+	max        int              // highest %N (% counts as %1)
+	positional map[int]struct{} // the set of N for which %N is used
+	rest       bool             // whether %& is used
+	syms       []*parse.SymbolNode
+}
+
+func fnLiteralArgs(n parse.Node) fnLiteralArgInfo {
+	args := fnLiteralArgInfo{positional: make(map[int]struct{})}
+	var find func(parse.Node)
+	find = func(n parse.Node) {
+		if sym, ok := n.(*parse.SymbolNode); ok {
+			if i, ok := fnLiteralArgIndex(sym.Val); ok {
+				args.syms = append(args.syms, sym)
+				if i == 0 {
+					args.rest = true
+				} else {
+					args.positional[i] = struct{}{}
+					if i > args.max {
+						args.max = i
+					}
+				}
+			}
+		}
+		for _, child := range n.Children() {
+			find(child)
+		}
+	}
+	find(n)
+	return args
+}
+
+// fnLiteralArgIndex parses a fn literal arg symbol. It returns N for %N (and
+// 1 for %) and 0 for %&.
+func fnLiteralArgIndex(s string) (int, bool) {
+	switch s {
+	case "%":
+		return 1, true
+	case "%&":
+		return 0, true
+	}
+	if len(s) < 2 || s[0] != '%' {
+		return 0, false
+	}
+	i, err := strconv.Atoi(s[1:])
+	if err != nil || i < 1 || s[1] == '+' {
+		return 0, false
+	}
+	return i, true
+}
+
+// fnLiteralParamNames chooses names for the parameters described by args
+// which don't collide with any of the used names. The name for the rest
+// parameter (if any) is at index 0.
+func fnLiteralParamNames(args fnLiteralArgInfo, used map[string]struct{}) []string {
+	base, rest := "x", "more"
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			base = "arg" + strings.Repeat("'", attempt-1)
+			rest = "args" + strings.Repeat("'", attempt-1)
+		}
+		names := make([]string, args.max+1)
+		names[0] = rest
+		for i := 1; i <= args.max; i++ {
+			names[i] = base
+			if args.max > 1 {
+				names[i] += strconv.Itoa(i)
+			}
+		}
+		ok := true
+		for _, name := range names {
+			if _, collides := used[name]; collides {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return names
+		}
+	}
+}
+
+func findSymbolNames(n parse.Node, names map[string]struct{}) {
+	if sym, ok := n.(*parse.SymbolNode); ok {
+		names[sym.Val] = struct{}{}
+	}
+	for _, child := range n.Children() {
+		findSymbolNames(child, names)
+	}
+}
@@ -2,8 +2,11 @@ package format
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/cespare/goclj"
@@ -16,11 +19,64 @@ type Printer struct {
 	// IndentChar is the character used for indentation
 	// (by default, ' ' is used).
 	IndentChar rune
+	// IndentWidth is the number of columns occupied by a single
+	// IndentChar (by default, 1). If it is greater than 1, then an
+	// indentation of n columns is written as n/IndentWidth IndentChars
+	// followed by n%IndentWidth spaces for alignment. For example, with
+	// IndentChar set to '\t' and IndentWidth set to 2, the body of a defn
+	// is indented by a single tab.
+	IndentWidth int
+	// MaxLineWidth is the column limit used by TransformWrapLongLines
+	// (by default, 80).
+	MaxLineWidth int
+	// MaxInlineThreadSteps is the maximum number of threading macro steps
+	// that TransformBreakThreadChains leaves on a single line
+	// (by default, 3).
+	MaxInlineThreadSteps int
+	// LineEnding is written at the end of each line. If it is empty,
+	// "\n" is used.
+	LineEnding string
 	// IndentOverrides allow setting specific indentation styles for forms.
 	IndentOverrides map[string]IndentStyle
 	// ThreadFirstStyleOverrides allow specifying custom thread-first
-	// macros.
+	// (or thread-last) macros.
 	ThreadFirstStyleOverrides map[string]ThreadFirstStyle
+	// DefnLikeOverrides adds (true) or removes (false) symbols from the
+	// set of defn-like forms handled by TransformFixDefnArglistNewline.
+	// By default, this set is just defn.
+	DefnLikeOverrides map[string]bool
+	// BodyIndentPrefixes lists name prefixes, in addition to def, let,
+	// with-, and when-, of forms that are indented with IndentListBody
+	// when they have no specific indentation rule. For example, with the
+	// prefix "fixture-", (fixture-setup db ...) is indented as a body.
+	BodyIndentPrefixes []string
+	// IndentArityBodies makes the body of each arity of a multi-arity
+	// defn-like form, fn, or defmacro indented by two, as with
+	// IndentListBody:
+	//   (defn f
+	//     ([x]
+	//       (f x 1)))
+	// By default, the body is aligned with the arglist, following the
+	// Clojure style guide:
+	//   (defn f
+	//     ([x]
+	//      (f x 1)))
+	IndentArityBodies bool
+	// ImportStyle is the style of :import clause written by
+	// TransformNormalizeImports (by default, ImportGrouped).
+	ImportStyle ImportStyle
+
+	// Src, if non-nil, is the source code from which the tree given to
+	// PrintTree was parsed. It is needed for the cljfmt:off pragma: the
+	// top-level forms between a ;; cljfmt:off comment and the next
+	// ;; cljfmt:on comment are copied from Src rather than formatted.
+	Src []byte
+	// PreserveUnchanged, if set, makes PrintTree copy each top-level form
+	// that was not changed by any transform from Src (which must be set)
+	// instead of reprinting it. Forms that a transform changed are printed
+	// as usual. This is useful for applying transforms without reindenting
+	// the rest of the code.
+	PreserveUnchanged bool
 
 	// Transforms toggles the set of transformations to apply.
 	// This map overrides values in DefaultTransforms.
@@ -31,9 +87,36 @@ type Printer struct {
 	// threadFirstStyles is the union of defaultThreadFirstStyles and
 	// ThreadFirstStyleOverrides.
 	threadFirstStyles map[string]ThreadFirstStyle
-	specialIndent     map[parse.Node]IndentStyle
-	threadFirst       map[parse.Node]struct{}
-	docstrings        map[*parse.StringNode]struct{}
+	// defnLike is the union of defaultDefnLike and DefnLikeOverrides.
+	defnLike map[string]bool
+	// bodyPrefixes is defaultBodyIndentPrefixes plus BodyIndentPrefixes.
+	bodyPrefixes  []string
+	specialIndent map[parse.Node]IndentStyle
+	threadFirst   map[parse.Node]struct{}
+	docstrings    map[*parse.StringNode]struct{}
+	// flat caches the results of printFlat during a call to PrintTree.
+	// A scratch Printer (see printScratch) writes the flat renderings in
+	// reuseFlat in place of the nodes themselves.
+	flat      map[parse.Node]flatNode
+	reuseFlat map[parse.Node]flatNode
+	// valuePads holds the number of extra spaces to write before
+	// particular map values (for TransformAlignMapValues).
+	valuePads map[parse.Node]int
+	// destructuring holds the maps laid out by
+	// TransformNormalizeDestructuring, whose values are aligned.
+	destructuring map[*parse.MapNode]struct{}
+	// verbatim maps nodes to source text that is printed in their place:
+	// each cljfmt:off comment is printed as the whole region it begins,
+	// and with PreserveUnchanged, unchanged top-level forms are printed as
+	// they were written. protected holds the top-level nodes within the
+	// cljfmt:off regions (which are not printed themselves).
+	verbatim  map[parse.Node]string
+	protected []parse.Node
+	// trailingComments records where the comments that end lines were
+	// written (for TransformAlignTrailingComments). Each call to
+	// printSequence gets a new sequence number from seqs.
+	trailingComments []trailingComment
+	seqs             int
 
 	// The requires and refers maps track all the require aliases and
 	// referred names.
@@ -45,11 +128,14 @@ type Printer struct {
 // NewPrinter creates a printer to the given writer.
 func NewPrinter(w io.Writer) *Printer {
 	return &Printer{
-		bufWriter:     &bufWriter{bufio.NewWriter(w)},
+		bufWriter:     &bufWriter{bw: bufio.NewWriter(w)},
 		IndentChar:    ' ',
 		specialIndent: make(map[parse.Node]IndentStyle),
 		threadFirst:   make(map[parse.Node]struct{}),
 		docstrings:    make(map[*parse.StringNode]struct{}),
+		valuePads:     make(map[parse.Node]int),
+		destructuring: make(map[*parse.MapNode]struct{}),
+		verbatim:      make(map[parse.Node]string),
 		requires:      make(map[string]string),
 		refers:        make(map[string]string),
 	}
@@ -57,6 +143,76 @@ func NewPrinter(w io.Writer) *Printer {
 
 // PrintTree writes t to p's writer.
 func (p *Printer) PrintTree(t *parse.Tree) (err error) {
+	p.init()
+	defer catchPrintErr(&err)
+	t.Roots = p.protectVerbatim(t.Roots)
+	orig := p.snapshotRoots(t.Roots)
+	p.applyTransforms(t)
+	p.preserveUnchanged(t.Roots, orig)
+	for _, node := range t.Roots {
+		p.markDocstrings(node)
+		p.markThreadFirsts(node)
+		p.markRequires(node)
+	}
+	p.flat = make(map[parse.Node]flatNode)
+	// The output always ends with a single newline (unless it is empty).
+	roots := t.Roots
+	for len(roots) > 0 && goclj.Newline(roots[len(roots)-1]) {
+		roots = roots[:len(roots)-1]
+	}
+	if !p.Transforms[TransformAlignTrailingComments] {
+		p.printRoots(roots)
+		return p.bw.Flush()
+	}
+	// Aligning the comments is a second pass over the output.
+	out := p.bufWriter
+	var buf bytes.Buffer
+	p.bufWriter = &bufWriter{bw: bufio.NewWriter(&buf)}
+	p.printRoots(roots)
+	if err := p.bw.Flush(); err != nil {
+		return err
+	}
+	p.bufWriter = out
+	p.writeString(string(alignTrailingComments(buf.Bytes(), p.trailingComments)))
+	return p.bw.Flush()
+}
+
+func (p *Printer) printRoots(roots []parse.Node) {
+	p.printSequence(roots, 0, IndentNormal)
+	if len(roots) > 0 {
+		p.writeNewline()
+	}
+}
+
+// PrintNode writes n to p's writer, formatted as if it began at the start of
+// a line. Unlike PrintTree, PrintNode does not apply transforms (other than
+// TransformWrapLongLines, which happens during printing) and does not write a
+// trailing newline.
+func (p *Printer) PrintNode(n parse.Node) (err error) {
+	p.init()
+	defer catchPrintErr(&err)
+	p.markDocstrings(n)
+	p.markThreadFirsts(n)
+	p.markRequires(n)
+	if goclj.Newline(n) {
+		p.writeNewline()
+	} else {
+		p.printNode(n, 0)
+	}
+	return p.bw.Flush()
+}
+
+// NodeString formats n using a Printer with the default settings.
+func NodeString(n parse.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := NewPrinter(&buf).PrintNode(n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// init sets up p's internal state from its exported settings.
+func (p *Printer) init() {
 	p.indentStyles = make(map[string]IndentStyle)
 	for k, v := range defaultIndents {
 		p.indentStyles[k] = v
@@ -71,6 +227,16 @@ func (p *Printer) PrintTree(t *parse.Tree) (err error) {
 	for k, v := range p.ThreadFirstStyleOverrides {
 		p.threadFirstStyles[k] = v
 	}
+	p.flat = make(map[parse.Node]flatNode)
+	p.defnLike = make(map[string]bool)
+	for k, v := range defaultDefnLike {
+		p.defnLike[k] = v
+	}
+	for k, v := range p.DefnLikeOverrides {
+		p.defnLike[k] = v
+	}
+	p.bodyPrefixes = append(append([]string(nil), defaultBodyIndentPrefixes...),
+		p.BodyIndentPrefixes...)
 	if p.Transforms == nil {
 		p.Transforms = DefaultTransforms
 	} else {
@@ -80,31 +246,32 @@ func (p *Printer) PrintTree(t *parse.Tree) (err error) {
 			}
 		}
 	}
-	defer func() {
-		if e := recover(); e != nil {
-			switch e := e.(type) {
-			case bufErr:
-				err = e
-			case fmtErr:
-				err = e
-			default:
-				panic(e)
-			}
+}
+
+// catchPrintErr recovers from the panics used to report errors during
+// printing, storing the error in *err. It must be deferred.
+func catchPrintErr(err *error) {
+	if e := recover(); e != nil {
+		switch e := e.(type) {
+		case bufErr:
+			*err = e
+		case fmtErr:
+			*err = e
+		default:
+			panic(e)
 		}
-	}()
-	applyTransforms(t, p.Transforms)
-	for _, node := range t.Roots {
-		p.markDocstrings(node)
-		p.markThreadFirsts(node)
-		p.markRequires(node)
 	}
-	p.printSequence(t.Roots, 0, IndentNormal)
-	return p.bw.Flush()
 }
 
 // printNode prints a representation of node using w, the given indent level
 // as a baseline. It returns the new indent.
 func (p *Printer) printNode(node parse.Node, w int) int {
+	if text, ok := p.verbatim[node]; ok {
+		return w + p.writeString(text)
+	}
+	if f, ok := p.reuseFlat[node]; ok && f.ok {
+		return w + p.writeString(f.s)
+	}
 	switch node := node.(type) {
 	case *parse.BoolNode:
 		if node.Val {
@@ -114,8 +281,12 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 		}
 	case *parse.CharacterNode:
 		return w + p.writeString(node.Text)
+	case *parse.CommaNode:
+		return w + p.writeByte(',')
 	case *parse.CommentNode:
 		return w + p.writeString(node.Text)
+	case *parse.ShebangNode:
+		return w + p.writeString(node.Text)
 	case *parse.DerefNode:
 		w += p.writeByte('@')
 		return p.printNode(node.Node, w)
@@ -124,14 +295,29 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 		w = p.printSequence(node.Nodes, w, p.chooseIndent(node.Nodes))
 		return w + p.writeString(")")
 	case *parse.ReaderCondNode:
+		p.wrapLongLine(node, w, indentBindings)
 		w += p.writeString("#?(")
 		w = p.printSequence(node.Nodes, w, indentBindings)
 		return w + p.writeString(")")
 	case *parse.ReaderCondSpliceNode:
+		p.wrapLongLine(node, w, indentBindings)
 		w += p.writeString("#?@(")
 		w = p.printSequence(node.Nodes, w, indentBindings)
 		return w + p.writeString(")")
 	case *parse.ReaderDiscardNode:
+		// Stacked discards are written #_ #_ a b.
+		if inner, ok := node.Node.(*parse.ReaderDiscardNode); ok {
+			w += p.writeString("#_ ")
+			for {
+				w += p.writeString("#_ ")
+				next, ok := inner.Node.(*parse.ReaderDiscardNode)
+				if !ok {
+					break
+				}
+				inner = next
+			}
+			return p.printNode(inner.Node, w)
+		}
 		w += p.writeString("#_")
 		return p.printNode(node.Node, w)
 	case *parse.ReaderEvalNode:
@@ -151,6 +337,10 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 		if _, ok := p.threadFirst[node]; ok {
 			style = style.threadFirstTransform()
 		}
+		p.wrapLongLine(node, w, style)
+		if style == IndentAre && p.Transforms[TransformAlignAreTables] {
+			p.layoutAreTable(node)
+		}
 		w += p.writeString("(")
 		w = p.printSequence(node.Nodes, w, style)
 		return w + p.writeString(")")
@@ -159,6 +349,8 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 			w += p.writeString("#")
 			w += p.writeString(node.Namespace)
 		}
+		p.wrapLongLine(node, w, indentBindings)
+		p.alignMapValues(node)
 		w += p.writeString("{")
 		w = p.printSequence(node.Nodes, w, indentBindings)
 		return w + p.writeString("}")
@@ -177,13 +369,14 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 	case *parse.RegexNode:
 		return w + p.writeString(`#"`+node.Val+`"`)
 	case *parse.SetNode:
+		p.wrapLongLine(node, w, IndentNormal)
 		w += p.writeString("#{")
 		w = p.printSequence(node.Nodes, w, IndentNormal)
 		return w + p.writeString("}")
 	case *parse.StringNode:
 		val := node.Val
 		if _, ok := p.docstrings[node]; ok {
-			val = p.alignDocstring(val, w)
+			val = p.alignDocstring(val, w, docstringBase(node, w))
 			delete(p.docstrings, node)
 		}
 		return w + p.writeString(`"`+val+`"`)
@@ -209,6 +402,7 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 		} else {
 			style = IndentNormal
 		}
+		p.wrapLongLine(node, w, style)
 		w += p.writeString("[")
 		w = p.printSequence(node.Nodes, w, style)
 		return w + p.writeString("]")
@@ -241,6 +435,9 @@ func (p *Printer) applySpecialIndentRules(node *parse.ListNode) {
 			p.applySpecialDeftype(node.Nodes)
 		}
 	}
+	if p.IndentArityBodies && (p.isDefnLike(node) || fnLike[s.Val]) {
+		p.applySpecialMultiArity(node.Nodes)
+	}
 }
 
 func (p *Printer) applySpecialForLet(nodes []parse.Node) {
@@ -314,6 +511,22 @@ func (p *Printer) applySpecialDeftype(nodes []parse.Node) {
 	}
 }
 
+// applySpecialMultiArity indents each arity of a multi-arity defn- or
+// fn-like form, as in ([x y] body), using IndentListBody
+// (see Printer.IndentArityBodies).
+func (p *Printer) applySpecialMultiArity(nodes []parse.Node) {
+	for _, node := range nodes[1:] {
+		switch node := node.(type) {
+		case *parse.VectorNode:
+			return // a single-arity form
+		case *parse.ListNode:
+			if firstVector(node.Nodes) != nil {
+				p.specialIndent[node] = IndentListBody
+			}
+		}
+	}
+}
+
 func (p *Printer) chooseIndent(nodes []parse.Node) IndentStyle {
 	if len(nodes) == 0 {
 		return IndentNormal
@@ -323,6 +536,14 @@ func (p *Printer) chooseIndent(nodes []parse.Node) IndentStyle {
 		return IndentList
 	case *parse.SymbolNode:
 		return p.chooseListIndent(node.Val)
+	case *parse.ListNode, *parse.FnLiteralNode:
+		// A computed function, as in ((partial + 1) 2 3), is called
+		// like any other. If it spans several lines, though, aligning
+		// the arguments with one another is more confusing than
+		// helpful.
+		if _, ok := p.printFlat(node); ok {
+			return IndentList
+		}
 	}
 	return IndentNormal
 }
@@ -332,7 +553,7 @@ func (p *Printer) chooseListIndent(name string) IndentStyle {
 		return style
 	}
 	name = symbolName(name)
-	for _, prefix := range []string{"def", "let", "with-", "when-"} {
+	for _, prefix := range p.bodyPrefixes {
 		if strings.HasPrefix(name, prefix) {
 			return IndentListBody
 		}
@@ -340,28 +561,44 @@ func (p *Printer) chooseListIndent(name string) IndentStyle {
 	return IndentList
 }
 
+// indentStyleForSymbol looks up the indentation rule for the function or
+// macro named by name. Aliases and referred names are resolved using the
+// file's ns form, so a rule may be keyed by the fully-qualified name
+// (clojure.core.async/go-loop) or by an alias (async/go-loop). A rule for
+// the unqualified name (go-loop) applies to qualified names as well.
 func (p *Printer) indentStyleForSymbol(name string) (IndentStyle, bool) {
+	var candidates []string
 	if i := strings.LastIndex(name, "/"); i >= 0 {
 		ns := name[:i]
 		unqualified := name[i+1:]
 		if req, ok := p.requires[ns]; ok {
-			if style, ok := p.indentStyles[req+"/"+unqualified]; ok {
-				return style, true
-			}
-		}
-		if style, ok := p.indentStyles[unqualified]; ok {
-			return style, true
+			candidates = append(candidates, req+"/"+unqualified)
 		}
+		candidates = append(candidates, name, unqualified)
 	} else {
 		if req, ok := p.refers[name]; ok {
-			if style, ok := p.indentStyles[req+"/"+name]; ok {
-				return style, true
+			candidates = append(candidates, req+"/"+name)
+			// A rule may also be keyed by an alias of the
+			// namespace the name is referred from.
+			var aliases []string
+			for as, ns := range p.requires {
+				if ns == req {
+					aliases = append(aliases, as)
+				}
+			}
+			sort.Strings(aliases)
+			for _, as := range aliases {
+				candidates = append(candidates, as+"/"+name)
 			}
 		}
+		candidates = append(candidates, name)
 	}
-	// Fall back to any rule for the name as written.
-	style, ok := p.indentStyles[name]
-	return style, ok
+	for _, c := range candidates {
+		if style, ok := p.indentStyles[c]; ok {
+			return style, true
+		}
+	}
+	return 0, false
 }
 
 func symbolName(sym string) string {
@@ -371,7 +608,30 @@ func symbolName(sym string) string {
 	return sym
 }
 
-// A ThreadFirst style represents a variety of thread-first macro.
+func isDiscard(n parse.Node) bool {
+	_, ok := n.(*parse.ReaderDiscardNode)
+	return ok
+}
+
+// discardedSiblings returns the number of forms following n that are
+// discarded along with it: #_ #_ a b discards b as well as a.
+func discardedSiblings(n parse.Node) int {
+	count := 0
+	for {
+		d, ok := n.(*parse.ReaderDiscardNode)
+		if !ok {
+			break
+		}
+		count++
+		n = d.Node
+	}
+	if count == 0 {
+		return 0
+	}
+	return count - 1
+}
+
+// A ThreadFirstStyle represents a variety of threading macro.
 type ThreadFirstStyle int
 
 const (
@@ -382,12 +642,53 @@ const (
 	// ThreadFirstCondArrow is the style used by cond->, which takes one
 	// argument and then threads through every other form thereafter.
 	ThreadFirstCondArrow
+	// ThreadLastNormal is for thread-last macros such as ->> and some->>.
+	// These insert the threaded value as the last argument of each step,
+	// so the steps are indented as they are written.
+	ThreadLastNormal
+	// ThreadLastCondArrow is the thread-last counterpart of
+	// ThreadFirstCondArrow, used by cond->>.
+	ThreadLastCondArrow
 )
 
+var threadFirstStyleNames = map[ThreadFirstStyle]string{
+	ThreadFirstNormal:    "normal",
+	ThreadFirstCondArrow: "cond->",
+	ThreadLastNormal:     "thread-last",
+	ThreadLastCondArrow:  "cond->>",
+}
+
+// String returns the name of the style, as used in the cljfmt config file
+// (without the leading colon): normal, cond->, thread-last, or cond->>.
+func (style ThreadFirstStyle) String() string {
+	if name, ok := threadFirstStyleNames[style]; ok {
+		return name
+	}
+	return fmt.Sprintf("ThreadFirstStyle(%d)", int(style))
+}
+
+// ThreadFirstStyleFromString returns the style with the given name.
+// It is the inverse of ThreadFirstStyle.String.
+func ThreadFirstStyleFromString(name string) (ThreadFirstStyle, bool) {
+	for style, s := range threadFirstStyleNames {
+		if s == name {
+			return style, true
+		}
+	}
+	return 0, false
+}
+
 var defaultThreadFirstStyles = map[string]ThreadFirstStyle{
-	"->":     ThreadFirstNormal,
-	"cond->": ThreadFirstCondArrow,
-	"some->": ThreadFirstNormal,
+	"->":      ThreadFirstNormal,
+	"->>":     ThreadLastNormal,
+	"cond->":  ThreadFirstCondArrow,
+	"cond->>": ThreadLastCondArrow,
+	"some->":  ThreadFirstNormal,
+	"some->>": ThreadLastNormal,
+}
+
+var defaultDefnLike = map[string]bool{
+	"defn": true,
 }
 
 // An IndentStyle represents the indentation strategy
@@ -481,9 +782,95 @@ const (
 	// IndentCond4 is like IndentCond0 except that it ignores 4 body
 	// parameters.
 	IndentCond4
+	// IndentAre is for forms like clojure.test/are which take a binding
+	// vector and an expression followed by a table of values. The table is
+	// indented like a body (and TransformAlignAreTables lays it out in
+	// rows).
+	//   (are [x y] (= x y)
+	//     1 1
+	//     "a" "a")
+	IndentAre
+	// indentBody is the first of the styles returned by IndentBodyN.
+	indentBody
 )
 
+// IndentBodyN returns the style for forms which take n fixed arguments
+// followed by a body. The fixed arguments are aligned as with IndentList and
+// the body is indented by two, as with IndentListBody.
+//   (with-redefs-fn {#'foo bar} ; IndentBodyN(1)
+//     (fn []
+//       (foo)))
+//   (my-macro a                 ; IndentBodyN(2)
+//             b
+//     body)
+// If n is less than 1, IndentBodyN returns IndentListBody.
+func IndentBodyN(n int) IndentStyle {
+	if n < 1 {
+		return IndentListBody
+	}
+	return indentBody + IndentStyle(n-1)
+}
+
+// bodyArgs returns the number of fixed arguments of a style created with
+// IndentBodyN. The second result is false for all other styles.
+func (style IndentStyle) bodyArgs() (int, bool) {
+	if style < indentBody {
+		return 0, false
+	}
+	return int(style-indentBody) + 1, true
+}
+
+var indentStyleNames = map[IndentStyle]string{
+	IndentNormal:   "normal",
+	IndentList:     "list",
+	IndentListBody: "list-body",
+	IndentLet:      "let",
+	IndentFor:      "for",
+	IndentLetfn:    "letfn",
+	IndentDeftype:  "deftype",
+	IndentCond0:    "cond0",
+	IndentCond1:    "cond1",
+	IndentCond2:    "cond2",
+	IndentCond4:    "cond4",
+	IndentAre:      "are",
+}
+
+// String returns the name of the style, as used in the cljfmt config file
+// (without the leading colon): for example, list-body, cond0, or body-2
+// (for IndentBodyN(2)).
+func (style IndentStyle) String() string {
+	if name, ok := indentStyleNames[style]; ok {
+		return name
+	}
+	if n, ok := style.bodyArgs(); ok {
+		return fmt.Sprintf("body-%d", n)
+	}
+	return fmt.Sprintf("IndentStyle(%d)", int(style))
+}
+
+// IndentStyleFromString returns the style with the given name.
+// It is the inverse of IndentStyle.String.
+func IndentStyleFromString(name string) (IndentStyle, bool) {
+	for style, s := range indentStyleNames {
+		if s == name {
+			return style, true
+		}
+	}
+	if s := strings.TrimPrefix(name, "body-"); s != name {
+		// Require the canonical form of N (no sign or leading zeros).
+		if n, err := strconv.Atoi(s); err == nil && n >= 1 && strconv.Itoa(n) == s {
+			return IndentBodyN(n), true
+		}
+	}
+	return 0, false
+}
+
+// defaultBodyIndentPrefixes are the name prefixes of forms which are
+// indented with IndentListBody if they have no other rule.
+var defaultBodyIndentPrefixes = []string{"def", "let", "with-", "when-"}
+
 var defaultIndents = map[string]IndentStyle{
+	"are":             IndentAre,
 	"as->":            IndentListBody,
 	"assoc":           IndentCond1,
 	"binding":         IndentLet,
@@ -556,9 +943,14 @@ var indentExtraOffsets = [...]int{
 	IndentCond1:    2,
 	IndentCond2:    3,
 	IndentCond4:    5,
+	IndentAre:      0,
 }
 
 func (style IndentStyle) threadFirstTransform() IndentStyle {
+	if n, ok := style.bodyArgs(); ok {
+		// The threaded value is the first fixed argument.
+		return IndentBodyN(n - 1)
+	}
 	switch style {
 	case IndentCond1:
 		return IndentCond0
@@ -583,6 +975,13 @@ func (style IndentStyle) threadFirstTransform() IndentStyle {
 const indentListMaxCommentAlign = 12
 
 func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) int {
+	// Forms with a fixed number of arguments before their body are
+	// indented like IndentList until the body begins.
+	bodyArgs, isBody := style.bodyArgs()
+	bodyIndent := w + 1
+	if isBody {
+		style = IndentList
+	}
 	var (
 		w2         = w
 		needSpace  = false
@@ -624,11 +1023,36 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 		// If we had a newline during a paired element, extraIndent
 		// indicates this so that we can remove the indent afterward.
 		extraIndent = false
+
+		// commas counts the CommaNodes we've printed. These are
+		// ignored for the purpose of indentation.
+		commas int
+
+		// discarded counts the upcoming semantic nodes which are
+		// discarded by a stacked #_ #_.
+		discarded int
 	)
 	if pairStartIdx > 0 {
 		pairIdx = -1
 	}
-	for i, n := range nodes {
+	seq := p.seqs
+	p.seqs++
+	for j, n := range nodes {
+		if goclj.Comma(n) {
+			if needIndent {
+				p.writeIndent(w)
+				needIndent = false
+			}
+			w2 = p.printNode(n, w2)
+			if j-commas == 1 {
+				// Align with what follows the comma.
+				firstIndent = w2
+			}
+			commas++
+			needSpace = true
+			continue
+		}
+		i := j - commas
 		if goclj.Newline(n) {
 			switch style {
 			case IndentList,
@@ -636,7 +1060,8 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 				IndentLet,
 				IndentLetfn,
 				IndentFor,
-				IndentDeftype:
+				IndentDeftype,
+				IndentAre:
 				if i == 1 {
 					w++
 				}
@@ -653,13 +1078,20 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 				}
 			}
 			w2 = w
-			p.writeByte('\n')
+			p.writeNewline()
 			needIndent = true
 			needSpace = false
 			continue
 		}
 
-		semantic := goclj.Semantic(n)
+		// A discarded form doesn't count when pairing up bindings
+		// or map entries.
+		semantic := goclj.Semantic(n) && !isDiscard(n)
+		if semantic && discarded > 0 {
+			semantic = false
+			discarded--
+		}
+		discarded += discardedSiblings(n)
 
 		switch style {
 		case IndentList, IndentCond0:
@@ -677,11 +1109,18 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 			}
 		}
 		if needIndent {
-			p.writeString(strings.Repeat(string(p.IndentChar), w))
+			p.writeIndent(w)
 		}
 		if needSpace {
 			w2 += p.writeByte(' ')
 		}
+		if pad, ok := p.valuePads[n]; ok {
+			w2 += p.writeString(strings.Repeat(" ", pad))
+			delete(p.valuePads, n)
+		}
+		if needSpace && goclj.Comment(n) && p.Transforms[TransformAlignTrailingComments] {
+			p.trailingComments = append(p.trailingComments, trailingComment{seq, p.written})
+		}
 		w2 = p.printNode(n, w2)
 		if i == 0 {
 			firstIndent = w2
@@ -702,6 +1141,9 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 			pairIdx++
 		}
 
+		if isBody && semanticIdx == bodyArgs+1 {
+			w = bodyIndent
+		}
 		if semanticIdx == pairStartIdx ||
 			(pairIdx == 2 && !isKeywordNode(n, ":>>")) || pairIdx > 2 {
 			pairIdx = 0
@@ -710,11 +1152,44 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 	// We need to put in a trailing indent here; the next token cannot be a
 	// newline (it will need to be the closing delimiter for this sequence).
 	if needIndent {
-		p.writeString(strings.Repeat(string(p.IndentChar), w))
+		p.writeIndent(w)
 	}
 	return w2
 }
 
+// writeNewline writes p's line ending.
+func (p *Printer) writeNewline() {
+	if p.LineEnding == "" {
+		p.writeByte('\n')
+		return
+	}
+	p.writeString(p.LineEnding)
+}
+
+// writeIndent writes the indentation for column w (see indent) without
+// building a string.
+func (p *Printer) writeIndent(w int) {
+	n, spaces := w, 0
+	if p.IndentWidth > 1 {
+		n, spaces = w/p.IndentWidth, w%p.IndentWidth
+	}
+	for i := 0; i < n; i++ {
+		p.writeRune(p.IndentChar)
+	}
+	for i := 0; i < spaces; i++ {
+		p.writeByte(' ')
+	}
+}
+
+// indent returns the whitespace used to indent a line to column w.
+func (p *Printer) indent(w int) string {
+	if p.IndentWidth <= 1 {
+		return strings.Repeat(string(p.IndentChar), w)
+	}
+	return strings.Repeat(string(p.IndentChar), w/p.IndentWidth) +
+		strings.Repeat(" ", w%p.IndentWidth)
+}
+
 func isKeywordNode(n parse.Node, kw string) bool {
 	kn, ok := n.(*parse.KeywordNode)
 	if !ok {
@@ -725,6 +1200,8 @@ func isKeywordNode(n parse.Node, kw string) bool {
 
 type bufWriter struct {
 	bw *bufio.Writer
+	// written is the number of bytes written so far.
+	written int
 }
 
 type bufErr struct{ error }
@@ -734,12 +1211,22 @@ func (bw *bufWriter) writeString(s string) int {
 	if err != nil {
 		panic(bufErr{err})
 	}
+	bw.written += n
+	return n
+}
+func (bw *bufWriter) writeRune(r rune) int {
+	n, err := bw.bw.WriteRune(r)
+	if err != nil {
+		panic(bufErr{err})
+	}
+	bw.written += n
 	return n
 }
 func (bw *bufWriter) writeByte(b byte) int {
 	if err := bw.bw.WriteByte(b); err != nil {
 		panic(bufErr{err})
 	}
+	bw.written++
 	return 1
 }
 
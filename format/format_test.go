@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"math"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -54,6 +55,54 @@ func TestTransformsUseToRequire(t *testing.T) {
 		"custom/use2require_after.clj",
 		map[Transform]bool{TransformUseToRequire: true},
 	)
+	testChangeTransforms(
+		t,
+		"custom/use2require_before.clj",
+		"custom/use2require_expanded_after.clj",
+		map[Transform]bool{
+			TransformUseToRequire:             true,
+			TransformExpandRequirePrefixLists: true,
+		},
+	)
+}
+
+func TestTransformsUseToRequireStrict(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/use2requirestrict_before.clj",
+		"custom/use2requirestrict_after.clj",
+		map[Transform]bool{TransformUseToRequireStrict: true},
+	)
+}
+
+func TestTransformsRequireRename(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/rename_before.clj",
+		"custom/rename_after.clj",
+		map[Transform]bool{
+			TransformUseToRequire:         true,
+			TransformRemoveUnusedRequires: true,
+		},
+	)
+}
+
+func TestTransformsRequireAsAlias(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/asalias_before.clj",
+		"custom/asalias_after.clj",
+		map[Transform]bool{TransformRemoveUnusedRequires: true},
+	)
+}
+
+func TestTransformsMergeRefers(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/mergerefer_before.clj",
+		"custom/mergerefer_after.clj",
+		map[Transform]bool{TransformUseToRequire: true},
+	)
 }
 
 func TestTransformsRemoveUnusedRequires(t *testing.T) {
@@ -68,6 +117,33 @@ func TestTransformsRemoveUnusedRequires(t *testing.T) {
 	)
 }
 
+func TestTransformsRemoveUnusedRequiresExclude(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/unusedrequiresexclude_before.clj",
+		"custom/unusedrequiresexclude_after.clj",
+		map[Transform]bool{TransformRemoveUnusedRequires: true},
+	)
+}
+
+func TestTransformsRemoveUnusedRequiresQualified(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/unusedrequiresqualified_before.clj",
+		"custom/unusedrequiresqualified_after.clj",
+		map[Transform]bool{TransformRemoveUnusedRequires: true},
+	)
+}
+
+func TestTransformsRemoveUnusedRequiresSyntaxQuote(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/unusedrequiressyntaxquote_before.clj",
+		"custom/unusedrequiressyntaxquote_after.clj",
+		map[Transform]bool{TransformRemoveUnusedRequires: true},
+	)
+}
+
 func TestTransformsRemoveUnusedRequiresEmpty(t *testing.T) {
 	testChangeTransforms(
 		t,
@@ -126,6 +202,74 @@ func TestIssue41(t *testing.T) {
 	testChangeCustom(t, file, file, f)
 }
 
+func TestAliasIndentOverride(t *testing.T) {
+	f := func(p *Printer) {
+		p.IndentOverrides = map[string]IndentStyle{
+			// The most specific rule applies to both the aliased and
+			// the referred name.
+			"clojure.core.async/go-loop": IndentLet,
+			"go-loop":                    IndentListBody,
+			"async/alt!":                 IndentCond0,
+			"alt!":                       IndentList,
+		}
+	}
+	testChangeCustom(t, "custom/aliasindent_before.clj", "custom/aliasindent_after.clj", f)
+}
+
+func TestIndentStyleString(t *testing.T) {
+	styles := []IndentStyle{
+		IndentNormal,
+		IndentList,
+		IndentListBody,
+		IndentLet,
+		IndentFor,
+		IndentLetfn,
+		IndentDeftype,
+		IndentCond0,
+		IndentCond1,
+		IndentCond2,
+		IndentCond4,
+		IndentAre,
+		IndentBodyN(1),
+		IndentBodyN(5),
+	}
+	for _, style := range styles {
+		name := style.String()
+		got, ok := IndentStyleFromString(name)
+		if !ok || got != style {
+			t.Errorf("IndentStyleFromString(%q): got (%d, %t); want (%d, true)",
+				name, got, ok, style)
+		}
+	}
+	if got := IndentBodyN(2).String(); got != "body-2" {
+		t.Errorf("IndentBodyN(2).String(): got %q; want body-2", got)
+	}
+	for _, name := range []string{"", ":list", "bindings", "body-0", "body-02", "body-x"} {
+		if style, ok := IndentStyleFromString(name); ok {
+			t.Errorf("IndentStyleFromString(%q): got %d; want not ok", name, style)
+		}
+	}
+}
+
+func TestThreadFirstStyleString(t *testing.T) {
+	for _, style := range []ThreadFirstStyle{
+		ThreadFirstNormal,
+		ThreadFirstCondArrow,
+		ThreadLastNormal,
+		ThreadLastCondArrow,
+	} {
+		name := style.String()
+		got, ok := ThreadFirstStyleFromString(name)
+		if !ok || got != style {
+			t.Errorf("ThreadFirstStyleFromString(%q): got (%d, %t); want (%d, true)",
+				name, got, ok, style)
+		}
+	}
+	if style, ok := ThreadFirstStyleFromString("->"); ok {
+		t.Errorf(`ThreadFirstStyleFromString("->"): got %d; want not ok`, style)
+	}
+}
+
 func TestThreadFirstOverride(t *testing.T) {
 	const file = "custom/threadfirst.clj"
 	f := func(p *Printer) {
@@ -136,6 +280,760 @@ func TestThreadFirstOverride(t *testing.T) {
 	testChangeCustom(t, file, file, f)
 }
 
+func TestThreadLastOverride(t *testing.T) {
+	const file = "custom/threadlast.clj"
+	f := func(p *Printer) {
+		p.ThreadFirstStyleOverrides = map[string]ThreadFirstStyle{
+			"-?>>": ThreadLastNormal,
+		}
+	}
+	testChangeCustom(t, file, file, f)
+
+	// A thread-last style replaces a default thread-first one.
+	f = func(p *Printer) {
+		p.ThreadFirstStyleOverrides = map[string]ThreadFirstStyle{
+			"->":   ThreadLastNormal,
+			"-?>>": ThreadLastNormal,
+		}
+	}
+	testChangeCustom(t, "custom/threadlast_override_before.clj", "custom/threadlast_override_after.clj", f)
+}
+
+func TestIndentBodyN(t *testing.T) {
+	f := func(p *Printer) {
+		p.IndentOverrides = map[string]IndentStyle{
+			"with-redefs-fn": IndentBodyN(1),
+			"defroute":       IndentBodyN(2),
+		}
+	}
+	testChangeCustom(t, "custom/bodyn_before.clj", "custom/bodyn_after.clj", f)
+}
+
+func TestDefnLikeOverride(t *testing.T) {
+	f := func(p *Printer) {
+		p.DefnLikeOverrides = map[string]bool{"defn-": true, "defcommand": true}
+	}
+	testChangeCustom(t, "custom/defnlike_before.clj", "custom/defnlike_after.clj", f)
+}
+
+func TestBodyIndentPrefixes(t *testing.T) {
+	f := func(p *Printer) {
+		p.BodyIndentPrefixes = []string{"fixture-"}
+		p.IndentOverrides = map[string]IndentStyle{"fixture-table": IndentList}
+	}
+	testChangeCustom(t, "custom/bodyprefix_before.clj", "custom/bodyprefix_after.clj", f)
+}
+
+func TestIndentArityBodies(t *testing.T) {
+	f := func(p *Printer) {
+		p.IndentArityBodies = true
+	}
+	testChangeCustom(t, "custom/aritybody_before.clj", "custom/aritybody_after.clj", f)
+	// By default, arity bodies are aligned with the arglists.
+	testChange(t, "custom/aritybody_before.clj", "custom/aritybody_before.clj")
+}
+
+func TestFormatOffUnusedRequires(t *testing.T) {
+	const src = `(ns a
+  (:require [b.core :as b]
+            [c.core :as c]))
+
+;; cljfmt:off
+(def x (b/f  1))
+`
+	const want = `(ns a
+  (:require
+    [b.core :as b]))
+
+;; cljfmt:off
+(def x (b/f  1))
+`
+	got, err := Source("a.clj", []byte(src), 0, func(p *Printer) {
+		p.Transforms = map[Transform]bool{TransformRemoveUnusedRequires: true}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "a.clj", string(got), want)
+}
+
+func TestPreserveUnchanged(t *testing.T) {
+	const src = `(ns a
+    (:require [c.core :as c] [b.core :as b]))
+
+(defn f [x]
+      (let [y   1]
+           (+ x y)))   ; odd, but left alone
+
+
+(def m {:a 1,
+          :b 2})
+(defn g
+  [x] (inc x))
+`
+	const want = `(ns a
+  (:require
+    [b.core :as b]
+    [c.core :as c]))
+
+(defn f [x]
+      (let [y   1]
+           (+ x y))) ; odd, but left alone
+
+(def m {:a 1,
+          :b 2})
+(defn g [x]
+  (inc x))
+`
+	got, err := Source("a.clj", []byte(src), 0, func(p *Printer) {
+		p.PreserveUnchanged = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "a.clj", string(got), want)
+
+	// Without transforms, nothing changes at all (apart from the
+	// whitespace between top-level forms).
+	const unchanged = `(defn f [x]
+      (let [y   1]
+           (+ x y)))
+`
+	got, err = Source("a.clj", []byte(unchanged), 0, func(p *Printer) {
+		p.PreserveUnchanged = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "a.clj", string(got), unchanged)
+}
+
+func TestSourceMatchesPrintTree(t *testing.T) {
+	singles, changes := loadFixtures(t)
+	var names []string
+	for _, name := range singles {
+		names = append(names, name+".clj")
+	}
+	for _, name := range changes {
+		names = append(names, name+"_before.clj", name+"_after.clj")
+	}
+	for _, name := range names {
+		src := readFile(t, name)
+		got, err := Source(name, src, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.Src = src
+		if err := p.PrintTree(parseFile(t, name)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, buf.Bytes()) {
+			t.Errorf("%s: Source output differs from PrintTree output", name)
+		}
+	}
+}
+
+func BenchmarkSourceFormatted(b *testing.B) {
+	paths, err := filepath.Glob("testdata/*_after.clj")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 10; i++ {
+		for _, path := range paths {
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf.Write(src)
+			buf.WriteString("\n")
+		}
+	}
+	// Format the input once so that the benchmark measures the
+	// common case of a file that is already formatted.
+	src, err := Source("bench.clj", buf.Bytes(), 0, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	src = append([]byte(nil), src...)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Source("bench.clj", src, 0, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// indentedForm returns a form whose body is n indented lines.
+func indentedForm(t testing.TB, n int) parse.Node {
+	src := "(foo\n" + strings.Repeat("  [bar\n   baz]\n", n) + "  qux)"
+	tree, err := parse.Reader(strings.NewReader(src), "a.clj", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree.Roots[0]
+}
+
+func TestIndentAllocs(t *testing.T) {
+	// Writing indentation should not allocate, so printing a long form
+	// takes no more allocations than printing a short one.
+	allocs := func(n int) float64 {
+		node := indentedForm(t, n)
+		return testing.AllocsPerRun(10, func() {
+			p := NewPrinter(ioutil.Discard)
+			if err := p.PrintNode(node); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	short, long := allocs(10), allocs(1000)
+	if long > short {
+		t.Errorf("printing 1000 indented lines took %.0f allocs; want at most %.0f (as for 10 lines)", long, short)
+	}
+}
+
+func BenchmarkPrintIndented(b *testing.B) {
+	node := indentedForm(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := NewPrinter(ioutil.Discard)
+		if err := p.PrintNode(node); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPrintFlatCached(t *testing.T) {
+	// Each computed head, as in ((f x) y), is measured with printFlat.
+	// Measuring a head should reuse the renderings of the heads nested
+	// within it, so the work is linear in the depth.
+	allocs := func(depth int) float64 {
+		src := strings.Repeat("(", depth) + "f" + strings.Repeat(" x)", depth)
+		tree, err := parse.Reader(strings.NewReader(src), "a.clj", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return testing.AllocsPerRun(5, func() {
+			p := NewPrinter(ioutil.Discard)
+			if err := p.PrintNode(tree.Roots[0]); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	shallow, deep := allocs(10), allocs(20)
+	if deep > 4*shallow {
+		t.Errorf("printing a form nested 20 deep took %.0f allocs; want at most %.0f (4x as many as for 10)",
+			deep, 4*shallow)
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	const src = `(ns a)
+
+(defn f
+  "Docstring
+that continues."
+  [x]
+  (-> x
+    (cond-> (pos? x)
+            inc)
+    (let [y
+    1]
+      y)))`
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defn := tree.Roots[len(tree.Roots)-1]
+	got, err := NodeString(defn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `(defn f
+  "Docstring
+  that continues."
+  [x]
+  (-> x
+      (cond-> (pos? x)
+                inc)
+      (let [y
+              1]
+        y)))`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIsFormatted(t *testing.T) {
+	_, fixtures := loadFixtures(t)
+	for _, fixture := range fixtures {
+		for _, tc := range []struct {
+			suffix string
+			want   bool
+		}{
+			{"_before.clj", false},
+			{"_after.clj", true},
+		} {
+			name := fixture + tc.suffix
+			src := readFile(t, name)
+			got, err := IsFormatted(name, src, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("IsFormatted(%s): got %t; want %t", name, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestTrailingNewline(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"\n\n", ""},
+		{"(a)", "(a)\n"},
+		{"(a)\n", "(a)\n"},
+		{"(a)\n\n\n\n", "(a)\n"},
+		{"(a) ; b", "(a) ; b\n"},
+		{"(a)\n;; b\n\n", "(a)\n;; b\n"},
+	} {
+		tree, err := parse.Reader(strings.NewReader(tc.s), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := NewPrinter(&buf).PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("for %q: got %q; want %q", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestIndentWidth(t *testing.T) {
+	f := func(p *Printer) {
+		p.IndentChar = '\t'
+		p.IndentWidth = 2
+	}
+	testChangeCustom(t, "custom/tabs_before.clj", "custom/tabs_after.clj", f)
+}
+
+func TestTransformsWrapLongLines(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/wraplines_before.clj",
+		"custom/wraplines_after.clj",
+		map[Transform]bool{TransformWrapLongLines: true},
+	)
+}
+
+func TestTransformsBreakThreadChains(t *testing.T) {
+	transforms := map[Transform]bool{TransformBreakThreadChains: true}
+	testChangeTransforms(
+		t,
+		"custom/threadchains_before.clj",
+		"custom/threadchains_after.clj",
+		transforms,
+	)
+	// Check idempotency.
+	testChangeTransforms(
+		t,
+		"custom/threadchains_after.clj",
+		"custom/threadchains_after.clj",
+		transforms,
+	)
+}
+
+func TestTransformsAlignMapValues(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/alignmap_before.clj",
+		"custom/alignmap_after.clj",
+		map[Transform]bool{TransformAlignMapValues: true},
+	)
+}
+
+func TestTransformsRemoveRedundantDo(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/redundantdo_before.clj",
+		"custom/redundantdo_after.clj",
+		map[Transform]bool{TransformRemoveRedundantDo: true},
+	)
+}
+
+func TestTransformsFnLiteralToFn(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/fnliteral_before.clj",
+		"custom/fnliteral_after.clj",
+		map[Transform]bool{TransformFnLiteralToFn: true},
+	)
+}
+
+func TestTransformsThreadFirst(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/threadfirst_nested.clj",
+		"custom/threadfirst_threaded.clj",
+		map[Transform]bool{TransformIntroduceThreadFirst: true},
+	)
+	testChangeTransforms(
+		t,
+		"custom/threadfirst_threaded.clj",
+		"custom/threadfirst_nested.clj",
+		map[Transform]bool{TransformExpandThreadFirst: true},
+	)
+	testChangeTransforms(
+		t,
+		"custom/threadfirst_expand_before.clj",
+		"custom/threadfirst_expand_after.clj",
+		map[Transform]bool{TransformExpandThreadFirst: true},
+	)
+}
+
+func TestTransformsThreadFirstNotCalls(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/threadfirst_notcalls_before.clj",
+		"custom/threadfirst_notcalls_after.clj",
+		map[Transform]bool{TransformIntroduceThreadFirst: true},
+	)
+}
+
+func TestTransformsSortSetLiterals(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/sortset_before.clj",
+		"custom/sortset_after.clj",
+		map[Transform]bool{TransformSortSetLiterals: true},
+	)
+}
+
+func TestTransformsBlankLineBetweenTopLevel(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/toplevelblank_before.clj",
+		"custom/toplevelblank_after.clj",
+		map[Transform]bool{TransformBlankLineBetweenTopLevel: true},
+	)
+}
+
+func TestTransformsRemoveBindingBlankLines(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/bindingblank_before.clj",
+		"custom/bindingblank_after.clj",
+		map[Transform]bool{TransformRemoveBindingBlankLines: true},
+	)
+}
+
+func TestTransformsIfToWhen(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/iftowhen_before.clj",
+		"custom/iftowhen_after.clj",
+		map[Transform]bool{TransformIfToWhen: true},
+	)
+}
+
+func TestTransformsConsolidateRequires(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/consolidaterequires_before.clj",
+		"custom/consolidaterequires_after.clj",
+		map[Transform]bool{TransformConsolidateRequires: true},
+	)
+}
+
+func TestTransformsNormalizeCommentSpacing(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/commentspacing_before.clj",
+		"custom/commentspacing_after.clj",
+		map[Transform]bool{TransformNormalizeCommentSpacing: true},
+	)
+}
+
+func TestTransformsAlignTrailingComments(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/trailingcomments_before.clj",
+		"custom/trailingcomments_after.clj",
+		map[Transform]bool{TransformAlignTrailingComments: true},
+	)
+}
+
+func TestTransformsRemoveCommentForms(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/commentforms_before.clj",
+		"custom/commentforms_after.clj",
+		map[Transform]bool{TransformRemoveCommentForms: true},
+	)
+}
+
+func TestTransformsSplitRequires(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/splitrequires_before.clj",
+		"custom/splitrequires_after.clj",
+		map[Transform]bool{
+			TransformSortImportRequire: false,
+			TransformEnforceNSStyle:    false,
+			TransformSplitRequires:     true,
+		},
+	)
+}
+
+func TestTransformsCompactSingleRequire(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/compactrequire_before.clj",
+		"custom/compactrequire_after.clj",
+		map[Transform]bool{TransformCompactSingleRequire: true},
+	)
+}
+
+func TestTransformsNormalizeCharLiterals(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/charliterals_before.clj",
+		"custom/charliterals_after.clj",
+		map[Transform]bool{TransformNormalizeCharLiterals: true},
+	)
+}
+
+func TestCharLiteralsUnchanged(t *testing.T) {
+	// By default, character literals are written as they appear.
+	testChange(t, "custom/charliterals_before.clj", "custom/charliterals_before.clj")
+}
+
+func TestTransformsExpandRequirePrefixLists(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/prefixlists_before.clj",
+		"custom/prefixlists_after.clj",
+		map[Transform]bool{
+			TransformExpandRequirePrefixLists: true,
+			TransformSortImportRequire:        true,
+			TransformEnforceNSStyle:           true,
+		},
+	)
+}
+
+func TestTransformsNormalizeImports(t *testing.T) {
+	transforms := map[Transform]bool{TransformNormalizeImports: true}
+	testChangeTransforms(
+		t,
+		"custom/importsgrouped_before.clj",
+		"custom/importsgrouped_after.clj",
+		transforms,
+	)
+	testChangeCustom(
+		t,
+		"custom/importsindividual_before.clj",
+		"custom/importsindividual_after.clj",
+		func(p *Printer) {
+			p.Transforms = transforms
+			p.ImportStyle = ImportIndividual
+		},
+	)
+}
+
+func TestTransformsPreserveRequireGroups(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/requiregroups_before.clj",
+		"custom/requiregroups_after.clj",
+		map[Transform]bool{TransformPreserveRequireGroups: true},
+	)
+}
+
+func TestTransformsSortIgnoringCase(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/sortignoringcase_before.clj",
+		"custom/sortignoringcase_after.clj",
+		map[Transform]bool{TransformSortIgnoringCase: true},
+	)
+}
+
+func TestTransformsMergeMetadata(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/mergemeta_before.clj",
+		"custom/mergemeta_after.clj",
+		map[Transform]bool{TransformMergeMetadata: true},
+	)
+}
+
+func TestTransformsNormalizeDestructuring(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/destructuring_before.clj",
+		"custom/destructuring_after.clj",
+		map[Transform]bool{TransformNormalizeDestructuring: true},
+	)
+}
+
+func TestTransformsAlignAreTables(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"custom/aretables_before.clj",
+		"custom/aretables_after.clj",
+		map[Transform]bool{TransformAlignAreTables: true},
+	)
+}
+
+func TestMetadataUnchanged(t *testing.T) {
+	// By default, stacked metadata is written in its original order.
+	testChange(t, "custom/mergemeta_before.clj", "custom/mergemeta_before.clj")
+}
+
+func TestFnLiteralArgs(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		wantMax  int
+		wantPos  []int
+		wantRest bool
+	}{
+		{"#(foo)", 0, nil, false},
+		{"#(foo %)", 1, []int{1}, false},
+		{"#(foo % %1)", 1, []int{1}, false},
+		{"#(foo %2)", 2, []int{2}, false},
+		{"#(foo %3 [%1 {:a (bar %)}])", 3, []int{1, 3}, false},
+		{"#(foo %&)", 0, nil, true},
+		{"#(foo %2 %&)", 2, []int{2}, true},
+		{"#(foo %x %0 %+1 x%)", 0, nil, false},
+	} {
+		tree, err := parse.Reader(strings.NewReader(tc.s), "temp", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := fnLiteralArgs(tree.Roots[0])
+		var pos []int
+		for i := range args.positional {
+			pos = append(pos, i)
+		}
+		sort.Ints(pos)
+		if args.max != tc.wantMax || !reflect.DeepEqual(pos, tc.wantPos) || args.rest != tc.wantRest {
+			t.Errorf("fnLiteralArgs(%s): got max=%d, positional=%v, rest=%t; want %d, %v, %t",
+				tc.s, args.max, pos, args.rest, tc.wantMax, tc.wantPos, tc.wantRest)
+		}
+	}
+}
+
+func TestCommas(t *testing.T) {
+	const before = "custom/commas_before.clj"
+	const after = "custom/commas_after.clj"
+	for _, name := range []string{before, after} {
+		tree, err := parse.File(
+			filepath.Join("testdata", name),
+			parse.IncludeNonSemantic|parse.IncludeCommas,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := NewPrinter(&buf).PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		check(t, name, buf.String(), string(readFile(t, after)))
+	}
+}
+
+func TestLintRecur(t *testing.T) {
+	tree := parseFile(t, "lint/recur.clj")
+	var got []string
+	for _, w := range Lint(tree) {
+		got = append(got, w.String())
+	}
+	want := []string{
+		"testdata/lint/recur.clj:17:7: error: recur is not in tail position",
+		"testdata/lint/recur.clj:22:8: error: recur is not in tail position",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings\n%s\nwant\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLintOneArmedIfs(t *testing.T) {
+	tree := parseFile(t, "lint/ifs.clj")
+	var got []string
+	for _, w := range Lint(tree) {
+		got = append(got, w.String())
+	}
+	want := []string{
+		"testdata/lint/ifs.clj:2:3: info: if has no else branch; use when",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings\n%s\nwant\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLintDuplicates(t *testing.T) {
+	tree := parseFile(t, "lint/duplicates.clj")
+	var got []string
+	for _, w := range Lint(tree) {
+		got = append(got, w.String())
+	}
+	want := []string{
+		"testdata/lint/duplicates.clj:2:3: error: map literal has duplicate key :a",
+		"testdata/lint/duplicates.clj:19:9: error: set literal has duplicate element 1",
+		"testdata/lint/duplicates.clj:23:10: error: map literal has duplicate key :user/a",
+		"testdata/lint/duplicates.clj:24:5: error: map literal has duplicate key nil",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings\n%s\nwant\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for s, want := range map[string]string{
+		"{:a 1 :a 2}": "x:1:1: error: map literal has duplicate key :a",
+		"#{1 1}":      "x:1:1: error: set literal has duplicate element 1",
+	} {
+		tree, err := parse.Reader(strings.NewReader(s), "x", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warnings := Lint(tree)
+		if len(warnings) != 1 || warnings[0].String() != want {
+			t.Errorf("Lint(%s): got %v; want [%s]", s, warnings, want)
+		}
+	}
+}
+
+func TestLintNS(t *testing.T) {
+	tree := parseFile(t, "lint/ns.clj")
+	var got []string
+	for _, d := range Lint(tree) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"testdata/lint/ns.clj:3:13: warning: clojure.set is required but not used",
+		"testdata/lint/ns.clj:5:13: warning: foo.util is required with :refer :all",
+		"testdata/lint/ns.clj:6:38: warning: clojure.data is required but not used",
+		"testdata/lint/ns.clj:7:9: warning: foo.legacy is used without :only",
+		"testdata/lint/ns.clj:11:3: info: if has no else branch; use when",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics\n%s\nwant\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
 func testFixture(t *testing.T, filename string) {
 	testChange(t, filename, filename)
 }
@@ -155,6 +1053,7 @@ func testChangeCustom(t *testing.T, before, after string, f func(p *Printer)) {
 	tree := parseFile(t, before)
 	var buf bytes.Buffer
 	p := NewPrinter(&buf)
+	p.Src = readFile(t, before)
 	f(p)
 	if err := p.PrintTree(tree); err != nil {
 		t.Fatal(err)
@@ -262,3 +1161,51 @@ func loadFixturesOnce() error {
 	sort.Strings(changeFixtures)
 	return nil
 }
+
+func TestCommasTransforms(t *testing.T) {
+	// Commas don't count as forms when pairing up map entries.
+	testChangeCommas(
+		t,
+		"custom/commastransforms_before.clj",
+		"custom/commastransforms_after.clj",
+		map[Transform]bool{
+			TransformAlignMapValues: true,
+			TransformWrapLongLines:  true,
+		},
+	)
+}
+
+func TestCommasNSTransforms(t *testing.T) {
+	// Commas between the entries of reordered ns clauses are dropped.
+	testChangeCommas(
+		t,
+		"custom/commasns_before.clj",
+		"custom/commasns_after.clj",
+		map[Transform]bool{
+			TransformEnforceNSStyle:       true,
+			TransformSortImportRequire:    true,
+			TransformCompactSingleRequire: true,
+			TransformUseToRequire:         true,
+		},
+	)
+}
+
+// testChangeCommas is like testChangeTransforms, but it parses before with
+// IncludeCommas.
+func testChangeCommas(t *testing.T, before, after string, transforms map[Transform]bool) {
+	t.Helper()
+	tree, err := parse.File(
+		filepath.Join("testdata", before),
+		parse.IncludeNonSemantic|parse.IncludeCommas,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.Transforms = transforms
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	check(t, before, buf.String(), string(readFile(t, after)))
+}
@@ -0,0 +1,106 @@
+package format
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// An ImportStyle is a way of writing the classes in an :import clause,
+// used by TransformNormalizeImports.
+type ImportStyle int
+
+const (
+	// ImportGrouped lists the classes of each package together:
+	//
+	//   (:import (java.util List Map))
+	ImportGrouped ImportStyle = iota
+	// ImportIndividual gives each class by its fully-qualified name:
+	//
+	//   (:import java.util.List java.util.Map)
+	ImportIndividual
+)
+
+// normalizeImports rewrites each :import clause of ns in the given style,
+// with the packages and classes sorted and duplicates removed. Clauses
+// containing comments or anything other than class names and package
+// lists are left alone.
+func normalizeImports(ns parse.Node, style ImportStyle) {
+	for _, n := range ns.Children()[1:] {
+		if !goclj.FnFormKeyword(n, ":import") {
+			continue
+		}
+		packages, ok := parseImports(n.Children()[1:])
+		if !ok {
+			continue
+		}
+		pkgNames := make([]string, 0, len(packages))
+		for pkg := range packages {
+			pkgNames = append(pkgNames, pkg)
+		}
+		sort.Strings(pkgNames)
+		nodes := []parse.Node{n.Children()[0]}
+		for _, pkg := range pkgNames {
+			classes := sortStringSet(packages[pkg])
+			if style == ImportIndividual {
+				for _, class := range classes {
+					nodes = append(nodes, newline, &parse.SymbolNode{Val: pkg + "." + class})
+				}
+				continue
+			}
+			list := []parse.Node{&parse.SymbolNode{Val: pkg}}
+			for _, class := range classes {
+				list = append(list, &parse.SymbolNode{Val: class})
+			}
+			nodes = append(nodes, newline, &parse.ListNode{Nodes: list})
+		}
+		n.SetChildren(nodes)
+	}
+}
+
+// parseImports returns the classes named by the entries of an :import
+// clause, keyed by package. It returns false if the entries contain
+// comments or anything else that normalizeImports cannot rewrite.
+func parseImports(nodes []parse.Node) (map[string]map[string]struct{}, bool) {
+	packages := make(map[string]map[string]struct{})
+	add := func(pkg, class string) {
+		if packages[pkg] == nil {
+			packages[pkg] = make(map[string]struct{})
+		}
+		packages[pkg][class] = struct{}{}
+	}
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *parse.NewlineNode:
+		case *parse.SymbolNode:
+			i := strings.LastIndexByte(n.Val, '.')
+			if i < 0 {
+				// A class in the default package.
+				return nil, false
+			}
+			add(n.Val[:i], n.Val[i+1:])
+		case *parse.ListNode, *parse.VectorNode:
+			var syms []string
+			for _, child := range n.Children() {
+				switch child := child.(type) {
+				case *parse.NewlineNode:
+				case *parse.SymbolNode:
+					syms = append(syms, child.Val)
+				default:
+					return nil, false
+				}
+			}
+			if len(syms) < 2 {
+				return nil, false
+			}
+			for _, class := range syms[1:] {
+				add(syms[0], class)
+			}
+		default:
+			return nil, false
+		}
+	}
+	return packages, len(packages) > 0
+}
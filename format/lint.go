@@ -0,0 +1,386 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Severity says how serious the problem reported by a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityInfo is for code that works but could be written better.
+	SeverityInfo Severity = iota
+	// SeverityWarning is for code that is likely to cause problems.
+	SeverityWarning
+	// SeverityError is for code that Clojure will not accept.
+	SeverityError
+)
+
+var severityNames = map[Severity]string{
+	SeverityInfo:    "info",
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A Diagnostic is a likely problem found in the code by Lint.
+type Diagnostic struct {
+	Pos      *parse.Pos
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// Lint inspects t for likely problems and returns a Diagnostic for each
+// one, ordered by position. It does not modify t.
+//
+// The checks are heuristic and are designed to be conservative; that is, they
+// may miss real problems but should not flag correct code.
+func Lint(t *parse.Tree) []Diagnostic {
+	var diags []Diagnostic
+	syms := findSymbols(t.Roots)
+	for i, root := range t.Roots {
+		diags = append(diags, lintDuplicates(root)...)
+		if !annotationQuoted(t.Roots, i) {
+			diags = append(diags, lintRecur(root)...)
+			diags = append(diags, lintOneArmedIfs(root)...)
+		}
+		if goclj.FnFormSymbol(root, "ns") {
+			diags = append(diags, lintNS(root, syms)...)
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		pi, pj := diags[i].Pos, diags[j].Pos
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
+		}
+		return pi.Col < pj.Col
+	})
+	return diags
+}
+
+// tailBranchForms are forms in which more than one argument may be in tail
+// position. A recur that is not the last argument of one of these may still be
+// in tail position (for instance, the then-branch of an if) so lintRecur
+// doesn't consider them.
+var tailBranchForms = map[string]struct{}{
+	"case":    {},
+	"cond":    {},
+	"condp":   {},
+	"if":      {},
+	"if-let":  {},
+	"if-not":  {},
+	"if-some": {},
+}
+
+// lintRecur finds recur forms that are obviously not in tail position: those
+// that are followed by another argument in a list form which is not one of the
+// tailBranchForms.
+func lintRecur(n parse.Node) []Diagnostic {
+	var warnings []Diagnostic
+	switch n.(type) {
+	case *parse.QuoteNode, *parse.SyntaxQuoteNode:
+		// Quoted code may be manipulated by macros arbitrarily.
+		return nil
+	case *parse.ListNode:
+		if !lintableCall(n) {
+			break
+		}
+		var last parse.Node
+		skip := 0 // forms discarded by stacked #_s, as in #_ #_ a b
+		for _, child := range n.Children()[1:] {
+			if d, ok := child.(*parse.ReaderDiscardNode); ok {
+				for inner, ok := d.Node.(*parse.ReaderDiscardNode); ok; inner, ok = inner.Node.(*parse.ReaderDiscardNode) {
+					skip++
+				}
+				continue
+			}
+			if !goclj.Semantic(child) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+			} else {
+				last = child
+			}
+		}
+		for _, child := range n.Children()[1:] {
+			if child != last && goclj.FnFormSymbol(child, "recur") {
+				warnings = append(warnings, Diagnostic{
+					Pos:      child.Position(),
+					Severity: SeverityError,
+					Message:  "recur is not in tail position",
+				})
+			}
+		}
+	}
+	children := n.Children()
+	for i, child := range children {
+		if !annotationQuoted(children, i) {
+			warnings = append(warnings, lintRecur(child)...)
+		}
+	}
+	return warnings
+}
+
+// lintableCall reports whether n is a list form headed by a symbol that is not
+// one of the tailBranchForms.
+func lintableCall(n parse.Node) bool {
+	if !goclj.FnFormSymbol(n) {
+		return false
+	}
+	_, ok := tailBranchForms[n.Children()[0].(*parse.SymbolNode).Val]
+	return !ok
+}
+
+// lintDuplicates finds map literals with duplicate keys and set literals
+// with duplicate elements, which Clojure refuses to read. Only keys that
+// are literal values (keywords, strings, numbers, and so on) are compared.
+func lintDuplicates(n parse.Node) []Diagnostic {
+	var diags []Diagnostic
+	switch n := n.(type) {
+	case *parse.MapNode:
+		if forms, ok := literalForms(n.Nodes); ok {
+			for i := 0; i < len(forms); i += 2 {
+				forms[i/2] = forms[i]
+			}
+			keys := forms[:(len(forms)+1)/2]
+			if dup, ok := firstDuplicate(keys, n.Namespace); ok {
+				diags = append(diags, Diagnostic{
+					Pos:      n.Position(),
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("map literal has duplicate key %s", dup),
+				})
+			}
+		}
+	case *parse.SetNode:
+		if forms, ok := literalForms(n.Nodes); ok {
+			if dup, ok := firstDuplicate(forms, ""); ok {
+				diags = append(diags, Diagnostic{
+					Pos:      n.Position(),
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("set literal has duplicate element %s", dup),
+				})
+			}
+		}
+	}
+	for _, child := range n.Children() {
+		diags = append(diags, lintDuplicates(child)...)
+	}
+	return diags
+}
+
+// literalForms returns the forms of a map or set literal, skipping
+// discarded forms. Tagged forms and forms with metadata are given as nil
+// (they are never compared). It returns false if a reader conditional
+// makes the forms unknowable.
+func literalForms(nodes []parse.Node) ([]parse.Node, bool) {
+	var forms []parse.Node
+	skip := 0
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		switch n := n.(type) {
+		case *parse.ReaderCondNode, *parse.ReaderCondSpliceNode:
+			return nil, false
+		case *parse.ReaderDiscardNode:
+			skip += discardedSiblings(n)
+			continue
+		}
+		if !goclj.Semantic(n) && !isTagOrMetadata(n) {
+			continue
+		}
+		// A tag or metadata is part of the following form.
+		literal := true
+		for isTagOrMetadata(n) {
+			literal = false
+			i++
+			for i < len(nodes) && !goclj.Semantic(nodes[i]) && !isTagOrMetadata(nodes[i]) {
+				i++
+			}
+			if i == len(nodes) {
+				return forms, true
+			}
+			n = nodes[i]
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if !literal {
+			n = nil
+		}
+		forms = append(forms, n)
+	}
+	return forms, true
+}
+
+func isTagOrMetadata(n parse.Node) bool {
+	switch n.(type) {
+	case *parse.TagNode, *parse.MetadataNode:
+		return true
+	}
+	return false
+}
+
+// firstDuplicate returns the source text of the first form in forms that
+// is the same literal value as an earlier one. Keywords in a namespaced
+// map with namespace ns are qualified by it. Nil forms are ignored.
+func firstDuplicate(forms []parse.Node, ns string) (string, bool) {
+	seen := make(map[string]struct{})
+	for _, n := range forms {
+		key, text, ok := literalKey(n, ns)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			return text, true
+		}
+		seen[key] = struct{}{}
+	}
+	return "", false
+}
+
+// literalKey returns a string identifying the value of the literal n,
+// along with its source text. It returns false if n is not a literal.
+func literalKey(n parse.Node, ns string) (key, text string, ok bool) {
+	switch n := n.(type) {
+	case *parse.KeywordNode:
+		key = n.Val
+		if ns != "" && !strings.HasPrefix(key, "::") {
+			if strings.HasPrefix(key, ":_/") {
+				key = ":" + key[len(":_/"):]
+			} else if !strings.ContainsRune(key, '/') {
+				key = ns + "/" + key[1:]
+			}
+		}
+		return "keyword " + key, n.Val, true
+	case *parse.SymbolNode:
+		return "symbol " + n.Val, n.Val, true
+	case *parse.StringNode:
+		return "string " + n.Val, `"` + n.Val + `"`, true
+	case *parse.NumberNode:
+		return "number " + n.Val, n.Val, true
+	case *parse.CharacterNode:
+		return "char " + string(n.Val), n.Text, true
+	case *parse.BoolNode:
+		return fmt.Sprint(n.Val), fmt.Sprint(n.Val), true
+	case *parse.NilNode:
+		return "nil", "nil", true
+	}
+	return "", "", false
+}
+
+// lintOneArmedIfs finds if forms without an else branch, which could be
+// written as when (see TransformIfToWhen).
+func lintOneArmedIfs(n parse.Node) []Diagnostic {
+	var diags []Diagnostic
+	switch n.(type) {
+	case *parse.QuoteNode, *parse.SyntaxQuoteNode:
+		return nil
+	}
+	if goclj.FnFormSymbol(n, "if", "if-not", "if-let", "if-some") {
+		nodes := n.Children()
+		if arm0, arm1, _, _ := ifArms(nodes); arm0 > 0 && arm1 == 0 {
+			sym := nodes[0].(*parse.SymbolNode).Val
+			diags = append(diags, Diagnostic{
+				Pos:      n.Position(),
+				Severity: SeverityInfo,
+				Message:  fmt.Sprintf("%s has no else branch; use %s", sym, oneArmedIfs[sym]),
+			})
+		}
+	}
+	children := n.Children()
+	for i, child := range children {
+		if !annotationQuoted(children, i) {
+			diags = append(diags, lintOneArmedIfs(child)...)
+		}
+	}
+	return diags
+}
+
+// lintNS finds requires that appear to be unused (as judged by
+// TransformRemoveUnusedRequires), requires with :refer :all, and uses
+// that refer all of a namespace's vars.
+func lintNS(ns parse.Node, syms *symbolCache) []Diagnostic {
+	var diags []Diagnostic
+	for _, clause := range ns.Children()[1:] {
+		switch {
+		case goclj.FnFormKeyword(clause, ":require", ":require-macros"):
+			for _, n := range expandPrefixLists(clause.Children()[1:]) {
+				if name, ok := refersAll(n); ok {
+					diags = append(diags, Diagnostic{
+						Pos:      n.Position(),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("%s is required with :refer :all", name),
+					})
+					continue
+				}
+				r := parseRequire(n)
+				if r == nil {
+					continue
+				}
+				// As in removeUnusedRequires, [foo] may be
+				// needed for its side-effects.
+				if !isBareRequire(n) && syms.unused(r) {
+					diags = append(diags, Diagnostic{
+						Pos:      n.Position(),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("%s is required but not used", r.name),
+					})
+				}
+			}
+		case goclj.FnFormKeyword(clause, ":use"):
+			for _, n := range clause.Children()[1:] {
+				if r := parseUse(n); r != nil && r.referAll {
+					diags = append(diags, Diagnostic{
+						Pos:      n.Position(),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("%s is used without :only", r.name),
+					})
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// refersAll reports whether n is a require with :refer :all, such as
+// [foo.bar :refer :all], and returns the name of the namespace.
+func refersAll(n parse.Node) (string, bool) {
+	switch n.(type) {
+	case *parse.ListNode, *parse.VectorNode:
+	default:
+		return "", false
+	}
+	var semantic []parse.Node
+	for _, child := range n.Children() {
+		if goclj.Semantic(child) {
+			semantic = append(semantic, child)
+		}
+	}
+	if len(semantic) == 0 || !goclj.Symbol(semantic[0]) {
+		return "", false
+	}
+	for i := 1; i+1 < len(semantic); i++ {
+		kw, ok := semantic[i].(*parse.KeywordNode)
+		val, ok1 := semantic[i+1].(*parse.KeywordNode)
+		if ok && ok1 && kw.Val == ":refer" && val.Val == ":all" {
+			return semantic[0].(*parse.SymbolNode).Val, true
+		}
+	}
+	return "", false
+}
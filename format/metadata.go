@@ -0,0 +1,102 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+func mergeMetadataRec(n parse.Node) {
+	nodes := n.Children()
+	if merged, ok := mergeMetadata(nodes); ok {
+		n.SetChildren(merged)
+		nodes = merged
+	}
+	for _, child := range nodes {
+		mergeMetadataRec(child)
+	}
+}
+
+// mergeMetadata replaces each run of adjacent keyword and map metadata in
+// nodes, such as ^:a ^{:b 1}, with a single map, ^{:a true :b 1}. Runs
+// whose keys cannot all be compared, or which repeat a key, are left alone:
+// the reader lets the outer value win, but a merged map with a repeated key
+// would not read at all. It returns false if nothing was merged.
+func mergeMetadata(nodes []parse.Node) ([]parse.Node, bool) {
+	var result []parse.Node
+	changed := false
+	for i := 0; i < len(nodes); {
+		j := i
+		for j < len(nodes) {
+			if _, ok := nodes[j].(*parse.MetadataNode); !ok {
+				break
+			}
+			j++
+		}
+		if j-i < 2 {
+			result = append(result, nodes[i])
+			i++
+			continue
+		}
+		if m, ok := mergeMetadataRun(nodes[i:j]); ok {
+			result = append(result, m)
+			changed = true
+		} else {
+			result = append(result, nodes[i:j]...)
+		}
+		i = j
+	}
+	return result, changed
+}
+
+// mergeMetadataRun merges a run of metadata nodes into one, keeping the
+// keys in the order they were written.
+func mergeMetadataRun(run []parse.Node) (*parse.MetadataNode, bool) {
+	var entries []parse.Node
+	seen := make(map[string]struct{})
+	add := func(k, v parse.Node) bool {
+		key, _, ok := literalKey(k, "")
+		if !ok {
+			return false
+		}
+		if _, ok := seen[key]; ok {
+			return false
+		}
+		seen[key] = struct{}{}
+		entries = append(entries, k, v)
+		return true
+	}
+	for _, n := range run {
+		switch meta := n.(*parse.MetadataNode).Node.(type) {
+		case *parse.KeywordNode:
+			if !add(meta, &parse.BoolNode{Val: true}) {
+				return nil, false
+			}
+		case *parse.MapNode:
+			if meta.Namespace != "" {
+				return nil, false
+			}
+			children := meta.Children()
+			for _, child := range children {
+				if !goclj.Semantic(child) {
+					return nil, false
+				}
+			}
+			if len(children)%2 != 0 {
+				return nil, false
+			}
+			for k := 0; k < len(children); k += 2 {
+				if !add(children[k], children[k+1]) {
+					return nil, false
+				}
+			}
+		default:
+			// A type hint (^String) or some other form.
+			return nil, false
+		}
+	}
+	first := run[0].(*parse.MetadataNode)
+	return &parse.MetadataNode{
+		Pos:  first.Pos,
+		Node: &parse.MapNode{Pos: first.Pos, Nodes: entries},
+	}, true
+}
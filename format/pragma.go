@@ -0,0 +1,121 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// pragmaText returns the text of a comment such as ";; cljfmt:off" with the
+// leading semicolons and surrounding whitespace removed.
+func pragmaText(n parse.Node) string {
+	c, ok := n.(*parse.CommentNode)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimLeft(c.Text, ";"))
+}
+
+// protectVerbatim finds the top-level regions of roots that begin with a
+// ;; cljfmt:off comment and end just before the following ;; cljfmt:on
+// comment (or at the end of the file). The forms in each region are removed
+// from the returned roots; the cljfmt:off comment stays behind and is printed
+// as the original source text of the whole region, taken from p.Src.
+// The removed nodes are recorded in p.protected.
+func (p *Printer) protectVerbatim(roots []parse.Node) []parse.Node {
+	if p.Src == nil {
+		return roots
+	}
+	var result []parse.Node
+	for i := 0; i < len(roots); i++ {
+		result = append(result, roots[i])
+		if pragmaText(roots[i]) != "cljfmt:off" {
+			continue
+		}
+		off := roots[i].(*parse.CommentNode)
+		start := off.Position().Offset
+		if start < 0 || start > len(p.Src) ||
+			!bytes.HasPrefix(p.Src[start:], []byte(off.Text)) {
+			// The tree doesn't match p.Src.
+			continue
+		}
+		// The region ends with the last form or comment before the
+		// cljfmt:on comment. The newlines that follow it are formatted
+		// as usual.
+		j := i + 1
+		for j < len(roots) && pragmaText(roots[j]) != "cljfmt:on" {
+			j++
+		}
+		k := j - 1
+		for k > i && goclj.Newline(roots[k]) {
+			k--
+		}
+		end := len(p.Src)
+		if k+1 < len(roots) {
+			end = roots[k+1].Position().Offset
+		}
+		if end < start || end > len(p.Src) {
+			continue
+		}
+		p.verbatim[off] = trimSpan(p.Src[start:end])
+		p.protected = append(p.protected, roots[i+1:k+1]...)
+		i = k
+	}
+	return result
+}
+
+// An origRoot is a top-level node as it was before any transforms were
+// applied, along with its source text.
+type origRoot struct {
+	clone parse.Node
+	text  string
+}
+
+// snapshotRoots records the original form of each top-level node in roots
+// for PreserveUnchanged.
+func (p *Printer) snapshotRoots(roots []parse.Node) map[parse.Node]origRoot {
+	if !p.PreserveUnchanged || p.Src == nil {
+		return nil
+	}
+	orig := make(map[parse.Node]origRoot)
+	for i, root := range roots {
+		if goclj.Newline(root) {
+			continue
+		}
+		if _, ok := p.verbatim[root]; ok {
+			continue
+		}
+		start := root.Position().Offset
+		end := len(p.Src)
+		if i+1 < len(roots) {
+			end = roots[i+1].Position().Offset
+		}
+		if start < 0 || end < start || end > len(p.Src) {
+			continue
+		}
+		orig[root] = origRoot{clone: parse.Clone(root), text: trimSpan(p.Src[start:end])}
+	}
+	return orig
+}
+
+// preserveUnchanged arranges for each top-level node that is the same as
+// it was when snapshotRoots recorded orig to be printed as it was written.
+func (p *Printer) preserveUnchanged(roots []parse.Node, orig map[parse.Node]origRoot) {
+	for _, root := range roots {
+		o, ok := orig[root]
+		if !ok {
+			continue
+		}
+		if p.printScratch(root) == p.printScratch(o.clone) {
+			p.verbatim[root] = o.text
+		}
+	}
+}
+
+// trimSpan returns the source text b of a node (or region), without the
+// whitespace that separates it from what follows.
+func trimSpan(b []byte) string {
+	return strings.TrimRight(string(b), " \t\r,")
+}
@@ -2,6 +2,7 @@ package format
 
 import (
 	"sort"
+	"strings"
 
 	"github.com/cespare/goclj"
 	"github.com/cespare/goclj/parse"
@@ -15,7 +16,7 @@ func (p *Printer) markRequires(n parse.Node) {
 		if !goclj.FnFormKeyword(n, ":require", ":require-macros") {
 			continue
 		}
-		for _, n := range n.Children()[1:] {
+		for _, n := range expandPrefixLists(n.Children()[1:]) {
 			r := parseRequire(n)
 			if r == nil {
 				continue
@@ -23,6 +24,9 @@ func (p *Printer) markRequires(n parse.Node) {
 			for as := range r.as {
 				p.requires[as] = r.name
 			}
+			for as := range r.asAlias {
+				p.requires[as] = r.name
+			}
 			for _, ref := range []*referList{&r.refer, &r.referMacros} {
 				for _, n := range ref.origRefer {
 					if n, ok := n.(*parse.SymbolNode); ok {
@@ -61,6 +65,7 @@ func (rl *referList) merge(rl1 *referList) {
 	// list from the other.
 	if rl.origRefer == nil && rl.refer == nil {
 		rl.origRefer = rl1.origRefer
+		rl.dedupe()
 		return
 	}
 	// Otherwise, move everything into rl.refer (if not already moved by
@@ -91,6 +96,23 @@ func (rl *referList) render() *parse.VectorNode {
 	return &parse.VectorNode{Nodes: refs}
 }
 
+// dedupe removes any duplicate symbols from origRefer by moving them into
+// rl.refer. If there are no duplicates, origRefer is left alone.
+func (rl *referList) dedupe() {
+	seen := make(map[string]struct{})
+	for _, n := range rl.origRefer {
+		n, ok := n.(*parse.SymbolNode)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[n.Val]; ok {
+			rl.extractOrigRefer()
+			return
+		}
+		seen[n.Val] = struct{}{}
+	}
+}
+
 // extractOrigRefer moves all symbols in the origRefer slice
 // into rl.refer map.
 func (rl *referList) extractOrigRefer() {
@@ -104,8 +126,8 @@ func (rl *referList) extractOrigRefer() {
 }
 
 // removeUnused removes all symbols from this referList that aren't
-// present in sc.
-func (rl *referList) removeUnused(sc *symbolCache) {
+// present in sc (under the names given by rm).
+func (rl *referList) removeUnused(sc *symbolCache, rm *renameMap) {
 	if rl.origRefer != nil {
 		// If origRefer doesn't have any unused elements, leave it
 		// alone. Otherwise, rewrite it as a refer and handle below.
@@ -114,26 +136,104 @@ func (rl *referList) removeUnused(sc *symbolCache) {
 			if !ok {
 				continue
 			}
-			if !sc.usesSym(n.Val) {
+			if !sc.keepsRefer(rm.renamed(n.Val)) {
 				rl.extractOrigRefer()
 				break
 			}
 		}
 	}
 	for ref := range rl.refer {
-		if !sc.usesSym(ref) {
+		if !sc.keepsRefer(rm.renamed(ref)) {
 			delete(rl.refer, ref)
 		}
 	}
 }
 
+// renameMap represents the map following a :rename keyword.
+type renameMap struct {
+	// origRename is the original map. As with referList.origRefer, it is
+	// preserved and reused unless two rename maps are merged.
+	origRename *parse.MapNode
+	rename     map[string]string
+}
+
+func (rm *renameMap) merge(rm1 *renameMap) {
+	if rm1.origRename == nil {
+		return
+	}
+	if rm.origRename == nil && rm.rename == nil {
+		rm.origRename = rm1.origRename
+		return
+	}
+	if rm.origRename != nil {
+		rm.rename = renamePairs(rm.origRename)
+		rm.origRename = nil
+	}
+	for from, to := range renamePairs(rm1.origRename) {
+		rm.rename[from] = to
+	}
+}
+
+// renamed returns the name by which the referred symbol name is known.
+func (rm *renameMap) renamed(name string) string {
+	if rm.origRename != nil {
+		if to, ok := renamePairs(rm.origRename)[name]; ok {
+			return to
+		}
+		return name
+	}
+	if to, ok := rm.rename[name]; ok {
+		return to
+	}
+	return name
+}
+
+// render returns a parse.MapNode for the renames, or nil if there are none.
+func (rm *renameMap) render() *parse.MapNode {
+	if rm.origRename != nil {
+		return &parse.MapNode{Nodes: rm.origRename.Nodes}
+	}
+	if len(rm.rename) == 0 {
+		return nil
+	}
+	var from []string
+	for s := range rm.rename {
+		from = append(from, s)
+	}
+	sort.Strings(from)
+	var nodes []parse.Node
+	for _, s := range from {
+		nodes = append(nodes,
+			&parse.SymbolNode{Val: s},
+			&parse.SymbolNode{Val: rm.rename[s]})
+	}
+	return &parse.MapNode{Nodes: nodes}
+}
+
+// renamePairs returns the symbol pairs in the :rename map m.
+func renamePairs(m *parse.MapNode) map[string]string {
+	var syms []string
+	for _, n := range m.Nodes {
+		if n, ok := n.(*parse.SymbolNode); ok {
+			syms = append(syms, n.Val)
+		}
+	}
+	pairs := make(map[string]string)
+	for i := 0; i+1 < len(syms); i += 2 {
+		pairs[syms[i]] = syms[i+1]
+	}
+	return pairs
+}
+
 type require struct {
 	name     string
 	as       map[string]struct{}
+	asAlias  map[string]struct{}
 	referAll bool
 
 	refer       referList
 	referMacros referList
+	rename      renameMap
 
 	comments nodeComments
 }
@@ -179,6 +279,9 @@ type requireList struct {
 	m map[string]*require
 	// macros is true if this represents a :require-macros list.
 	macros bool
+	// strictUse is true if uses that refer all vars are to be left
+	// in extraUse rather than converted to :refer :all.
+	strictUse bool
 
 	// unrecognized semantic nodes
 	extraRequire []*nodeWithComments
@@ -194,6 +297,8 @@ func newRequireList() *requireList {
 func (rl *requireList) merge(r *require) *require {
 	r2, ok := rl.m[r.name]
 	if !ok {
+		r.refer.dedupe()
+		r.referMacros.dedupe()
 		rl.m[r.name] = r
 		return r
 	}
@@ -205,9 +310,18 @@ func (rl *requireList) merge(r *require) *require {
 			r2.as[s] = struct{}{}
 		}
 	}
+	if r.asAlias != nil {
+		if r2.asAlias == nil {
+			r2.asAlias = make(map[string]struct{})
+		}
+		for s := range r.asAlias {
+			r2.asAlias[s] = struct{}{}
+		}
+	}
 	r2.referAll = r.referAll || r2.referAll
 	r2.refer.merge(&r.refer)
 	r2.referMacros.merge(&r.referMacros)
+	r2.rename.merge(&r.rename)
 	return r2
 }
 
@@ -227,6 +341,8 @@ func (rl *requireList) parseRequireUse(nodes []parse.Node, use bool) {
 	case ":require-macros", ":use-macros":
 		rl.macros = true
 	}
+	// Prefix lists are left as they are (as unrecognized entries) unless
+	// TransformExpandRequirePrefixLists has already expanded them.
 	for _, node := range nodes[1:] {
 		switch node := node.(type) {
 		case *parse.CommentNode:
@@ -237,8 +353,10 @@ func (rl *requireList) parseRequireUse(nodes []parse.Node, use bool) {
 			}
 		case *parse.NewlineNode:
 			afterSemanticNode = false
+		case *parse.CommaNode:
+			// Dropped, since the entries are rendered again.
 		default:
-			if r := parseFn(node); r != nil {
+			if r := parseFn(node); r != nil && !(use && rl.strictUse && r.referAll) {
 				r2 := rl.merge(r)
 				prevComments = &r2.comments
 			} else {
@@ -286,6 +404,24 @@ func (rl *requireList) render() []parse.Node {
 				&parse.KeywordNode{Val: ":as"},
 				&parse.SymbolNode{Val: as[0]})
 		}
+		// Likewise for :as-alias.
+		asAlias := sortStringSet(r.asAlias)
+		for len(asAlias) > 1 {
+			n := &parse.VectorNode{
+				Nodes: []parse.Node{
+					&parse.SymbolNode{Val: r.name},
+					&parse.KeywordNode{Val: ":as-alias"},
+					&parse.SymbolNode{Val: asAlias[0]},
+				},
+			}
+			nodes = append(nodes, n, newline)
+			asAlias = asAlias[1:]
+		}
+		if len(asAlias) > 0 {
+			parts = append(parts,
+				&parse.KeywordNode{Val: ":as-alias"},
+				&parse.SymbolNode{Val: asAlias[0]})
+		}
 		if r.referAll {
 			parts = append(parts,
 				&parse.KeywordNode{Val: ":refer"},
@@ -298,6 +434,9 @@ func (rl *requireList) render() []parse.Node {
 				parts = append(parts, &parse.KeywordNode{Val: ":refer-macros"}, n)
 			}
 		}
+		if n := r.rename.render(); n != nil {
+			parts = append(parts, &parse.KeywordNode{Val: ":rename"}, n)
+		}
 		nodes = append(nodes, &parse.VectorNode{Nodes: parts})
 		if r.comments.commentBeside != nil {
 			nodes = append(nodes, r.comments.commentBeside)
@@ -325,6 +464,7 @@ func (rl *requireList) render() []parse.Node {
 	if len(rl.extraUse) > 0 {
 		extra := []parse.Node{
 			&parse.KeywordNode{Val: ":use"},
+			newline,
 		}
 		for _, n := range rl.extraUse {
 			for _, c := range n.comments.commentsAbove {
@@ -353,6 +493,105 @@ func sortStringSet(set map[string]struct{}) []string {
 	return ss
 }
 
+// expandPrefixLists returns nodes (the entries of a :require clause) with
+// each prefix list replaced by the requires it stands for, so that
+//
+//	[clojure [string :as s] set]
+//
+// becomes [clojure.string :as s] and clojure.set. The comments and
+// newlines inside a prefix list are kept between the expanded requires.
+func expandPrefixLists(nodes []parse.Node) []parse.Node {
+	var expanded []parse.Node
+	for _, n := range nodes {
+		if libs, ok := expandPrefixList(n); ok {
+			expanded = append(expanded, libs...)
+		} else {
+			expanded = append(expanded, n)
+		}
+	}
+	return expanded
+}
+
+// expandPrefixList expands n if it is a prefix list (see
+// expandPrefixLists). As in Clojure, the names inside a prefix list may
+// not contain periods.
+func expandPrefixList(n parse.Node) ([]parse.Node, bool) {
+	switch n.(type) {
+	case *parse.ListNode, *parse.VectorNode:
+	default:
+		return nil, false
+	}
+	var (
+		prefix   *parse.SymbolNode
+		expanded []parse.Node
+	)
+	for _, child := range n.Children() {
+		if !goclj.Semantic(child) {
+			if prefix != nil {
+				expanded = append(expanded, child)
+			}
+			continue
+		}
+		if prefix == nil {
+			sym, ok := child.(*parse.SymbolNode)
+			if !ok {
+				return nil, false
+			}
+			prefix = sym
+			continue
+		}
+		lib, ok := prefixedLib(prefix.Val, child)
+		if !ok {
+			return nil, false
+		}
+		expanded = append(expanded, lib)
+	}
+	if prefix == nil || countSemantic(expanded) == 0 {
+		return nil, false
+	}
+	// Leading newlines (before the first lib) are dropped.
+	for len(expanded) > 0 && goclj.Newline(expanded[0]) {
+		expanded = expanded[1:]
+	}
+	return expanded, true
+}
+
+// prefixedLib returns the lib spec n (an element of a prefix list) with
+// its name qualified by prefix.
+func prefixedLib(prefix string, n parse.Node) (parse.Node, bool) {
+	qualify := func(n parse.Node) (*parse.SymbolNode, bool) {
+		sym, ok := n.(*parse.SymbolNode)
+		if !ok || strings.ContainsRune(sym.Val, '.') || strings.ContainsRune(sym.Val, '/') {
+			return nil, false
+		}
+		return &parse.SymbolNode{Pos: sym.Pos, Val: prefix + "." + sym.Val}, true
+	}
+	if sym, ok := qualify(n); ok {
+		return sym, true
+	}
+	var nodes []parse.Node
+	switch n := n.(type) {
+	case *parse.ListNode:
+		nodes = n.Nodes
+	case *parse.VectorNode:
+		nodes = n.Nodes
+	default:
+		return nil, false
+	}
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	name, ok := qualify(nodes[0])
+	if !ok {
+		return nil, false
+	}
+	nodes = append([]parse.Node{name}, nodes[1:]...)
+	if l, ok := n.(*parse.ListNode); ok {
+		return &parse.ListNode{Pos: l.Pos, Nodes: nodes}, true
+	}
+	return &parse.VectorNode{Pos: n.Position(), Nodes: nodes}, true
+}
+
 func parseRequire(n parse.Node) *require {
 	switch n := n.(type) {
 	case *parse.SymbolNode:
@@ -375,9 +614,10 @@ func parseRequireSeq(nodes []parse.Node) *require {
 		return nil
 	}
 	r := newRequire(semNodes[0].(*parse.SymbolNode).Val)
-	var as string
+	var as, asAlias string
 	var refer []parse.Node
 	var referMacros []parse.Node
+	var rename *parse.MapNode
 	if (len(semNodes)-1)%2 != 0 {
 		return nil
 	}
@@ -392,12 +632,16 @@ func parseRequireSeq(nodes []parse.Node) *require {
 		//   (require '[a :as b :as c])
 		// then only the last one takes effect.
 		switch kw.Val {
-		case ":as":
+		case ":as", ":as-alias":
 			vs, ok := v.(*parse.SymbolNode)
 			if !ok {
 				return nil
 			}
-			as = vs.Val
+			if kw.Val == ":as" {
+				as = vs.Val
+			} else {
+				asAlias = vs.Val
+			}
 		case ":refer", ":refer-macros":
 			if kw.Val == ":refer" {
 				refer = v.Children()
@@ -417,6 +661,12 @@ func parseRequireSeq(nodes []parse.Node) *require {
 			default:
 				return nil
 			}
+		case ":rename":
+			m, ok := parseRename(v)
+			if !ok {
+				return nil
+			}
+			rename = m
 		default:
 			return nil
 		}
@@ -424,11 +674,30 @@ func parseRequireSeq(nodes []parse.Node) *require {
 	if as != "" {
 		r.as = map[string]struct{}{as: {}}
 	}
+	if asAlias != "" {
+		r.asAlias = map[string]struct{}{asAlias: {}}
+	}
 	r.refer.origRefer = refer
 	r.referMacros.origRefer = referMacros
+	r.rename.origRename = rename
 	return r
 }
 
+// parseRename checks that n, the value following :rename, is a map of
+// symbols.
+func parseRename(n parse.Node) (*parse.MapNode, bool) {
+	m, ok := n.(*parse.MapNode)
+	if !ok || m.Namespace != "" {
+		return nil, false
+	}
+	for _, n := range m.Nodes {
+		if goclj.Semantic(n) && !goclj.Symbol(n) {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
 func parseUse(n parse.Node) *require {
 	switch n := n.(type) {
 	case *parse.SymbolNode:
@@ -447,28 +716,35 @@ func parseUseSeq(nodes []parse.Node) *require {
 		return nil
 	}
 	r := newRequire(nodes[0].(*parse.SymbolNode).Val)
-	switch len(nodes) {
-	case 1:
+	if len(nodes) == 1 {
 		r.referAll = true
-	case 3:
-		kw, ok := nodes[1].(*parse.KeywordNode)
+		return r
+	}
+	if (len(nodes)-1)%2 != 0 {
+		return nil
+	}
+	var as, only bool
+	for i := 1; i < len(nodes); i += 2 {
+		kw, ok := nodes[i].(*parse.KeywordNode)
 		if !ok {
 			return nil
 		}
+		v := nodes[i+1]
 		switch kw.Val {
 		case ":as":
-			n, ok := nodes[2].(*parse.SymbolNode)
+			n, ok := v.(*parse.SymbolNode)
 			if !ok {
 				return nil
 			}
 			r.as = map[string]struct{}{n.Val: {}}
+			as = true
 		case ":only":
-			switch nodes[2].(type) {
+			switch v.(type) {
 			case *parse.ListNode, *parse.VectorNode:
 			default:
 				return nil
 			}
-			r.refer.origRefer = nodes[2].Children()
+			r.refer.origRefer = v.Children()
 			for _, n := range r.refer.origRefer {
 				switch n.(type) {
 				case *parse.SymbolNode,
@@ -478,11 +754,26 @@ func parseUseSeq(nodes []parse.Node) *require {
 					return nil
 				}
 			}
+			only = true
+		case ":rename":
+			m, ok := parseRename(v)
+			if !ok {
+				return nil
+			}
+			r.rename.origRename = m
 		default:
 			return nil
 		}
-	default:
-		return nil
+	}
+	if as {
+		// :as can't be combined with the other options.
+		if len(nodes) != 3 {
+			return nil
+		}
+		return r
+	}
+	if !only {
+		r.referAll = true
 	}
 	return r
 }
@@ -0,0 +1,155 @@
+package format
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+func sortSetsRec(n parse.Node) {
+	if set, ok := n.(*parse.SetNode); ok {
+		sortSet(set)
+	}
+	for _, child := range n.Children() {
+		sortSetsRec(child)
+	}
+}
+
+// sortSet sorts the elements of set if they are all simple literals.
+// If the set has no comments, the elements are permuted in place so that the
+// newlines stay where they were. Otherwise, the elements are written one per
+// line along with their comments, as in a sorted :require.
+func sortSet(set *parse.SetNode) {
+	var (
+		nodes             = set.Children()
+		items             []*importRequire
+		lineComments      []*parse.CommentNode
+		initialNewline    = false
+		afterSemanticNode = false
+		hasComments       = false
+	)
+	for i, node := range nodes {
+		switch node := node.(type) {
+		case *parse.CommentNode:
+			hasComments = true
+			if afterSemanticNode {
+				items[len(items)-1].commentBeside = node
+			} else {
+				lineComments = append(lineComments, node)
+			}
+		case *parse.NewlineNode:
+			if i == 0 {
+				initialNewline = true
+			}
+			afterSemanticNode = false
+		default:
+			if _, ok := getSetElemKey(node); !ok {
+				return
+			}
+			items = append(items, &importRequire{
+				commentsAbove: lineComments,
+				node:          node,
+			})
+			lineComments = nil
+			afterSemanticNode = true
+		}
+	}
+	sorted := make(setElemList, len(items))
+	copy(sorted, items)
+	sort.Stable(sorted)
+	changed := false
+	for i := range items {
+		if sorted[i] != items[i] {
+			changed = true
+		}
+		if i > 0 && !sorted.Less(i-1, i) {
+			// Equal elements: probably a duplicate, which Clojure
+			// won't read anyway.
+			return
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if !hasComments {
+		var j int
+		for i, node := range nodes {
+			if goclj.Semantic(node) {
+				nodes[i] = sorted[j].node
+				j++
+			}
+		}
+		set.SetChildren(nodes)
+		return
+	}
+
+	var newNodes []parse.Node
+	if initialNewline {
+		newNodes = append(newNodes, newline)
+	}
+	for _, item := range sorted {
+		for _, cn := range item.commentsAbove {
+			newNodes = append(newNodes, cn, newline)
+		}
+		newNodes = append(newNodes, item.node)
+		if item.commentBeside != nil {
+			newNodes = append(newNodes, item.commentBeside)
+		}
+		newNodes = append(newNodes, newline)
+	}
+	for _, cn := range lineComments {
+		newNodes = append(newNodes, cn, newline)
+	}
+	// drop trailing newline
+	if len(newNodes) >= 2 && !goclj.Comment(newNodes[len(newNodes)-2]) {
+		newNodes = newNodes[:len(newNodes)-1]
+	}
+	set.SetChildren(newNodes)
+}
+
+// A setElemKey orders set elements first by kind (numbers, then strings,
+// keywords, and symbols) and then by value.
+type setElemKey struct {
+	kind int
+	num  float64
+	val  string
+}
+
+func getSetElemKey(n parse.Node) (setElemKey, bool) {
+	switch n := n.(type) {
+	case *parse.NumberNode:
+		f, err := strconv.ParseFloat(n.Val, 64)
+		if err != nil {
+			// Ratios, bigints, hex, and so on.
+			return setElemKey{}, false
+		}
+		return setElemKey{kind: 0, num: f}, true
+	case *parse.StringNode:
+		return setElemKey{kind: 1, val: n.Val}, true
+	case *parse.KeywordNode:
+		return setElemKey{kind: 2, val: n.Val}, true
+	case *parse.SymbolNode:
+		return setElemKey{kind: 3, val: n.Val}, true
+	}
+	return setElemKey{}, false
+}
+
+type setElemList []*importRequire
+
+func (l setElemList) Len() int      { return len(l) }
+func (l setElemList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l setElemList) Less(i, j int) bool {
+	k0, _ := getSetElemKey(l[i].node)
+	k1, _ := getSetElemKey(l[j].node)
+	if k0.kind != k1.kind {
+		return k0.kind < k1.kind
+	}
+	if k0.kind == 0 {
+		return k0.num < k1.num
+	}
+	return k0.val < k1.val
+}
@@ -0,0 +1,88 @@
+package format
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// Source parses the Clojure code src and returns it formatted. The name is
+// used in error messages. The code is parsed with opts (plus
+// parse.IncludeNonSemantic, which formatting requires). If configure is not
+// nil, it is called to adjust the settings of the Printer before printing.
+// Unlike PrintTree on its own, Source sets the Printer's Src, so the
+// cljfmt:off pragma is honored. If src is already formatted, the result
+// is src itself rather than a copy.
+func Source(name string, src []byte, opts parse.ParseOpts, configure func(p *Printer)) ([]byte, error) {
+	w := &compareWriter{src: src}
+	if err := Fprint(w, name, src, opts, configure); err != nil {
+		return nil, err
+	}
+	return w.bytes(), nil
+}
+
+// Fprint is like Source, but it writes the formatted code to w.
+func Fprint(w io.Writer, name string, src []byte, opts parse.ParseOpts, configure func(p *Printer)) error {
+	t, err := parse.Reader(bytes.NewReader(src), name, opts|parse.IncludeNonSemantic)
+	if err != nil {
+		return err
+	}
+	p := NewPrinter(w)
+	p.Src = src
+	if configure != nil {
+		configure(p)
+	}
+	return p.PrintTree(t)
+}
+
+// A compareWriter collects the output of formatting src. Most files are
+// already formatted, so rather than copying the output, it compares it
+// against src and only starts a copy of its own at the first difference.
+type compareWriter struct {
+	src []byte
+	// n is the length of the prefix of src that matches the output
+	// so far.
+	n int
+	// out holds the output once it has diverged from src.
+	out []byte
+}
+
+func (w *compareWriter) Write(b []byte) (int, error) {
+	if w.out != nil {
+		w.out = append(w.out, b...)
+		return len(b), nil
+	}
+	rest := w.src[w.n:]
+	i := 0
+	for i < len(b) && i < len(rest) && b[i] == rest[i] {
+		i++
+	}
+	if i == len(b) {
+		w.n += i
+		return len(b), nil
+	}
+	w.out = make([]byte, 0, len(w.src)+len(b))
+	w.out = append(w.out, w.src[:w.n+i]...)
+	w.out = append(w.out, b[i:]...)
+	return len(b), nil
+}
+
+// bytes returns the output. If it matches (a prefix of) src, it shares
+// src's memory.
+func (w *compareWriter) bytes() []byte {
+	if w.out != nil {
+		return w.out
+	}
+	return w.src[:w.n:w.n]
+}
+
+// IsFormatted reports whether src is unchanged by formatting it with Source
+// (using the same arguments).
+func IsFormatted(name string, src []byte, opts parse.ParseOpts, configure func(p *Printer)) (bool, error) {
+	formatted, err := Source(name, src, opts, configure)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(src, formatted), nil
+}
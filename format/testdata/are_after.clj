@@ -0,0 +1,27 @@
+(ns foo.parse-test
+  (:require
+    [clojure.test :refer [are deftest is testing]]
+    [foo.parse :as parse]))
+
+(deftest parse-test
+  (testing "numbers"
+    (are [input expected] (= expected (parse/parse input))
+      "1" 1
+      "-1" -1
+      "1.5" 1.5))
+  (testing "collections"
+    (are [input expected] (= expected (parse/parse input))
+      "()" '() "(1 2)" '(1 2)
+      "[1 [2]]" [1 [2]]
+      "{:a 1}" {:a 1}))
+  (testing "errors"
+    (are [input msg]
+      (thrown-with-msg? Exception msg (parse/parse input))
+      "(" #"unbalanced"
+      ; A lone closing delimiter.
+      ")" #"unexpected"))
+  (are [x] (pos? x) 1 2 3)
+  (are [a b sum] (= sum (+ a b))
+    1 2 3
+    10 20 30
+    (- 1) (- 2) (- 3)))
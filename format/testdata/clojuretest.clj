@@ -0,0 +1,29 @@
+(ns foo.core-test
+  (:require
+    [clojure.test :refer [deftest is testing use-fixtures]]
+    [foo.core :as core]))
+
+(use-fixtures :each (fn [f] (core/reset!) (f)))
+
+(deftest parse-test
+  (testing "empty input"
+    (is (nil? (core/parse ""))))
+  (testing "a single number"
+    (is (= 1 (core/parse "1")))
+    (is (= -1 (core/parse "-1"))
+        "negative numbers are supported"))
+  (testing "nested"
+    (testing "lists"
+      (is (= '(1 2) (core/parse "(1 2)"))))
+    (testing "vectors" (is (= [1 2] (core/parse "[1 2]"))))))
+
+(deftest ^:integration round-trip-test
+  (doseq [s ["1" "(1 2)" "[1 2]"]]
+    (testing (str "round-tripping " s)
+      (is (= s (core/unparse (core/parse s)))))))
+
+(deftest thrown-test
+  (is (thrown? IllegalArgumentException
+               (core/parse "(")))
+  (is (thrown-with-msg? IllegalArgumentException #"unbalanced"
+                        (core/parse "("))))
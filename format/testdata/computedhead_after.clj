@@ -0,0 +1,21 @@
+((partial + 1) 2
+               3)
+
+((partial + 1)
+  2
+  3)
+
+((comp inc dec) x
+                y)
+
+(#(+ % %2) 1
+           2)
+
+((fn [x y]
+   (+ x y)) 1
+ 2)
+
+((fn [x y]
+   (+ x y))
+ 1
+ 2)
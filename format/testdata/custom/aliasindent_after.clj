@@ -0,0 +1,21 @@
+(ns app.core
+  (:require
+    [clojure.core.async :as async :refer [alt! go-loop]]))
+
+(async/go-loop [x 1
+                y 2]
+  (recur x y))
+
+(go-loop [x 1
+          y 2]
+  (recur x y))
+
+(async/alt! a
+              ([v] v)
+            b
+              ([v] (inc v)))
+
+(alt! a
+        ([v] v)
+      b
+        ([v] (inc v)))
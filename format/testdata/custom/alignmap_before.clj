@@ -0,0 +1,30 @@
+(def m
+  {:a 1
+   :bbb 2
+   ;; A comment.
+   :cc "three" ; another comment
+   "dddd" {:x 1 :yy 2}})
+
+(def one-line {:a 1 :bbb 2})
+
+(def ns-map
+  #:foo{:a 1
+        :bbb 2})
+
+(def multi-line-value
+  {:a 1
+   :bbb (fn [x]
+          (inc x))})
+
+(def pairs-on-same-line
+  {:a 1 :bbb 2
+   :cc 3})
+
+(def nested
+  {:a {:x 1
+       :yyy 2}
+   :bbb 3})
+
+(def non-ascii
+  {:é 1
+   :ab 2})
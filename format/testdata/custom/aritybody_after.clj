@@ -0,0 +1,26 @@
+(defn connect
+  "Connects to the database."
+  ([]
+    (connect "localhost"))
+  ([host]
+    (connect host 5432))
+  ([host port]
+    (let [conn (open host port)]
+      (init! conn)
+      conn)))
+
+(defn ^:private parse-int
+  ([s] (parse-int s 10))
+  ([s radix]
+    (Integer/parseInt s radix)))
+
+(def f
+  (fn
+    ([x]
+      (f x 1))
+    ([x y]
+      (+ x y))))
+
+(defn single [x]
+  ([x]
+   x))
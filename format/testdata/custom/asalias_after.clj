@@ -0,0 +1,10 @@
+(ns a
+  (:require
+    [b.core :as b]
+    [m.spec :as ms :as-alias ma]
+    [q.spec :as-alias q1]
+    [q.spec :as-alias q2]
+    [z.spec :as-alias zs]))
+
+{::zs/id 1 ::ma/x 2 ::q1/a 3 ::q2/b 4}
+(b/foo (ms/bar))
@@ -0,0 +1,12 @@
+(ns a
+  (:require
+    [z.spec :as-alias zs]
+    [b.core :as b]
+    [unused.spec :as-alias us]
+    [m.spec :as ms]
+    [m.spec :as-alias ma]
+    [q.spec :as-alias q1]
+    [q.spec :as-alias q2]))
+
+{::zs/id 1 ::ma/x 2 ::q1/a 3 ::q2/b 4}
+(b/foo (ms/bar))
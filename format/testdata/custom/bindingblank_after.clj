@@ -0,0 +1,26 @@
+(defn handle [req]
+  (let [user (:user req)
+        ;; Look up the account.
+        account (find-account user)
+        balance (:balance account)]
+
+    (when (pos? balance)
+
+      (charge account))))
+
+(defn totals [orders]
+  (for [order orders
+        :let [items (:items order)
+              total (reduce + (map :price items))]
+        :when (pos? total)]
+    total))
+
+(loop [i 0
+       acc []]
+  (if (< i 10)
+    (recur (inc i) (conj acc i))
+    acc))
+
+(def v [1
+
+        2])
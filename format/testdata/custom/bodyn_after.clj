@@ -0,0 +1,21 @@
+(with-redefs-fn {#'foo (constantly 1)}
+  (fn []
+    (is (= 1 (foo)))))
+
+(defroute :get "/users/:id"
+  [req]
+  (respond (lookup (:id req))))
+
+(defroute :post
+          "/users"
+  [req]
+  (create req))
+
+(defroute
+  :delete "/users/:id" [req]
+  (delete req))
+
+(-> app
+    (defroute "/x"
+      [req]
+      req))
@@ -0,0 +1,15 @@
+(fixture-setup db
+  (create-tables db)
+  (load-rows db))
+
+(db/fixture-teardown db
+  (drop-tables db))
+
+(fixture-table :users
+               [:id :name])
+
+(fixtures-load db
+               (load-rows db))
+
+(with-db db
+  (query db))
@@ -0,0 +1,3 @@
+(def chars [\a \A \A \é \é \ÿ \space \space \tab \tab
+            \newline \newline \formfeed \formfeed \backspace \backspace \return \return
+            \u0000 \u200b \( \\ \;])
@@ -0,0 +1,3 @@
+(def chars [\a \u0041 \o101 \u00e9 \é \o377 \space \u0020 \tab \u0009
+            \u000a \newline \o014 \formfeed \u0008 \backspace \u000D \return
+            \u0000 \u200b \( \\ \;])
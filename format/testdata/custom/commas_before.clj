@@ -0,0 +1,5 @@
+(def m {:a 1, :b 2,
+        :c 3 ,:d 4})
+(def v [1,2,,3])
+(foo, bar
+  baz)
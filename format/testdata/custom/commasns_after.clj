@@ -0,0 +1,12 @@
+(ns foo
+  (:require
+    [a.b :as b]
+    [b.c :as c]
+    [d.e :refer :all]
+    [f.g :refer [h]])
+  (:import
+    (java.io File)
+    (java.util Map)))
+
+(ns bar
+  (:require [a]))
@@ -0,0 +1,7 @@
+(ns foo
+  (:require [b.c :as c], [a.b :as b])
+  (:use [d.e], [f.g :only [h]])
+  (:import [java.util Map], [java.io File]))
+
+(ns bar
+  (:require, [a]))
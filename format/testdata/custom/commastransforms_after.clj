@@ -0,0 +1,13 @@
+(def m {:a   1,
+        :bbb 2,
+        :cc  3})
+
+(def config
+  {:host     "localhost",
+   :port     5432,
+   :user     "admin",
+   :password "correct horse battery"})
+
+(some-function-name (compute-something x),
+                    (compute-something-else y),
+                    zzzzzzzzzz)
@@ -0,0 +1,30 @@
+(ns app.core)
+
+(defn f
+  [x]
+  (inc x))
+
+(defn g [x]
+  (let [y (inc x)]
+    y))
+
+(def v [1 3])
+
+(def s #{:a
+         :c})
+
+(def m {:a (comment 1)})
+
+((comment) 1)
+
+(let [a (comment "unused")
+      b 2]
+  (for [x xs
+        :let [y (comment)
+              z x]]
+    (+ a b x y z)))
+
+(letfn [(comment [x] x)]
+  (map comment xs))
+
+(def data '(1 (comment 2) 3))
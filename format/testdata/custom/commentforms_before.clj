@@ -0,0 +1,41 @@
+(ns app.core)
+
+(comment
+  (start-server)
+  (stop-server))
+
+(defn f
+  [x]
+  (comment (f 1))
+  (inc x))
+
+(defn g [x]
+  (let [y (inc x)]
+    (comment
+      (g 1))
+    y)
+  (comment "trailing"))
+
+(def v [1 (comment 2) 3])
+
+(def s #{:a
+         (comment :b)
+         :c})
+
+(def m {:a (comment 1)})
+
+((comment) 1)
+
+(comment "last")
+
+(let [a (comment "unused")
+      b 2]
+  (for [x xs
+        :let [y (comment)
+              z x]]
+    (+ a b x y z)))
+
+(letfn [(comment [x] x)]
+  (map comment xs))
+
+(def data '(1 (comment 2) 3))
@@ -0,0 +1,13 @@
+#!/usr/bin/env bb
+;;;;;;;;;;;;;;;;;;;;;;;;;
+;;;;  Banner
+;;;Section header
+(ns example.core)
+
+;;Adds one.
+(defn f [x]
+  ;   the argument
+  (inc x)) ;inline comment
+
+;;
+(def y 1) ; already fine
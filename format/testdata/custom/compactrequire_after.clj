@@ -0,0 +1,15 @@
+(ns app.core
+  (:require [clojure.string :as str])
+  (:require-macros [app.macros :as m])
+  (:import
+    (java.io File)))
+
+(ns app.two
+  (:require
+    [a.core :as a]
+    [b.core :as b]))
+
+(ns app.commented
+  (:require
+    ;; Only for str/join.
+    [clojure.string :as str]))
@@ -0,0 +1,14 @@
+(ns app.core
+  (:require
+    [clojure.string :as str])
+  (:require-macros [app.macros :as m])
+  (:import
+    java.io.File))
+
+(ns app.two
+  (:require [b.core :as b] [a.core :as a]))
+
+(ns app.commented
+  (:require
+    ;; Only for str/join.
+    [clojure.string :as str]))
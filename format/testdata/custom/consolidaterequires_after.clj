@@ -0,0 +1,12 @@
+(ns example.core
+  (:require
+    [clojure.set :as set :refer [difference union]]
+    [clojure.string :as str]
+    [clojure.walk :refer [postwalk]])
+  (:import
+    (java.util Date))
+  ;; more requires
+  (:require-macros
+    [cljs.core.async.macros :refer [alt! go]]))
+
+(str/join (union (set/difference #{} #{}) (postwalk identity #{})))
@@ -0,0 +1,12 @@
+(ns example.core
+  (:require [clojure.string :as str]
+            [clojure.set :refer [union]])
+  (:import (java.util Date))
+  ;; more requires
+  (:require [clojure.set :as set :refer [difference]]
+            [clojure.walk :refer [postwalk]]
+            [clojure.string :as str])
+  (:require-macros [cljs.core.async.macros :refer [go]])
+  (:require-macros [cljs.core.async.macros :refer [alt!]]))
+
+(str/join (union (set/difference #{} #{}) (postwalk identity #{})))
@@ -0,0 +1,11 @@
+(defcommand deploy
+  [env] (run-deploy env))
+
+(defn- helper
+  [x] (inc x))
+
+(defn foo
+  [x] (bar x))
+
+(defmacro unless
+  [test & body] `(when-not ~test ~@body))
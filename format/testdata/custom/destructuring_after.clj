@@ -0,0 +1,40 @@
+(defn connect
+  "Opens a connection."
+  [{:keys [host port]
+    :or   {port 5432}
+    :as   opts}]
+  (open host port opts))
+
+(defn handler [{:keys [uri]} {::keys [user]
+                              :strs  [token]
+                              :as    ctx}]
+  (handle uri user token ctx))
+
+(defn area
+  ([shape] (area shape 1))
+  ([{:keys [w h]
+     :or {w 1
+          h 1}} scale]
+   (* w h scale)))
+
+(fn [{:keys [a
+             b]
+      :as m}]
+  (+ a b))
+
+(let [{:keys [a b]
+       :or   {a 1}
+       :as   x} (f)
+      [{:syms [c]
+        d     :d}] (g)]
+  [a b c d x])
+
+(let [{:keys [a b] :as x} (f)]
+  [a b x])
+
+(let [{:keys [a] ; the a
+       :as x} (f)]
+  [a x])
+
+(def m {:keys [1 2]
+        :as 3})
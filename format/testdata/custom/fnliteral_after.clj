@@ -0,0 +1,10 @@
+(map (fn [x] (inc x)) xs)
+(map (fn [x1 x2] (assoc x1 :x x2)) xs ys)
+(map (fn [x1 _ x3] (foo x3 x1)) xs ys zs)
+(map (fn [x & more] (apply + x more)) xs)
+(map (fn [arg] (str "x" x arg)) xs)
+(fn [] (println "hi"))
+(let [f (fn [x1 x2] (vector x1 [x2 {:a x1}]))]
+  f)
+'#(+ % 1)
+(defmacro m [] `(map #(inc %) ~'xs))
@@ -0,0 +1,10 @@
+(map #(inc %) xs)
+(map #(assoc % :x %2) xs ys)
+(map #(foo %3 %1) xs ys zs)
+(map #(apply + % %&) xs)
+(map #(str "x" x %) xs)
+#(println "hi")
+(let [f #(vector % [%2 {:a %}])]
+  f)
+'#(+ % 1)
+(defmacro m [] `(map #(inc %) ~'xs))
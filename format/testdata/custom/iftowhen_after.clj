@@ -0,0 +1,22 @@
+(defn f [xs]
+  (when (seq xs)
+    (println xs))
+  (when-not (empty? xs) ; check first
+    ;; print them
+    (println "non-empty"))
+  (when-let [x (first xs)] (println x))
+  (if (seq xs)
+    (println xs)
+    (println "empty"))
+  (if-not done?
+    (recur)
+    ;; finished
+    nil))
+
+'(if a b)
+
+(defmacro unless [c x] `(if (not ~c) ~x))
+
+'^:x (if a b)
+
+(defmacro tagged [c x] `^{:tag Object} (if ~c ~x))
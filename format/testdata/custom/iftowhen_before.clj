@@ -0,0 +1,22 @@
+(defn f [xs]
+  (if (seq xs)
+    (println xs))
+  (if-not (empty? xs) ; check first
+    ;; print them
+    (println "non-empty"))
+  (if-let [x (first xs)] (println x))
+  (if (seq xs)
+    (println xs)
+    (println "empty"))
+  (if-not done?
+    (recur)
+    ;; finished
+    nil))
+
+'(if a b)
+
+(defmacro unless [c x] `(if (not ~c) ~x))
+
+'^:x (if a b)
+
+(defmacro tagged [c x] `^{:tag Object} (if ~c ~x))
@@ -0,0 +1,11 @@
+(ns foo.core
+  (:import
+    (java.io File Reader)
+    (java.time Instant)
+    (java.util ArrayList List Map)))
+
+(ns foo.other
+  (:import
+    (java.io File)
+    ; kept as written
+    (java.util Map)))
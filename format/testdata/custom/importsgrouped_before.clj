@@ -0,0 +1,12 @@
+(ns foo.core
+  (:import java.util.Map
+           (java.io File Reader)
+           [java.util List ArrayList]
+           java.util.Map
+           (java.time Instant)))
+
+(ns foo.other
+  (:import
+    ; kept as written
+    java.util.Map
+    (java.io File)))
@@ -0,0 +1,8 @@
+(ns foo.core
+  (:import
+    java.io.File
+    java.io.Reader
+    java.time.Instant
+    java.util.ArrayList
+    java.util.List
+    java.util.Map))
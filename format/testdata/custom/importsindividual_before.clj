@@ -0,0 +1,5 @@
+(ns foo.core
+  (:import (java.util Map List)
+           [java.io Reader File]
+           java.time.Instant
+           (java.util ArrayList Map)))
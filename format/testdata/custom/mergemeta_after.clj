@@ -0,0 +1,19 @@
+(ns foo.meta)
+
+(def ^{:private true :dynamic true :doc "The current user."} *user* nil)
+
+^{:a true :b true}
+(defn f [^{:x true :y true} v] v)
+
+(defn g
+  [^String ^:nonempty s]
+  s)
+
+(def ^:a ^{:a false} x 1)
+
+(def ^:a
+  ^:b y 2)
+
+(def ^{:a 1 :b 2 :c [1 2]} z 3)
+
+(def ^:only-one w 4)
@@ -0,0 +1,6 @@
+(ns a
+  (:require
+    [a :refer [x y]]
+    [b :refer [p q]]
+    [c :refer-macros [m]]
+    [d :refer [r s]]))
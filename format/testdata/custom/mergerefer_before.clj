@@ -0,0 +1,9 @@
+(ns a
+  (:require
+    [a :refer [x]]
+    [a :refer [x y]]
+    [b :refer [p q p]]
+    [c :refer-macros [m]]
+    [c :refer-macros [m]]
+    [d :refer [r]])
+  (:use [d :only [r s]]))
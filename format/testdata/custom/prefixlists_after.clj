@@ -0,0 +1,10 @@
+(ns foo.core
+  (:require
+    [bar.baz :as baz]
+    [clojure.set] ; core libs
+    [clojure.string :as str]
+    [clojure.walk :as walk]
+    [foo.db :as db]
+    ; the web layer
+    [foo.web :refer [handler]]
+    [not-a-prefix-list :as x]))
@@ -0,0 +1,8 @@
+(ns foo.core
+  (:require [clojure.walk :as walk]
+            [clojure [string :as str] set] ; core libs
+            (foo [db :as db]
+                 ; the web layer
+                 [web :refer [handler]])
+            [bar.baz :as baz]
+            [not-a-prefix-list :as x]))
@@ -0,0 +1,46 @@
+(when x
+  (println "a")
+  (println "b"))
+
+(when-not x a b)
+
+(let [x 1]
+  (println x)
+  x)
+
+(defn foo
+  "Docstring."
+  [x]
+  (println x)
+  x)
+
+(defn bar
+  ([x] (bar x 1))
+  ([x y]
+   (println x) y))
+
+(fn named [x] x)
+
+(defrecord R [a]
+  P
+  (m [this] (println a) a))
+
+; These are not redundant.
+(if x (do a b) c)
+(when x (do a b) c)
+(for [x xs] (do (println x) x))
+(when x ^:foo (do a b))
+(let [y (do a b)] y)
+
+(defn checked [x]
+  (do {:pre [(pos? x)]}
+      (inc x)))
+
+(fn
+  ([] (do {:a 1} 2))
+  ([x] (f x) {:a x}))
+
+; Quoted forms are data.
+'(when x (do a b))
+
+(defmacro m [x] `(let [y ~x] (do (f y) y)))
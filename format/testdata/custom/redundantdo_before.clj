@@ -0,0 +1,47 @@
+(when x
+  (do (println "a")
+      (println "b")))
+
+(when-not x (do a b))
+
+(let [x 1]
+  (do
+    (println x)
+    x))
+
+(defn foo
+  "Docstring."
+  [x]
+  (do (println x)
+      x))
+
+(defn bar
+  ([x] (do (bar x 1)))
+  ([x y]
+   (do (do (println x) y))))
+
+(fn named [x] (do x))
+
+(defrecord R [a]
+  P
+  (m [this] (do (println a) a)))
+
+; These are not redundant.
+(if x (do a b) c)
+(when x (do a b) c)
+(for [x xs] (do (println x) x))
+(when x ^:foo (do a b))
+(let [y (do a b)] y)
+
+(defn checked [x]
+  (do {:pre [(pos? x)]}
+      (inc x)))
+
+(fn
+  ([] (do {:a 1} 2))
+  ([x] (do (f x) {:a x})))
+
+; Quoted forms are data.
+'(when x (do a b))
+
+(defmacro m [x] `(let [y ~x] (do (f y) y)))
@@ -0,0 +1,9 @@
+(ns a
+  (:require
+    [b.core :as b]
+    [m.core :refer [w x y] :rename {w mw x mx y my}]
+    [u.core :refer [f] :rename {f uf}]
+    [v.core :refer :all :rename {g vg}]
+    [z.core :refer [join] :rename {join zjoin}]))
+
+(zjoin (b/foo) mx my mw (uf) (vg))
@@ -0,0 +1,12 @@
+(ns a
+  (:require
+    [z.core :refer [join] :rename {join zjoin}]
+    [b.core :as b]
+    [n.core :refer [q] :rename {q nq}]
+    [m.core :refer [x y] :rename {x mx, y my}]
+    [m.core :refer [w] :rename {w mw}])
+  (:use
+    [u.core :only [f] :rename {f uf}]
+    [v.core :rename {g vg}]))
+
+(zjoin (b/foo) mx my mw (uf) (vg))
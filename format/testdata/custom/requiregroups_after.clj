@@ -0,0 +1,17 @@
+(ns foo.core
+  (:require
+    [my.app.core :as core]
+    [my.app.db :as db]
+
+    ; third-party
+    [buddy.core :as buddy]
+    [cheshire.core :as json]
+    [clj-time.core :as time]
+
+    [clojure.set :as set]
+    [clojure.string :as str])
+  (:import
+    (java.util UUID)
+
+    (clojure.lang IFn)
+    (java.io File)))
@@ -0,0 +1,16 @@
+(ns foo.core
+  (:require [my.app.db :as db]
+            [my.app.core :as core]
+
+            ; third-party
+            [buddy.core :as buddy]
+            [clj-time.core :as time]
+            [cheshire.core :as json]
+
+
+            [clojure.string :as str]
+            [clojure.set :as set])
+  (:import java.util.UUID
+
+           java.io.File
+           clojure.lang.IFn))
@@ -0,0 +1,12 @@
+(ns foo.core
+  (:require
+    [alpha.core :as alpha]
+    [foo.bar :as bar]
+    [Foo.Quux :as quux]
+    [foo.quux :as quux2]
+    [foo-baz.core :as baz]
+    [Zeta.core :as zeta])
+  (:import
+    (Acme.widgets Widget)
+    (java.util Map)
+    (javax.swing JFrame)))
@@ -0,0 +1,10 @@
+(ns foo.core
+  (:require [Zeta.core :as zeta]
+            [alpha.core :as alpha]
+            [foo-baz.core :as baz]
+            [foo.bar :as bar]
+            [Foo.Quux :as quux]
+            [foo.quux :as quux2])
+  (:import (javax.swing JFrame)
+           (Acme.widgets Widget)
+           (java.util Map)))
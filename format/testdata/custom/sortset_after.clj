@@ -0,0 +1,21 @@
+(def flags #{:debug :quiet :verbose})
+
+(def multiline
+  #{:alpha :beta
+    :gamma
+    :zeta})
+
+(def mixed #{1.5 2 10 "b" :a c})
+
+(def commented
+  #{:debug ; rarely used
+    :quiet
+    ;; Most common.
+    :verbose})
+
+(def calls #{:b (keyword "a")})
+
+(def dups #{1 1.0})
+
+(def nested {:opts #{'b 'a}
+             :ks #{:c :d}})
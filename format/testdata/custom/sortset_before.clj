@@ -0,0 +1,21 @@
+(def flags #{:verbose :debug :quiet})
+
+(def multiline
+  #{:zeta :alpha
+    :gamma
+    :beta})
+
+(def mixed #{c "b" :a 10 2 1.5})
+
+(def commented
+  #{;; Most common.
+    :verbose
+    :debug ; rarely used
+    :quiet})
+
+(def calls #{:b (keyword "a")})
+
+(def dups #{1 1.0})
+
+(def nested {:opts #{'b 'a}
+             :ks #{:d :c}})
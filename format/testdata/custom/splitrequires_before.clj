@@ -0,0 +1,11 @@
+(ns app.core
+  (:require [b.core :as b] [a.core :as a] [c.core :refer [x]])
+  (:require-macros [m.macros :as m] [l.macros :as l])
+  (:import (java.util Map List) java.io.File)
+  (:use [z.core]))
+
+(ns app.other
+  (:require
+    [b.core :as b] ; needed for b/f
+    ;; a comes second
+    [a.core :as a]))
@@ -0,0 +1,13 @@
+(ns a.b
+  (:require
+    [clojure.string :as str]))
+
+(defn foo
+  "Docstring
+  second line."
+  [x]
+  (let [y
+          (inc x)]
+    (str/join ","
+              [x
+               y])))
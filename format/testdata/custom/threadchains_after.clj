@@ -0,0 +1,22 @@
+(-> x (assoc :a 1) (dissoc :b))
+(-> x
+    (assoc :a 1)
+    (dissoc :b)
+    (update :c inc)
+    (merge m))
+(->> xs
+     (map inc)
+     (filter odd?)
+     (take 5)
+     (reduce +))
+(some-> m
+        :a
+        (get :b) ; comment
+        (update :c inc)
+        #inst "2020-01-01")
+(let [y (-> x
+            a
+            b
+            c
+            d)]
+  y)
@@ -0,0 +1,7 @@
+(g (f x a))
+
+(if t (f x a) x)
+
+(cond-> (g x) t (f a))
+
+(h (g (f x)))
@@ -0,0 +1,9 @@
+(-> x
+    (f a)
+    g)
+
+(cond-> x t (f a))
+
+(cond-> (g x) t (f a))
+
+(-> x (-> f g) h)
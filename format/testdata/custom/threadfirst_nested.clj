@@ -0,0 +1,23 @@
+(defn f
+  [m]
+  (assoc (update (:a m) :b inc) :c 1))
+
+(str (name (:k m)))
+
+(g (f x a) b)
+
+(if (pos? n)
+  (first xs)
+  (second xs))
+
+(let [y (h (g (f x)) 1)]
+  (count y))
+
+(some-> x f g)
+
+(foo (bar) y)
+
+; Quoted forms are data, not calls.
+'(g (f x 1) 2)
+
+`(-> x (f 1) (g ~y))
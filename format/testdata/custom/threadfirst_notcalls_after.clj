@@ -0,0 +1,9 @@
+(ns foo (:import
+          (java.util List)) (:require
+                              [clojure [string :as s]]))
+
+(letfn [(f (g x))] (f 1))
+
+(case x (a (b c)) (-> y f g) 0)
+
+(:k (f x))
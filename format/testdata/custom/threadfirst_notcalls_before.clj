@@ -0,0 +1,7 @@
+(ns foo (:import (java.util List)) (:require (clojure [string :as s])))
+
+(letfn [(f (g x))] (f 1))
+
+(case x (a (b c)) (g (f y)) 0)
+
+(:k (f x))
@@ -0,0 +1,23 @@
+(defn f
+  [m]
+  (-> (:a m) (update :b inc) (assoc :c 1)))
+
+(-> (:k m) name str)
+
+(-> x (f a) (g b))
+
+(if (pos? n)
+  (first xs)
+  (second xs))
+
+(let [y (-> x f g (h 1))]
+  (count y))
+
+(some-> x f g)
+
+(foo (bar) y)
+
+; Quoted forms are data, not calls.
+'(g (f x 1) 2)
+
+`(-> x (f 1) (g ~y))
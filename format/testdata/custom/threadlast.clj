@@ -0,0 +1,7 @@
+(-?>> a
+      b
+      (cond-> x
+        "1"
+          (foo 1)
+        "2"
+          (foo 2)))
@@ -0,0 +1,11 @@
+;; -> is configured as a thread-last macro, so the steps are indented as
+;; written rather than with the threaded value as their first argument.
+(-> a
+    (cond-> x
+              "1" (foo 1)))
+
+(-?>> a
+      b
+      (cond-> x
+                "1"
+          (foo 1)))
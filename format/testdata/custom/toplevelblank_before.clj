@@ -0,0 +1,23 @@
+;; Header comment.
+;; More header.
+(ns a)
+(def x 1) (def y 2)
+
+
+
+(def z 3) ; about z
+(defn f
+  [x]
+
+  (inc x))
+;; Attached to g.
+(defn g [] 1)
+
+;; A separate comment.
+
+;; Attached to h.
+^:private
+(defn h [] 2)
+#_(defn unused [])
+(def last 4)
+;; Trailing comment.
@@ -0,0 +1,18 @@
+(def width 80) ; columns
+(def height 24) ; rows
+(def depth 8) ; bits per pixel
+
+(def title "Hello") ; shown in the title bar
+(def x 1)
+(def y 2) ; not aligned with anything
+
+(defn draw
+  [screen]
+  (let [w (:width screen) ; pixels
+        h (:height screen) ; pixels
+        bg :black] ; the background color
+    (fill screen
+          {:x 0 ; left
+           :y 0 ; top
+           :color bg}) ; fill everything
+    (render screen))) ; done
@@ -0,0 +1,7 @@
+(ns a
+  (:refer-clojure :exclude [update get])
+  (:require
+    [medley.core :refer [update map-vals]]
+    [my.lookup :refer [get]]))
+
+(map-vals inc {:a 1})
@@ -0,0 +1,8 @@
+(ns a
+  (:refer-clojure :exclude [update get])
+  (:require
+    [medley.core :refer [update map-vals]]
+    [my.lookup :refer [get]]
+    [clojure.string :refer [join]]))
+
+(map-vals inc {:a 1})
@@ -0,0 +1,13 @@
+(ns a
+  (:require
+    [foo.bar]
+    [foo.baz]
+    [foo.qux]
+    [foo.side-effects ; loaded for its defmethods
+     ]
+    [foo.zap]))
+
+(foo.bar/baz 1)
+(foo.qux/baz 2)
+(foo.baz/x)
+(foo.zap/y)
@@ -0,0 +1,15 @@
+(ns a
+  (:require
+    [foo.bar]
+    [foo.side-effects ; loaded for its defmethods
+     ]
+    foo.qux
+    [foo.baz :as fb]
+    [foo.zap :refer [zz]]
+    foo.unused
+    [foo.gone :as g]))
+
+(foo.bar/baz 1)
+(foo.qux/baz 2)
+(foo.baz/x)
+(foo.zap/y)
@@ -0,0 +1,26 @@
+(ns foo.macros
+  (:require
+    [clojure.set :as set]
+    [clojure.string :refer [blank?]]
+    [foo.gensym :refer [gen#]]
+    [foo.log :as log]))
+
+(defmacro with-logging
+  [& body]
+  `(let [start# (System/nanoTime)
+         result# (do ~@body)]
+     (log/info "took" (- (System/nanoTime) start#))
+     (when-not (blank? (str result#))
+       ~(set/union #{} #{}))
+     result#))
+
+(defmacro spy
+  [x]
+  `(let [x# ~x]
+     (println '~x x#)
+     x#))
+
+(defmacro with-gen
+  []
+  `(let [x# ~^:x (gen#)]
+     x#))
@@ -0,0 +1,10 @@
+(ns a
+  (:require
+    [b.c :as c]
+    [f.g :refer [h i]] ; only
+    [j.k :as k])
+  (:use
+    ; bare uses stay put
+    d.e
+    (l.m)
+    [n.o :rename {p q}]))
@@ -0,0 +1,10 @@
+(ns a
+  (:require
+    [b.c :as c])
+  (:use
+    ; bare uses stay put
+    d.e
+    [f.g :only [h i]] ; only
+    [j.k :as k]
+    (l.m)
+    [n.o :rename {p q}]))
@@ -0,0 +1,38 @@
+(def config
+  {:host "localhost"
+   :port 8080
+   :username "admin"
+   :password "hunter2"
+   :timeout 30})
+
+(defn handler [request]
+  (respond-with-status (compute-response-body request)
+                       (compute-response-headers request)
+                       200))
+
+(defn short-enough [x]
+  (+ x 1))
+
+(cond
+  (some-long-predicate? x) (do-the-first-thing x)
+  (another-long-predicate? x) (do-the-other-thing x))
+
+(defn now []
+  #?(:clj (System/currentTimeMillis)
+     :cljs (.getTime (js/Date.))
+     :default (throw (ex-info "unsupported" {}))))
+
+(ns example.core
+  (:require
+    #?@(:clj [[clojure.java.io :as io] [clojure.edn :as edn]]
+        :cljs [[cljs.reader :as edn]])))
+
+(deftest parse-test
+  (testing "a label that is kept on the testing line"
+    (is (= 1 (parse "1")))
+    (is (= 2 (parse "2")))))
+
+(are [input expected] (= expected (parse input))
+  "1" 1
+  "(1 2)" '(1 2)
+  "[1 2 3]" [1 2 3])
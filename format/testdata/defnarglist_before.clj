@@ -0,0 +1,18 @@
+(defn log
+  [level & args] (apply println level args))
+
+(defn merge-opts
+  [{:keys [a b] :as opts} & {:keys [overrides]}] (merge opts overrides))
+
+(defn greet
+  ([] (greet "world"))
+  ([name & more] (apply println "Hello," name more)))
+
+(defn area
+  ([{:keys [w h]}] (* w h))
+  ([w h & _]
+   (* w h)))
+
+(defn apply-all
+  [f & xs]
+  (map f xs))
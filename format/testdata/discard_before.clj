@@ -0,0 +1,43 @@
+(def config
+  {:a 1
+   #_
+   {:b 2
+    :c 3}
+   :d 4})
+
+#_
+{:x 1
+ :y 2}
+
+(foo #_ #_ a b c)
+
+(foo #_
+     bar baz)
+
+#_ #_ (a)
+(b)
+
+(let [x 1
+      #_ #_ y 2
+      z 3]
+  x)
+
+(cond
+  (pos? x) :pos
+  #_(zero? x) #_:zero
+  :else :neg)
+
+(foo #_ ; disabled for now
+ bar baz)
+
+(let [a 1
+      #_ ; not yet
+      b #_ ; c
+      2]
+  a)
+
+(f '#_a ; c
+ b)
+
+(g @ ; c
+   b)
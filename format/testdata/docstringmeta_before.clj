@@ -0,0 +1,30 @@
+(defn ^:private foo
+  "Private
+doc."
+  [x]
+  x)
+
+(defn ^{:added "1.0" :deprecated "1.2"} bar
+  "Added in
+1.0."
+  [x]
+  x)
+
+(defn ^:private ^:dynamic baz
+  "Two pieces of
+metadata."
+  [])
+
+(def ^{:added "1.0"} qux
+  "A var
+with metadata."
+  1)
+
+(defn quux
+  ^{:author "someone"} "Metadata on
+the docstring."
+  [x]
+  x)
+
+(def ^:private s ^:tag "not
+a docstring")
@@ -0,0 +1,12 @@
+(defn   foo   "Does a thing.
+              More detail,
+                indented further.
+              Last line."
+  [x]
+  x)
+
+(defn bar
+      "Three lines,
+      reindented along with
+        the form."
+  [])
@@ -0,0 +1,35 @@
+(defn foo
+  "Adds numbers.
+With one argument, adds one.
+    (foo 1) => 2"
+  ([x] (foo x 1))
+  ([x y] (+ x y)))
+
+(defn- bar
+  "Private
+doc."
+  [x]
+  x)
+
+(defn ^:private baz
+  "Meta
+doc."
+  [x]
+  x)
+
+(defprotocol Shape
+  "A shape
+protocol."
+  (area [this]
+    "Computes
+the area.")
+  (scale [this k] [this kx ky]
+    "Scales
+the shape.")
+  (label [this] (str "not
+a docstring")))
+
+(defn- not-a-docstring
+  [x]
+  "this
+is the return value")
@@ -0,0 +1,24 @@
+(ns app.grid
+  (:require
+    [app.cells :as cells]
+    [clojure.string :as str]))
+
+(def x
+  1)
+
+;; cljfmt:off
+(def identity-matrix
+  [[1 0 0]
+   [0 1 0]
+   [0 0 1]])
+
+(def opcodes {:add   0x01   :sub 0x02
+              :mul   0x03   :div 0x04})
+;; cljfmt:on
+
+(def y
+  2)
+
+;;cljfmt:off
+(def table   [ :a   :b
+               :c   :d ])   ; aligned by hand
@@ -0,0 +1,16 @@
+(ns example.Widget
+  (:require
+    [clojure.string :as str])
+  (:gen-class
+    :name example.Widget
+    :extends javax.swing.JPanel
+    :implements [java.awt.event.ActionListener]
+    :state state
+    :init init
+    :constructors {[String] []}
+    :methods [[setLabel [String] void]
+              [getLabel [] String]]
+    :main false))
+
+(defn -init [label]
+  [[] (atom (str/trim label))])
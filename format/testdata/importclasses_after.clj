@@ -0,0 +1,9 @@
+(ns example.core
+  (:import
+    (java.io File
+             Reader Writer)
+    (java.time Duration
+               Instant ; UTC timestamps
+               ;; dates
+               LocalDate)
+    (java.util ArrayList HashMap List Map)))
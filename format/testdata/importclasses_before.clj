@@ -0,0 +1,8 @@
+(ns example.core
+  (:import (java.util Map List ArrayList HashMap)
+           [java.io Writer
+                    Reader File]
+           (java.time Instant ; UTC timestamps
+                      Duration
+                      ;; dates
+                      LocalDate)))
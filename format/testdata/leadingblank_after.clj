@@ -0,0 +1,3 @@
+(ns a)
+
+(def x 1)
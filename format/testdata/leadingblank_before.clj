@@ -0,0 +1,9 @@
+
+
+
+
+(ns a)
+
+
+
+(def x 1)
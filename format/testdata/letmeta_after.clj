@@ -0,0 +1,32 @@
+(let [^String a (foo)
+      b ^:x {:a 1
+             :b 2}
+      ^{:tag long} c
+        3
+      d ^:foo
+        [1 2]
+      e 4]
+  (+ a b))
+
+(let [^:m
+      a 1
+      ^{:x 1}
+      ^:y b ^:z
+        ^:w 2
+      c ^:v (bar
+              baz)]
+  a)
+
+(loop [^long i 0
+       ^:acc acc []]
+  (recur i acc))
+
+(cond
+  ^:x (pos? n)
+    :positive
+  :else ^:y
+    :other)
+
+{:a ^:x
+   [1]
+ ^:k :b 2}
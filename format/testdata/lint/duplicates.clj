@@ -0,0 +1,25 @@
+(def config
+  {:a 1
+   :b 2
+   :a 3})
+
+(def ok
+  {:a 1
+   #_:a #_2
+   #_ #_ :b 3
+   :b #inst "2020-01-01"
+   "a" 4
+   a 5
+   \A 6})
+
+(def platform-specific
+  {:a 1
+   #?(:clj :a) 2})
+
+(def xs #{1 2 1})
+
+(defn f []
+  [#{\A A}
+   #:user{:a 1 :user/a 2}
+   '{nil 1 nil 2}
+   #{#foo 1 #foo 1}])
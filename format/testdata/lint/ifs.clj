@@ -0,0 +1,13 @@
+(defn f [x y]
+  (if x y))
+
+(defn g [x y]
+  (if-not x y nil))
+
+; Quoted forms are data.
+'(if x y)
+
+(defmacro m [x y]
+  `(if ~x ~y))
+
+(def tagged '^:x (if x y))
@@ -0,0 +1,15 @@
+(ns foo.core
+  (:require [clojure.string :as str]
+            [clojure.set :as set]
+            [foo.side-effects]
+            [foo.util :refer :all]
+            [clojure [walk :as walk] [data :as data]])
+  (:use foo.legacy
+        [foo.other :only [helper]]))
+
+(defn f [x]
+  (if (str/blank? x)
+    (walk/keywordize-keys {})))
+
+(defn g [x]
+  (if x 1 2))
@@ -0,0 +1,40 @@
+(defn count-down [n]
+  (loop [i n]
+    (when (pos? i)
+      (println i)
+      (recur (dec i)))))
+
+(defn sum [xs]
+  (loop [xs xs
+         acc 0]
+    (if (empty? xs)
+      acc
+      (recur (rest xs) (+ acc (first xs))))))
+
+(defn bad [n]
+  (loop [i n]
+    (when (pos? i)
+      (recur (dec i))
+      (println "done"))))
+
+(defn also-bad [n]
+  (loop [i n]
+    (+ (recur (dec i)) 1)))
+
+(defmacro quoted [x]
+  `(loop []
+     (do (recur) ~x)))
+
+(defmacro annotated [x]
+  `^:x (loop []
+         (do (recur) ~x)))
+
+'^{:doc "data"} (do (recur) 1)
+
+(defn discarded [n]
+  (loop [i n]
+    (recur (dec i)) #_(println i)))
+
+(defn stacked [n]
+  (loop [i n]
+    (recur (dec i)) #_ #_ a b))
@@ -1,3 +1,2 @@
 `(k/defentity ~entity-var
    ~@body)
-
@@ -0,0 +1,9 @@
+(ns example.core
+  (:require
+    [clojure.string :as str])
+  (:load
+    "core/api"
+    "core/db"
+    ;; the server
+    "core/server"
+    "core/util"))
@@ -0,0 +1,5 @@
+(ns example.core
+  (:require [clojure.string :as str])
+  (:load "core/util" "core/api"
+         ;; the server
+         "core/server" "core/db"))
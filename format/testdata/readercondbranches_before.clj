@@ -0,0 +1,13 @@
+(defn parse-int [s]
+  #?(:clj (try
+    (Long/parseLong s)
+      (catch NumberFormatException _
+    nil))
+       :cljs (let [n (js/parseInt s 10)]
+   (when-not (js/isNaN n)
+     n))))
+
+(def platform #?(:clj
+  "jvm"
+    :cljs
+ "js"))
@@ -0,0 +1,14 @@
+(def quote-re #"\"")
+
+(def escapes-re #"a\\b\"c\d+")
+
+(def multiline-re #"line1
+line2  
+   \"quoted\"")
+
+(def multiline-str "multi
+   line \" \\
+  end")
+
+(defn f [s]
+  (re-find #"\\\"" s))
@@ -0,0 +1,6 @@
+
+
+#!/usr/bin/env bb
+
+
+(println "hi")
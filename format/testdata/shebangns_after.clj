@@ -0,0 +1,8 @@
+#!/usr/bin/env bb
+
+(ns foo.core
+  (:require
+    [babashka.fs :as fs]
+    [clojure.string :as str]))
+
+(println (str/upper-case (fs/cwd)))
@@ -0,0 +1,10 @@
+#!/usr/bin/env bb
+
+
+(ns foo.core
+  (:require [clojure.string :as str]
+    [babashka.fs :as fs]))
+
+
+
+(println (str/upper-case (fs/cwd)))
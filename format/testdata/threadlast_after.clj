@@ -0,0 +1,17 @@
+(defn summarize [orders limit]
+  (->> orders
+       (filter (fn [o]
+                 (pos? (:total o))))
+       (map (juxt :id
+                  :total))
+       (sort-by second)
+       (take limit)
+       (into {})))
+
+(defn f [m]
+  (-> m
+      (->> (map inc)
+           (cond-> x
+             (foo) (bar)))
+      (cond->> (seq m)
+                 (map inc))))
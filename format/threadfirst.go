@@ -1,6 +1,9 @@
 package format
 
-import "github.com/cespare/goclj/parse"
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
 
 func (p *Printer) markThreadFirsts(n parse.Node) {
 	var nodes []parse.Node
@@ -23,6 +26,12 @@ func (p *Printer) markThreadFirsts(n parse.Node) {
 }
 
 func (p *Printer) markThreadFirstStyle(form parse.Node, style ThreadFirstStyle) {
+	switch style {
+	case ThreadLastNormal, ThreadLastCondArrow:
+		// The threaded value goes at the end of each step, so the
+		// steps' arguments (and indentation) are unaffected.
+		return
+	}
 	begin := 2
 	if _, ok := p.threadFirst[form]; ok {
 		begin = 1 // nested thread-first forms
@@ -48,3 +57,308 @@ func (p *Printer) markThreadFirstStyle(form parse.Node, style ThreadFirstStyle)
 		idxSemantic++
 	}
 }
+
+const defaultMaxInlineThreadSteps = 3
+
+// threadingMacros are the forms considered by TransformBreakThreadChains.
+var threadingMacros = []string{"->", "->>", "some->", "some->>"}
+
+func (p *Printer) breakThreadChainsRec(n parse.Node) {
+	if goclj.FnFormSymbol(n, threadingMacros...) {
+		p.breakThreadChain(n)
+	}
+	for _, child := range n.Children() {
+		p.breakThreadChainsRec(child)
+	}
+}
+
+// breakThreadChain inserts a newline before each step of the threading form n
+// that is not already on its own line, if n has too many steps.
+func (p *Printer) breakThreadChain(n parse.Node) {
+	maxSteps := p.MaxInlineThreadSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxInlineThreadSteps
+	}
+	nodes := n.Children()
+	var semanticIdx int
+	for _, node := range nodes {
+		if goclj.Semantic(node) {
+			semanticIdx++
+		}
+	}
+	// The macro name and the threaded value are not steps.
+	if semanticIdx-2 <= maxSteps {
+		return
+	}
+	// Find where each step begins, including any metadata or tags
+	// preceding it.
+	breakBefore := make(map[int]bool)
+	semanticIdx = 0
+	for i, node := range nodes {
+		if !goclj.Semantic(node) {
+			continue
+		}
+		if semanticIdx >= 2 {
+			j := i
+			for j > 0 && isReaderPrefix(nodes[j-1]) {
+				j--
+			}
+			if j > 0 && !goclj.Newline(nodes[j-1]) {
+				breakBefore[j] = true
+			}
+		}
+		semanticIdx++
+	}
+	if len(breakBefore) == 0 {
+		return
+	}
+	newNodes := make([]parse.Node, 0, len(nodes)+len(breakBefore))
+	for i, node := range nodes {
+		if breakBefore[i] {
+			newNodes = append(newNodes, &parse.NewlineNode{})
+		}
+		newNodes = append(newNodes, node)
+	}
+	n.SetChildren(newNodes)
+}
+
+// isReaderPrefix reports whether n is a metadata or tag node, which is
+// attached to the node that follows it.
+func isReaderPrefix(n parse.Node) bool {
+	switch n.(type) {
+	case *parse.MetadataNode, *parse.TagNode:
+		return true
+	}
+	return false
+}
+
+func (p *Printer) expandThreadFirstsRec(n parse.Node) {
+	if isQuoted(n) {
+		return
+	}
+	children := n.Children()
+	changed := false
+	for i, child := range children {
+		for {
+			expanded, ok := p.expandThreadFirst(child)
+			if !ok {
+				break
+			}
+			child = expanded
+			children[i] = child
+			changed = true
+		}
+	}
+	if changed {
+		n.SetChildren(children)
+	}
+	for _, child := range children {
+		p.expandThreadFirstsRec(child)
+	}
+}
+
+// expandThreadFirst rewrites the thread-first form n as nested calls. The
+// second result is false if n is not a thread-first form or cannot be
+// expanded.
+func (p *Printer) expandThreadFirst(n parse.Node) (parse.Node, bool) {
+	list, ok := n.(*parse.ListNode)
+	if !ok || len(list.Nodes) == 0 {
+		return nil, false
+	}
+	sym, ok := list.Nodes[0].(*parse.SymbolNode)
+	if !ok {
+		return nil, false
+	}
+	style, ok := p.threadFirstStyles[sym.Val]
+	if !ok || sym.Val == "some->" {
+		// some-> stops threading at nil, so nested calls aren't
+		// equivalent.
+		return nil, false
+	}
+	var nodes []parse.Node
+	for _, node := range list.Nodes[1:] {
+		switch node.(type) {
+		case *parse.NewlineNode:
+			continue
+		case *parse.CommentNode, *parse.MetadataNode, *parse.TagNode:
+			return nil, false
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	switch style {
+	case ThreadFirstNormal:
+		expanded := nodes[0]
+		for _, step := range nodes[1:] {
+			if expanded, ok = threadInto(step, expanded); !ok {
+				return nil, false
+			}
+		}
+		return expanded, true
+	case ThreadFirstCondArrow:
+		// Only a single test/step pair threading a symbol can be
+		// expanded without evaluating the threaded value twice.
+		x, ok := nodes[0].(*parse.SymbolNode)
+		if !ok || len(nodes) != 3 {
+			return nil, false
+		}
+		step, ok := threadInto(nodes[2], x)
+		if !ok {
+			return nil, false
+		}
+		return &parse.ListNode{
+			Pos: list.Pos,
+			Nodes: []parse.Node{
+				&parse.SymbolNode{Val: "if"},
+				nodes[1],
+				step,
+				&parse.SymbolNode{Pos: x.Pos, Val: x.Val},
+			},
+		}, true
+	}
+	return nil, false
+}
+
+// threadInto inserts x as the first argument of the thread-first step. A bare
+// symbol or keyword step is treated as a call with no other arguments.
+func threadInto(step, x parse.Node) (parse.Node, bool) {
+	switch step := step.(type) {
+	case *parse.SymbolNode, *parse.KeywordNode:
+		return &parse.ListNode{Nodes: []parse.Node{step, x}}, true
+	case *parse.ListNode:
+		if len(step.Nodes) == 0 || !goclj.Semantic(step.Nodes[0]) {
+			return nil, false
+		}
+		nodes := make([]parse.Node, 0, len(step.Nodes)+1)
+		nodes = append(nodes, step.Nodes[0], x)
+		nodes = append(nodes, step.Nodes[1:]...)
+		step.Nodes = nodes
+		return step, true
+	}
+	return nil, false
+}
+
+// introduceThreadFirstsRec rewrites the calls within n as -> forms (see
+// introduceThreadFirst). If rewrite is false, the children of n are not
+// themselves rewritten, although the forms within them are.
+func (p *Printer) introduceThreadFirstsRec(n parse.Node, rewrite bool) {
+	if isQuoted(n) || goclj.FnFormSymbol(n, "ns", "quote") {
+		// Nothing in these is evaluated as written.
+		return
+	}
+	children := n.Children()
+	constants := caseConstants(n)
+	changed := false
+	for i, child := range children {
+		if !rewrite || constants[child] {
+			continue
+		}
+		if threaded, ok := p.introduceThreadFirst(child); ok {
+			children[i] = threaded
+			changed = true
+		}
+	}
+	if changed {
+		n.SetChildren(children)
+	}
+	var specs parse.Node
+	if goclj.FnFormSymbol(n, "letfn") {
+		if v := firstVector(children[1:]); v != nil {
+			specs = v
+		}
+	}
+	for _, child := range children {
+		switch {
+		case constants[child]:
+		case child == specs:
+			// The fn specs, (name [args] body), are not calls.
+			p.introduceThreadFirstsRec(child, false)
+		default:
+			p.introduceThreadFirstsRec(child, true)
+		}
+	}
+}
+
+// caseConstants returns the test constants of n if n is a case form.
+func caseConstants(n parse.Node) map[parse.Node]bool {
+	if !goclj.FnFormSymbol(n, "case") {
+		return nil
+	}
+	nodes := semanticNodes(n.Children())
+	constants := make(map[parse.Node]bool)
+	// (case expr test result ... default?)
+	for i := 2; i+1 < len(nodes); i += 2 {
+		constants[nodes[i]] = true
+	}
+	return constants
+}
+
+// introduceThreadFirst rewrites n, a call whose first argument is itself a
+// call, as a -> form. The second result is false if n is not such a call.
+func (p *Printer) introduceThreadFirst(n parse.Node) (parse.Node, bool) {
+	var steps []*parse.ListNode
+	x := n
+	for p.isThreadableCall(x) {
+		step := x.(*parse.ListNode)
+		steps = append(steps, step)
+		x = step.Nodes[1]
+	}
+	if len(steps) < 2 {
+		return nil, false
+	}
+	nodes := []parse.Node{&parse.SymbolNode{Val: "->"}, x}
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		if len(step.Nodes) == 2 {
+			nodes = append(nodes, step.Nodes[0])
+			continue
+		}
+		step.Nodes = append(step.Nodes[:1], step.Nodes[2:]...)
+		nodes = append(nodes, step)
+	}
+	return &parse.ListNode{Pos: steps[0].Pos, Nodes: nodes}, true
+}
+
+// indentedFns are functions (rather than macros) which have entries in
+// defaultIndents. They are threadable despite having indentation styles.
+var indentedFns = map[string]bool{
+	"assoc":     true,
+	"send-off":  true,
+	"update":    true,
+	"update-in": true,
+}
+
+// isThreadableCall reports whether n is a function call (headed by a symbol)
+// with at least one argument which may become a step of a -> form. Lists
+// headed by keywords are left alone, since they are often not calls at all,
+// as in (:require ...). Special forms and macros with known indentation styles are not
+// threadable, nor are calls containing comments or newlines.
+func (p *Printer) isThreadableCall(n parse.Node) bool {
+	list, ok := n.(*parse.ListNode)
+	if !ok || len(list.Nodes) < 2 {
+		return false
+	}
+	for _, node := range list.Nodes {
+		if !goclj.Semantic(node) || isReaderPrefix(node) {
+			return false
+		}
+	}
+	switch head := list.Nodes[0].(type) {
+	case *parse.SymbolNode:
+		if _, ok := p.indentStyles[head.Val]; ok && !indentedFns[head.Val] {
+			return false
+		}
+		if _, ok := p.threadFirstStyles[head.Val]; ok {
+			return false
+		}
+		for _, name := range threadingMacros {
+			if head.Val == name {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -1,8 +1,10 @@
 package format
 
 import (
+	"fmt"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/cespare/goclj"
 	"github.com/cespare/goclj/parse"
@@ -16,7 +18,8 @@ type Transform int
 
 const (
 	// TransformSortImportRequire sorts :import, :require, and :require-macros
-	// declarations in ns blocks.
+	// declarations (and :load paths) in ns blocks, as well as the class
+	// names within each :import list.
 	TransformSortImportRequire Transform = iota
 
 	// TransformEnforceNSStyle applies a few common ns style rules based on
@@ -41,7 +44,8 @@ const (
 	//
 	TransformRemoveTrailingNewlines
 
-	// TransformFixDefnArglistNewline moves the arg vector of defns to the
+	// TransformFixDefnArglistNewline moves the arg vector of defns (and
+	// other defn-like forms; see Printer.DefnLikeOverrides) to the
 	// same line, if appropriate:
 	//
 	//   (defn foo
@@ -70,7 +74,8 @@ const (
 	TransformFixDefmethodDispatchValNewline
 
 	// TransformRemoveExtraBlankLines consolidates consecutive blank lines
-	// into a single blank line.
+	// into a single blank line and removes blank lines at the start of the
+	// file.
 	TransformRemoveExtraBlankLines
 
 	// TransformFixIfNewlineConsistency ensures that if one arm of an if
@@ -112,6 +117,395 @@ const (
 	//
 	// It is not enabled by default.
 	TransformRemoveUnusedRequires
+
+	// TransformWrapLongLines breaks up lists, vectors, maps, sets, and
+	// reader conditionals that are written on a single line if that line
+	// would extend past Printer.MaxLineWidth. Newlines are inserted between
+	// arguments according to the indentation style of the form, so
+	//
+	//   (foo-bar-baz (compute-something x) (compute-something-else y))
+	//
+	// becomes
+	//
+	//   (foo-bar-baz (compute-something x)
+	//                (compute-something-else y))
+	//
+	// Unlike the other transforms, this is applied during printing since
+	// it depends on the column at which each form is written.
+	//
+	// It is not enabled by default.
+	TransformWrapLongLines
+
+	// TransformBreakThreadChains puts each step of a threading macro (such
+	// as -> and ->>) on its own line if the chain has more than
+	// Printer.MaxInlineThreadSteps steps. For example,
+	//
+	//   (-> x (assoc :a 1) (dissoc :b) (update :c inc) (merge m))
+	//
+	// becomes
+	//
+	//   (-> x
+	//       (assoc :a 1)
+	//       (dissoc :b)
+	//       (update :c inc)
+	//       (merge m))
+	//
+	// It is not enabled by default.
+	TransformBreakThreadChains
+
+	// TransformAlignMapValues pads the space between the keys and values
+	// of a map literal so that the values line up:
+	//
+	//   {:a 1
+	//    :bbb 2}
+	//
+	// becomes
+	//
+	//   {:a   1
+	//    :bbb 2}
+	//
+	// This is only done if each key/value pair is on its own line and no
+	// key or value spans multiple lines.
+	//
+	// It is not enabled by default.
+	TransformAlignMapValues
+
+	// TransformRemoveRedundantDo removes a (do ...) which is the entire
+	// body of a form that has an implicit do, splicing its contents into
+	// the enclosing form:
+	//
+	//   (when x
+	//     (do a b))
+	//
+	// becomes
+	//
+	//   (when x
+	//     a b)
+	//
+	// This applies to a conservative set of forms: when and its variants,
+	// let-like forms, fn and defn bodies, and method bodies in
+	// deftype-like forms.
+	//
+	// It is not enabled by default.
+	TransformRemoveRedundantDo
+
+	// TransformFnLiteralToFn rewrites anonymous function literals as
+	// equivalent fn forms:
+	//
+	//   #(assoc % :x %2)
+	//
+	// becomes
+	//
+	//   (fn [x1 x2] (assoc x1 :x x2))
+	//
+	// It is not enabled by default.
+	TransformFnLiteralToFn
+
+	// TransformExpandThreadFirst rewrites thread-first forms as nested
+	// calls:
+	//
+	//   (-> x (f a) g)
+	//
+	// becomes
+	//
+	//   (g (f x a))
+	//
+	// A cond-> form is expanded into an if form only if it threads a
+	// symbol through a single step. some-> forms are left alone.
+	//
+	// It is not enabled by default.
+	TransformExpandThreadFirst
+
+	// TransformIntroduceThreadFirst is the inverse of
+	// TransformExpandThreadFirst: it rewrites nested calls, where each
+	// call's first argument is another call, as -> forms. At least two
+	// calls must be nested for the rewrite to apply, and calls to
+	// special forms and macros with known indentation are not rewritten,
+	// nor are keyword-headed lists or lists which are not evaluated (such
+	// as ns clauses and case constants).
+	//
+	// It is not enabled by default.
+	TransformIntroduceThreadFirst
+
+	// TransformSortSetLiterals sorts the elements of set literals in which
+	// every element is a keyword, string, symbol, or number. Numbers sort
+	// first (by value), followed by strings, keywords, and symbols (each
+	// sorted lexically). Sets containing any other kind of element are
+	// left alone.
+	//
+	// It is not enabled by default.
+	TransformSortSetLiterals
+
+	// TransformBlankLineBetweenTopLevel ensures that there is exactly one
+	// blank line between consecutive top-level forms. Comments directly
+	// above a form stay attached to it (the blank line goes above the
+	// comments), and a comment on the same line as the end of a form stays
+	// with that form.
+	//
+	// It is not enabled by default.
+	TransformBlankLineBetweenTopLevel
+
+	// TransformRemoveBindingBlankLines removes blank lines from the binding
+	// vectors of let-like forms (such as let, binding, and loop) and
+	// for-like forms (including their :let clauses), so that
+	//
+	//   (let [a 1
+	//
+	//         b 2]
+	//     (+ a b))
+	//
+	// becomes
+	//
+	//   (let [a 1
+	//         b 2]
+	//     (+ a b))
+	//
+	// Blank lines in the body are unaffected.
+	//
+	// It is not enabled by default.
+	TransformRemoveBindingBlankLines
+
+	// TransformIfToWhen rewrites one-armed if forms (those without an else
+	// arm) as when forms:
+	//
+	//   (if (seq xs)
+	//     (println xs))
+	//
+	// becomes
+	//
+	//   (when (seq xs)
+	//     (println xs))
+	//
+	// Likewise, if-not, if-let, and if-some become when-not, when-let,
+	// and when-some.
+	//
+	// It is not enabled by default.
+	TransformIfToWhen
+
+	// TransformConsolidateRequires merges multiple :require clauses in an
+	// ns form into a single clause, combining the :as, :refer, and other
+	// options of any namespace that is required more than once:
+	//
+	//   (ns foo
+	//     (:require [a.b :as b])
+	//     (:require [a.b :refer [x]] [c.d]))
+	//
+	// becomes
+	//
+	//   (ns foo
+	//     (:require [a.b :as b :refer [x]] [c.d]))
+	//
+	// Multiple :require-macros clauses are merged in the same way.
+	//
+	// It is not enabled by default.
+	TransformConsolidateRequires
+
+	// TransformNormalizeCommentSpacing ensures that there is exactly one
+	// space between the leading semicolons of a comment and its text:
+	//
+	//   ;foo
+	//   ;;   bar
+	//
+	// becomes
+	//
+	//   ; foo
+	//   ;; bar
+	//
+	// Comments beginning with four or more semicolons (banners) and #!
+	// comments are left alone.
+	//
+	// It is not enabled by default.
+	TransformNormalizeCommentSpacing
+
+	// TransformAlignTrailingComments aligns the comments at the ends of
+	// consecutive lines within the same sequence to a common column:
+	//
+	//   (def width 80) ; columns
+	//   (def height 24) ; rows
+	//
+	// becomes
+	//
+	//   (def width 80)  ; columns
+	//   (def height 24) ; rows
+	//
+	// A blank line, or a line without a trailing comment, starts a new
+	// group.
+	//
+	// It is not enabled by default.
+	TransformAlignTrailingComments
+
+	// TransformRemoveCommentForms deletes (comment ...) forms, both at the
+	// top level and nested within other forms, along with the blank lines
+	// that would be left behind. (Unlike the parse.IgnoreCommentForm
+	// option, this keeps the rest of the formatting intact.)
+	//
+	// Note that a nested (comment ...) evaluates to nil, so removing one
+	// that is used as a value changes the meaning of the code. Forms in
+	// quoted data and in the binding vectors of let-like forms are left
+	// alone.
+	//
+	// It is not enabled by default.
+	TransformRemoveCommentForms
+
+	// TransformSplitRequires puts each entry of an ns block's :require,
+	// :require-macros, and :import clauses on its own line (keeping any
+	// comments with their entries), as TransformSortImportRequire does,
+	// but without sorting them. It is redundant if
+	// TransformSortImportRequire is enabled.
+	//
+	// It is not enabled by default.
+	TransformSplitRequires
+
+	// TransformCompactSingleRequire keeps a :require (or :require-macros)
+	// clause with a single entry on one line:
+	//
+	//   (ns foo
+	//     (:require
+	//       [clojure.string :as str]))
+	//
+	// becomes
+	//
+	//   (ns foo
+	//     (:require [clojure.string :as str]))
+	//
+	// Clauses containing comments are left alone.
+	//
+	// It is not enabled by default.
+	TransformCompactSingleRequire
+
+	// TransformNormalizeCharLiterals writes each character literal in a
+	// canonical way: the six named characters use their names (\newline,
+	// \space, \tab, \formfeed, \backspace, and \return), other printable
+	// characters are written directly (so \u0041 and \o101 become \A),
+	// and the rest use \uXXXX.
+	//
+	// It is not enabled by default.
+	TransformNormalizeCharLiterals
+
+	// TransformUseToRequireStrict is like TransformUseToRequire except
+	// that it only converts a :use entry if it names the vars to refer
+	// (with :only) or uses :as. A bare (:use foo.bar), which would
+	// become [foo.bar :refer :all], is left in a :use clause so that
+	// it may be converted by hand.
+	//
+	// It is not enabled by default.
+	TransformUseToRequireStrict
+
+	// TransformExpandRequirePrefixLists rewrites the prefix lists in
+	// :require clauses as separate requires:
+	//
+	//   (:require [clojure [set] [string :as s]])
+	//
+	// becomes
+	//
+	//   (:require [clojure.set] [clojure.string :as s])
+	//
+	// (The other require transforms only expand prefix lists when this is
+	// enabled.)
+	//
+	// It is not enabled by default.
+	TransformExpandRequirePrefixLists
+
+	// TransformNormalizeImports rewrites every :import clause in the style
+	// given by Printer.ImportStyle: either grouping the classes of each
+	// package into a list, as in (java.util List Map), or naming each
+	// class on its own, as in java.util.List. The packages and classes are
+	// sorted and duplicates are removed. Clauses containing comments are
+	// left alone.
+	//
+	// It is not enabled by default.
+	TransformNormalizeImports
+
+	// TransformPreserveRequireGroups changes TransformSortImportRequire
+	// (and TransformSplitRequires) to keep the blank lines that separate
+	// groups of entries in :require, :require-macros, :import, and :load
+	// clauses. Each group is sorted on its own, so
+	//
+	//   (:require [my.app.db :as db]
+	//             [my.app.core :as core]
+	//
+	//             [clojure.string :as str]
+	//             [cheshire.core :as json])
+	//
+	// becomes
+	//
+	//   (:require
+	//     [my.app.core :as core]
+	//     [my.app.db :as db]
+	//
+	//     [cheshire.core :as json]
+	//     [clojure.string :as str])
+	//
+	// It is not enabled by default.
+	TransformPreserveRequireGroups
+
+	// TransformSortIgnoringCase changes the order used by
+	// TransformSortImportRequire: names are compared one dotted segment
+	// at a time, ignoring case. For example, these are in order:
+	//
+	//   (:require [alpha.core] [Zeta.core] [foo.bar] [foo-baz.core])
+	//
+	// By default, Zeta.core comes before alpha.core (uppercase letters
+	// sort before lowercase ones) and foo-baz.core comes before foo.bar.
+	//
+	// It is not enabled by default.
+	TransformSortIgnoringCase
+
+	// TransformMergeMetadata merges adjacent keyword and map metadata on a
+	// form into a single map:
+	//
+	//   ^:private ^{:doc "x"} foo
+	//
+	// becomes
+	//
+	//   ^{:private true :doc "x"} foo
+	//
+	// Metadata that includes a type hint, a repeated key, or a key that is
+	// not a simple literal is left alone.
+	//
+	// It is not enabled by default.
+	TransformMergeMetadata
+
+	// TransformNormalizeDestructuring lays out multi-line destructuring
+	// maps in arglists and let-like bindings with each entry on its own
+	// line, the :or and :as entries last, and the values aligned:
+	//
+	//   (defn f [{:keys [a b] :as opts
+	//             :or {a 1}}]
+	//
+	// becomes
+	//
+	//   (defn f [{:keys [a b]
+	//             :or   {a 1}
+	//             :as   opts}]
+	//
+	// Destructuring maps that fit on one line are left alone.
+	//
+	// It is not enabled by default.
+	TransformNormalizeDestructuring
+
+	// TransformAlignAreTables lays out the table of values of a
+	// clojure.test/are form (or another form indented with IndentAre) in
+	// rows as long as its binding vector, one per line, with the columns
+	// aligned:
+	//
+	//   (are [x y] (= x y)
+	//     1 1 "a" "a"
+	//     :k :k)
+	//
+	// becomes
+	//
+	//   (are [x y] (= x y)
+	//     1   1
+	//     "a" "a"
+	//     :k  :k)
+	//
+	// Tables written on a single line, tables with comments, and tables
+	// whose last row is incomplete are left alone. Like
+	// TransformWrapLongLines, this is applied during printing.
+	//
+	// It is not enabled by default.
+	TransformAlignAreTables
 )
 
 var DefaultTransforms = map[Transform]bool{
@@ -124,15 +518,44 @@ var DefaultTransforms = map[Transform]bool{
 	TransformFixIfNewlineConsistency:        true,
 }
 
-func applyTransforms(t *parse.Tree, transforms map[Transform]bool) {
+func (p *Printer) applyTransforms(t *parse.Tree) {
+	transforms := p.Transforms
+	if transforms[TransformRemoveCommentForms] {
+		t.Roots = removeCommentForms(t.Roots)
+		for _, root := range t.Roots {
+			p.removeCommentFormsRec(root, false)
+		}
+	}
 	var syms *symbolCache
 	if transforms[TransformRemoveUnusedRequires] {
-		syms = findSymbols(t.Roots)
+		// Symbols used in cljfmt:off regions count, too.
+		roots := append(t.Roots[:len(t.Roots):len(t.Roots)], p.protected...)
+		syms = findSymbols(roots)
 	}
-	for _, root := range t.Roots {
+	if transforms[TransformExpandThreadFirst] ||
+		transforms[TransformIntroduceThreadFirst] {
+		// Wrap the roots so that they may be replaced as well.
+		top := &parse.ListNode{Nodes: t.Roots}
+		if transforms[TransformExpandThreadFirst] {
+			p.expandThreadFirstsRec(top)
+		}
+		if transforms[TransformIntroduceThreadFirst] {
+			p.introduceThreadFirstsRec(top, true)
+		}
+		t.Roots = top.Nodes
+	}
+	for i, root := range t.Roots {
 		if goclj.FnFormSymbol(root, "ns") {
-			if transforms[TransformUseToRequire] {
-				useToRequire(root)
+			if transforms[TransformExpandRequirePrefixLists] {
+				expandRequirePrefixLists(root)
+			}
+			if transforms[TransformUseToRequireStrict] {
+				useToRequire(root, true)
+			} else if transforms[TransformUseToRequire] {
+				useToRequire(root, false)
+			}
+			if transforms[TransformConsolidateRequires] {
+				consolidateRequires(root)
 			}
 			if transforms[TransformRemoveUnusedRequires] {
 				removeUnusedRequires(root, syms)
@@ -140,35 +563,134 @@ func applyTransforms(t *parse.Tree, transforms map[Transform]bool) {
 			if transforms[TransformEnforceNSStyle] {
 				enforceNSStyle(root)
 			}
+			if transforms[TransformNormalizeImports] {
+				normalizeImports(root, p.ImportStyle)
+			}
 			if transforms[TransformSortImportRequire] {
-				sortNS(root)
+				less := byteOrder
+				if transforms[TransformSortIgnoringCase] {
+					less = foldedOrder
+				}
+				sortNS(root, less, transforms[TransformPreserveRequireGroups])
+			} else if transforms[TransformSplitRequires] {
+				splitNS(root, nil, transforms[TransformPreserveRequireGroups])
 			}
+			if transforms[TransformCompactSingleRequire] {
+				compactSingleRequires(root)
+			}
+		}
+		if transforms[TransformRemoveRedundantDo] {
+			p.removeRedundantDoRec(root)
+		}
+		if transforms[TransformFnLiteralToFn] {
+			fnLiteralsToFnRec(root)
+		}
+		if transforms[TransformSortSetLiterals] {
+			sortSetsRec(root)
 		}
 		if transforms[TransformRemoveTrailingNewlines] {
 			removeTrailingNewlines(root)
 		}
-		if transforms[TransformFixDefnArglistNewline] &&
-			goclj.FnFormSymbol(root, "defn") {
+		if transforms[TransformFixDefnArglistNewline] && p.isDefnLike(root) {
 			fixDefnArglist(root)
 		}
 		if transforms[TransformFixDefmethodDispatchValNewline] &&
 			goclj.FnFormSymbol(root, "defmethod") {
 			fixDefmethodDispatchVal(root)
 		}
+		if transforms[TransformRemoveBindingBlankLines] {
+			p.removeBindingBlankLinesRec(root)
+		}
 		if transforms[TransformRemoveExtraBlankLines] {
 			removeExtraBlankLinesRec(root)
 		}
+		if transforms[TransformIfToWhen] && !annotationQuoted(t.Roots, i) {
+			ifToWhenRec(root)
+		}
 		if transforms[TransformFixIfNewlineConsistency] {
 			enforceConsistentIfNewlinesRec(root)
 		}
+		if transforms[TransformBreakThreadChains] {
+			p.breakThreadChainsRec(root)
+		}
+		if transforms[TransformNormalizeCommentSpacing] {
+			normalizeCommentSpacingRec(root)
+		}
+		if transforms[TransformNormalizeCharLiterals] {
+			normalizeCharLiteralsRec(root)
+		}
+		if transforms[TransformMergeMetadata] {
+			mergeMetadataRec(root)
+		}
+		if transforms[TransformNormalizeDestructuring] {
+			p.normalizeDestructuringRec(root)
+		}
+	}
+	if transforms[TransformMergeMetadata] {
+		if roots, ok := mergeMetadata(t.Roots); ok {
+			t.Roots = roots
+		}
+	}
+	if transforms[TransformFnLiteralToFn] {
+		for i, root := range t.Roots {
+			if fn, ok := root.(*parse.FnLiteralNode); ok {
+				t.Roots[i] = fnLiteralToFn(fn)
+			}
+		}
+	}
+	if transforms[TransformBlankLineBetweenTopLevel] {
+		t.Roots = blankLineBetweenTopLevel(t.Roots)
 	}
 	if transforms[TransformRemoveExtraBlankLines] {
 		t.Roots = removeExtraBlankLines(t.Roots)
+		// Start the file at the first form or comment.
+		for len(t.Roots) > 0 && goclj.Newline(t.Roots[0]) {
+			t.Roots = t.Roots[1:]
+		}
 	}
 }
 
-func useToRequire(ns parse.Node) {
+// useToRequire merges the :require and :use clauses of ns into a :require
+// clause. If strict is set, uses that would become :refer :all are kept
+// in a :use clause instead.
+func useToRequire(ns parse.Node, strict bool) {
+	mergeRequireClauses(ns, strict, ":require", ":use")
+}
+
+// expandRequirePrefixLists replaces the prefix lists in the :require and
+// :require-macros clauses of ns with the requires they stand for.
+func expandRequirePrefixLists(ns parse.Node) {
+	for _, n := range ns.Children()[1:] {
+		if goclj.FnFormKeyword(n, ":require", ":require-macros") {
+			children := n.Children()
+			n.SetChildren(append([]parse.Node{children[0]}, expandPrefixLists(children[1:])...))
+		}
+	}
+}
+
+// consolidateRequires merges multiple :require clauses of ns into one (and
+// likewise for :require-macros).
+func consolidateRequires(ns parse.Node) {
+	for _, kw := range []string{":require", ":require-macros"} {
+		clauses := 0
+		for _, n := range ns.Children()[1:] {
+			if goclj.FnFormKeyword(n, kw) {
+				clauses++
+			}
+		}
+		if clauses > 1 {
+			mergeRequireClauses(ns, false, kw)
+		}
+	}
+}
+
+// mergeRequireClauses replaces the ns clauses named by keywords with a
+// single :require clause (placed where the first of them was) that combines
+// all of their requires. If strictUse is set, bare uses (see
+// TransformUseToRequireStrict) are not merged.
+func mergeRequireClauses(ns parse.Node, strictUse bool, keywords ...string) {
 	rl := newRequireList()
+	rl.strictUse = strictUse
 	insertIndex := -1
 	prevSkipped := false
 	nodes := []parse.Node{&parse.SymbolNode{Val: "ns"}}
@@ -179,7 +701,7 @@ func useToRequire(ns parse.Node) {
 			continue
 		}
 		prevSkipped = false
-		if goclj.FnFormKeyword(n, ":require", ":use") {
+		if goclj.FnFormKeyword(n, keywords...) {
 			children := n.Children()
 			name := children[0].(*parse.KeywordNode).Val
 			rl.parseRequireUse(children, name == ":use")
@@ -217,7 +739,7 @@ func removeUnusedRequires(ns parse.Node, syms *symbolCache) {
 				requires = append(requires, child)
 				continue
 			}
-			if vec, ok := child.(*parse.VectorNode); ok && len(vec.Children()) == 1 {
+			if isBareRequire(child) {
 				keep = append(keep, child)
 			} else {
 				requires = append(requires, child)
@@ -246,6 +768,22 @@ func removeUnusedRequires(ns parse.Node, syms *symbolCache) {
 	ns.SetChildren(nodes)
 }
 
+// isBareRequire reports whether n is a require vector naming only a
+// namespace, such as [foo.bar] (possibly with comments or newlines inside).
+func isBareRequire(n parse.Node) bool {
+	vec, ok := n.(*parse.VectorNode)
+	if !ok {
+		return false
+	}
+	semantic := 0
+	for _, child := range vec.Nodes {
+		if goclj.Semantic(child) {
+			semantic++
+		}
+	}
+	return semantic == 1
+}
+
 func enforceNSStyle(ns parse.Node) {
 	children := ns.Children()
 	for i := 1; i < len(children); i++ {
@@ -295,6 +833,8 @@ func enforceNSStyle(ns parse.Node) {
 			enforceRequireStyle(clauseChildren)
 		case "import":
 			enforceImportStyle(clauseChildren)
+		case "gen-class":
+			clauseChildren = enforceGenClassStyle(clauseChildren)
 		}
 		n.SetChildren(clauseChildren)
 		if isVec {
@@ -348,24 +888,102 @@ func enforceImportStyle(nodes []parse.Node) {
 	}
 }
 
-func sortNS(ns parse.Node) {
+// enforceGenClassStyle puts each option/value pair of a :gen-class clause
+// on its own line. Clauses containing comments are left alone.
+func enforceGenClassStyle(nodes []parse.Node) []parse.Node {
+	var opts []parse.Node
+	for _, n := range nodes[1:] {
+		switch {
+		case goclj.Semantic(n):
+			opts = append(opts, n)
+		case goclj.Newline(n):
+		default:
+			return nodes
+		}
+	}
+	result := []parse.Node{nodes[0]}
+	for i := 0; i < len(opts); i += 2 {
+		result = append(result, newline, opts[i])
+		if i+1 < len(opts) {
+			result = append(result, opts[i+1])
+		}
+	}
+	return result
+}
+
+func sortNS(ns parse.Node, less func(a, b string) bool, keepGroups bool) {
+	for _, n := range ns.Children()[1:] {
+		if goclj.FnFormKeyword(n, ":require", ":require-macros", ":import", ":load") {
+			splitImportRequire(n.(*parse.ListNode), less, keepGroups)
+		}
+		if goclj.FnFormKeyword(n, ":import") {
+			for _, imp := range n.Children()[1:] {
+				sortImportClasses(imp)
+			}
+		}
+	}
+}
+
+func compactSingleRequires(ns parse.Node) {
+	for _, n := range ns.Children()[1:] {
+		if !goclj.FnFormKeyword(n, ":require", ":require-macros") {
+			continue
+		}
+		var (
+			entries     []parse.Node
+			hasComments bool
+		)
+		for _, child := range n.Children()[1:] {
+			switch child.(type) {
+			case *parse.CommentNode:
+				hasComments = true
+			case *parse.NewlineNode, *parse.CommaNode:
+			default:
+				entries = append(entries, child)
+			}
+		}
+		if len(entries) == 1 && !hasComments {
+			n.SetChildren([]parse.Node{n.Children()[0], entries[0]})
+		}
+	}
+}
+
+func splitNS(ns parse.Node, less func(a, b string) bool, keepGroups bool) {
 	for _, n := range ns.Children()[1:] {
 		if goclj.FnFormKeyword(n, ":require", ":require-macros", ":import") {
-			sortImportRequire(n.(*parse.ListNode))
+			splitImportRequire(n.(*parse.ListNode), less, keepGroups)
 		}
 	}
 }
 
 func sortImportRequire(n *parse.ListNode) {
+	splitImportRequire(n, byteOrder, false)
+}
+
+// splitImportRequire puts each entry of the :require, :import, or similar
+// clause n on its own line, along with any comments attached to it. If
+// less is non-nil, the entries are sorted by name using less as well. If
+// keepGroups is true, blank lines between entries are kept and each group
+// of entries between blank lines is sorted separately.
+func splitImportRequire(n *parse.ListNode, less func(a, b string) bool, keepGroups bool) {
 	var (
 		nodes             = n.Children()
 		sorted            = make(importRequireList, 0, len(nodes)/2)
 		lineComments      []*parse.CommentNode
 		initialNewline    = false
 		afterSemanticNode = false
+		prevNewline       = false
+		newGroup          = false
 	)
 	for i, node := range nodes[1:] {
+		if goclj.Newline(node) && prevNewline && keepGroups && len(sorted) > 0 {
+			newGroup = true
+		}
+		prevNewline = goclj.Newline(node)
 		switch node := node.(type) {
+		case *parse.CommaNode:
+			// Commas between entries would be left behind (or
+			// stranded on a line of their own) as the entries move.
 		case *parse.CommentNode:
 			if afterSemanticNode {
 				sorted[len(sorted)-1].commentBeside = node
@@ -381,18 +999,37 @@ func sortImportRequire(n *parse.ListNode) {
 			ir := &importRequire{
 				commentsAbove: lineComments,
 				node:          node,
+				groupStart:    newGroup,
 			}
 			sorted = append(sorted, ir)
 			lineComments = nil
 			afterSemanticNode = true
+			newGroup = false
+		}
+	}
+	if less != nil {
+		start := 0
+		for i := 1; i <= len(sorted); i++ {
+			if i == len(sorted) || sorted[i].groupStart {
+				// The group's blank line stays before its first
+				// entry after sorting.
+				group := sorted[start:i]
+				blank := group[0].groupStart
+				group[0].groupStart = false
+				sort.Stable(sortedImportRequires{group, less})
+				group[0].groupStart = blank
+				start = i
+			}
 		}
 	}
-	sort.Stable(sorted)
 	newNodes := []parse.Node{nodes[0]}
 	if initialNewline {
 		newNodes = append(newNodes, newline)
 	}
 	for _, ir := range sorted {
+		if ir.groupStart {
+			newNodes = append(newNodes, newline)
+		}
 		for _, cn := range ir.commentsAbove {
 			newNodes = append(newNodes, cn, newline)
 		}
@@ -413,6 +1050,39 @@ func sortImportRequire(n *parse.ListNode) {
 	n.SetChildren(newNodes)
 }
 
+// sortImportClasses sorts the class names that follow the package in an
+// import list such as (java.util Map List). If any comments are mixed in,
+// each class is moved onto its own line (keeping its comments with it).
+func sortImportClasses(n parse.Node) {
+	list, ok := n.(*parse.ListNode)
+	if !ok || len(list.Nodes) < 3 {
+		return
+	}
+	var slots []int
+	for i, node := range list.Nodes[1:] {
+		switch node.(type) {
+		case *parse.CommentNode:
+			sortImportRequire(list)
+			return
+		case *parse.SymbolNode:
+			slots = append(slots, i+1)
+		case *parse.NewlineNode:
+		default:
+			return
+		}
+	}
+	classes := make([]parse.Node, len(slots))
+	for i, j := range slots {
+		classes[i] = list.Nodes[j]
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		return classes[i].(*parse.SymbolNode).Val < classes[j].(*parse.SymbolNode).Val
+	})
+	for i, j := range slots {
+		list.Nodes[j] = classes[i]
+	}
+}
+
 func removeTrailingNewlines(n parse.Node) {
 	nodes := n.Children()
 	if len(nodes) == 0 {
@@ -435,6 +1105,84 @@ func removeTrailingNewlines(n parse.Node) {
 	}
 }
 
+// isQuoted reports whether n is a quoted or syntax-quoted form. Rewriting
+// code inside one would change the data it produces.
+func isQuoted(n parse.Node) bool {
+	switch n.(type) {
+	case *parse.QuoteNode, *parse.SyntaxQuoteNode:
+		return true
+	}
+	return false
+}
+
+// prefixTarget returns the target of n if n is a prefixed form such as 'x
+// or @x.
+func prefixTarget(n parse.Node) (parse.Node, bool) {
+	switch n := n.(type) {
+	case *parse.QuoteNode:
+		return n.Node, true
+	case *parse.SyntaxQuoteNode:
+		return n.Node, true
+	case *parse.UnquoteNode:
+		return n.Node, true
+	case *parse.UnquoteSpliceNode:
+		return n.Node, true
+	case *parse.DerefNode:
+		return n.Node, true
+	}
+	return nil, false
+}
+
+// annotationPrefixes returns the prefixes (outermost first) which apply to
+// nodes[i] by way of its metadata or tag. The parser keeps an annotation apart
+// from the form it annotates, so '^:x foo is a QuoteNode holding ^:x followed
+// by foo as a sibling; foo is quoted all the same.
+func annotationPrefixes(nodes []parse.Node, i int) []parse.Node {
+	for j := i - 1; j >= 0; j-- {
+		if !goclj.Semantic(nodes[j]) {
+			continue // further annotations, newlines, and comments
+		}
+		var prefixes []parse.Node
+		for n := nodes[j]; ; {
+			target, ok := prefixTarget(n)
+			if !ok {
+				return nil
+			}
+			prefixes = append(prefixes, n)
+			switch target.(type) {
+			case *parse.MetadataNode, *parse.TagNode:
+				return prefixes
+			}
+			n = target
+		}
+	}
+	return nil
+}
+
+// annotationQuoted reports whether nodes[i] is quoted by way of its metadata
+// or tag (see annotationPrefixes).
+func annotationQuoted(nodes []parse.Node, i int) bool {
+	for _, prefix := range annotationPrefixes(nodes, i) {
+		if isQuoted(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDefnLike reports whether n is a list form beginning with one of the
+// Printer's defn-like symbols.
+func (p *Printer) isDefnLike(n parse.Node) bool {
+	if !goclj.FnFormSymbol(n) {
+		return false
+	}
+	return p.defnLike[n.Children()[0].(*parse.SymbolNode).Val]
+}
+
+// fixDefnArglist moves the arglist of a defn-like form up to the line of
+// the name if it begins the second line and is followed by more code on
+// that line. Multi-arity forms, which have lists rather than a vector
+// there, are left alone.
 func fixDefnArglist(defn parse.Node) {
 	nodes := defn.Children()
 	if len(nodes) < 5 {
@@ -502,6 +1250,95 @@ func removeExtraBlankLines(nodes []parse.Node) []parse.Node {
 	return newNodes
 }
 
+func (p *Printer) removeBindingBlankLinesRec(n parse.Node) {
+	if goclj.FnFormSymbol(n) {
+		name := n.Children()[0].(*parse.SymbolNode).Val
+		if style, ok := p.indentStyleForSymbol(name); ok &&
+			(style == IndentLet || style == IndentFor) {
+			if v := firstVector(n.Children()[1:]); v != nil {
+				removeBlankLines(v)
+				if style == IndentFor {
+					removeForLetBlankLines(v)
+				}
+			}
+		}
+	}
+	for _, child := range n.Children() {
+		p.removeBindingBlankLinesRec(child)
+	}
+}
+
+// firstVector returns the first semantic node of nodes if it is a vector.
+func firstVector(nodes []parse.Node) *parse.VectorNode {
+	for _, node := range nodes {
+		if goclj.Semantic(node) {
+			v, _ := node.(*parse.VectorNode)
+			return v
+		}
+	}
+	return nil
+}
+
+// removeForLetBlankLines removes the blank lines from the bindings of each
+// :let clause in the binding vector of a for-like form.
+func removeForLetBlankLines(bindings *parse.VectorNode) {
+	prevLet := false
+	for _, node := range bindings.Nodes {
+		if !goclj.Semantic(node) {
+			continue
+		}
+		if v, ok := node.(*parse.VectorNode); ok && prevLet {
+			removeBlankLines(v)
+		}
+		prevLet = isKeywordNode(node, ":let")
+	}
+}
+
+// removeBlankLines collapses each run of newlines among the children of v
+// into a single newline.
+func removeBlankLines(v *parse.VectorNode) {
+	nodes := make([]parse.Node, 0, len(v.Nodes))
+	for i, node := range v.Nodes {
+		if goclj.Newline(node) && i > 0 && goclj.Newline(v.Nodes[i-1]) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	v.Nodes = nodes
+}
+
+// blankLineBetweenTopLevel makes the gap following each top-level form in
+// nodes (and any comment beside it) exactly one blank line, if there is
+// another form after it.
+func blankLineBetweenTopLevel(nodes []parse.Node) []parse.Node {
+	var semantic []int
+	for i, node := range nodes {
+		if goclj.Semantic(node) {
+			semantic = append(semantic, i)
+		}
+	}
+	newNodes := make([]parse.Node, 0, len(nodes))
+	prev := 0
+	for k := 0; k+1 < len(semantic); k++ {
+		i, next := semantic[k], semantic[k+1]
+		if isReaderPrefix(nodes[i]) {
+			continue
+		}
+		j := i + 1
+		if j < next && goclj.Comment(nodes[j]) {
+			j++
+		}
+		end := j
+		for end < next && goclj.Newline(nodes[end]) {
+			end++
+		}
+		newNodes = append(newNodes, nodes[prev:j]...)
+		newNodes = append(newNodes, &parse.NewlineNode{}, &parse.NewlineNode{})
+		prev = end
+	}
+	return append(newNodes, nodes[prev:]...)
+}
+
 func enforceConsistentIfNewlinesRec(n parse.Node) {
 	if goclj.FnFormSymbol(n, "if", "if-not", "if-some", "if-let") {
 		n.SetChildren(enforceConsistentIfNewlines(n.Children()))
@@ -511,9 +1348,11 @@ func enforceConsistentIfNewlinesRec(n parse.Node) {
 	}
 }
 
-func enforceConsistentIfNewlines(nodes []parse.Node) []parse.Node {
-	var arm0, arm1 int
-	var newlineBeforeArm0, newlineBeforeArm1 bool
+// ifArms locates the arms of the if-like form made up of nodes. arm0 and arm1
+// are the indexes of the then and else arms (or 0, if missing), and
+// newlineBeforeArm0 and newlineBeforeArm1 say whether a newline precedes
+// each one.
+func ifArms(nodes []parse.Node) (arm0, arm1 int, newlineBeforeArm0, newlineBeforeArm1 bool) {
 	var foundTest bool
 	i := 1
 	for ; i < len(nodes); i++ {
@@ -543,6 +1382,11 @@ func enforceConsistentIfNewlines(nodes []parse.Node) []parse.Node {
 		arm1 = i
 		break
 	}
+	return arm0, arm1, newlineBeforeArm0, newlineBeforeArm1
+}
+
+func enforceConsistentIfNewlines(nodes []parse.Node) []parse.Node {
+	arm0, arm1, newlineBeforeArm0, newlineBeforeArm1 := ifArms(nodes)
 	if arm1 == 0 { // only one arm
 		return nodes
 	}
@@ -565,37 +1409,159 @@ func enforceConsistentIfNewlines(nodes []parse.Node) []parse.Node {
 	return nodes
 }
 
+// oneArmedIfs maps the if-like forms rewritten by TransformIfToWhen to
+// their when-like equivalents.
+var oneArmedIfs = map[string]string{
+	"if":      "when",
+	"if-not":  "when-not",
+	"if-let":  "when-let",
+	"if-some": "when-some",
+}
+
+func ifToWhenRec(n parse.Node) {
+	if isQuoted(n) {
+		return
+	}
+	if goclj.FnFormSymbol(n, "if", "if-not", "if-let", "if-some") {
+		nodes := n.Children()
+		if arm0, arm1, _, _ := ifArms(nodes); arm0 > 0 && arm1 == 0 {
+			sym := nodes[0].(*parse.SymbolNode)
+			nodes[0] = &parse.SymbolNode{Pos: sym.Pos, Val: oneArmedIfs[sym.Val]}
+			n.SetChildren(nodes)
+		}
+	}
+	children := n.Children()
+	for i, child := range children {
+		if !annotationQuoted(children, i) {
+			ifToWhenRec(child)
+		}
+	}
+}
+
+func normalizeCommentSpacingRec(n parse.Node) {
+	if c, ok := n.(*parse.CommentNode); ok {
+		c.Text = normalizeCommentSpacing(c.Text)
+		return
+	}
+	for _, child := range n.Children() {
+		normalizeCommentSpacingRec(child)
+	}
+}
+
+func normalizeCommentSpacing(text string) string {
+	marker := text[:len(text)-len(strings.TrimLeft(text, ";"))]
+	if marker == "" || len(marker) >= 4 {
+		return text // #! or a banner
+	}
+	body := strings.TrimLeft(text[len(marker):], " \t")
+	if body == "" {
+		return marker
+	}
+	return marker + " " + body
+}
+
+func normalizeCharLiteralsRec(n parse.Node) {
+	if c, ok := n.(*parse.CharacterNode); ok {
+		if text, ok := charLiteral(c.Val); ok {
+			c.Text = text
+		}
+		return
+	}
+	for _, child := range n.Children() {
+		normalizeCharLiteralsRec(child)
+	}
+}
+
+var charNames = map[rune]string{
+	'\n': "newline",
+	' ':  "space",
+	'\t': "tab",
+	'\f': "formfeed",
+	'\b': "backspace",
+	'\r': "return",
+}
+
+// charLiteral returns the canonical literal for r. It returns false if r
+// cannot be written as a Clojure character literal (because it is outside
+// the Basic Multilingual Plane).
+func charLiteral(r rune) (string, bool) {
+	if name, ok := charNames[r]; ok {
+		return `\` + name, true
+	}
+	if r > 0xffff {
+		return "", false
+	}
+	if unicode.IsPrint(r) && !unicode.IsSpace(r) {
+		return `\` + string(r), true
+	}
+	return fmt.Sprintf(`\u%04x`, r), true
+}
+
 // An importRequire is an import/require with associated comment nodes.
 type importRequire struct {
 	commentsAbove []*parse.CommentNode
 	commentBeside *parse.CommentNode
 	node          parse.Node
+	// groupStart is set if a blank line (which splitImportRequire is
+	// keeping) came before this import/require.
+	groupStart bool
 }
 
 type importRequireList []*importRequire
 
+// sortedImportRequires sorts an importRequireList by name, comparing the
+// names with less.
+type sortedImportRequires struct {
+	importRequireList
+	less func(a, b string) bool
+}
+
 func (l importRequireList) Len() int      { return len(l) }
 func (l importRequireList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
 
-func (l importRequireList) Less(i, j int) bool {
+func (l sortedImportRequires) Less(i, j int) bool {
 	// We only consider nodes comparable if they are symbols or
 	// lists/vectors with a symbol as a first child. Everything else
 	// compares as greater than one of these (and equal to one another).
-	k0, ok0 := getImportRequireSortKey(l[i].node)
-	k1, ok1 := getImportRequireSortKey(l[j].node)
+	k0, ok0 := getImportRequireSortKey(l.importRequireList[i].node)
+	k1, ok1 := getImportRequireSortKey(l.importRequireList[j].node)
 	if ok0 {
 		if ok1 {
-			return k0 < k1
+			return l.less(k0, k1)
 		}
 		return true // valid < junk
 	}
 	return false // junk == junk, junk > valid
 }
 
+// byteOrder is the default order of import and require names.
+func byteOrder(a, b string) bool { return a < b }
+
+// foldedOrder is the order of import and require names used with
+// TransformSortIgnoringCase. The names are compared one dotted segment at
+// a time (so a.b comes before a-c), ignoring case; names that are
+// otherwise equal are ordered by byteOrder.
+func foldedOrder(a, b string) bool {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, y := strings.ToLower(as[i]), strings.ToLower(bs[i])
+		if x != y {
+			return x < y
+		}
+	}
+	if len(as) != len(bs) {
+		return len(as) < len(bs)
+	}
+	return a < b
+}
+
 func getImportRequireSortKey(n parse.Node) (key string, ok bool) {
 	switch n := n.(type) {
 	case *parse.SymbolNode:
 		return n.Val, true
+	case *parse.StringNode: // :load paths
+		return n.Val, true
 	case *parse.ListNode, *parse.VectorNode:
 		children := n.Children()
 		if len(children) == 0 {
@@ -11,20 +11,35 @@ type symbolCache struct {
 	imports    map[string]struct{} // packages appearing in :imports
 	symbols    map[string]struct{} // symbols without a / in them; e.g., foo
 	namespaces map[string]struct{} // symbol namespaces; e.g., a/foo -> a
+
+	// coreExcludes are the clojure.core names excluded by
+	// (:refer-clojure :exclude [...]). A referred symbol with one of these
+	// names is presumably meant to replace the core var, so it is kept.
+	coreExcludes map[string]struct{}
 }
 
 func findSymbols(roots []parse.Node) *symbolCache {
 	syms := &symbolCache{
-		imports:    make(map[string]struct{}),
-		symbols:    make(map[string]struct{}),
-		namespaces: make(map[string]struct{}),
+		imports:      make(map[string]struct{}),
+		symbols:      make(map[string]struct{}),
+		namespaces:   make(map[string]struct{}),
+		coreExcludes: make(map[string]struct{}),
 	}
-	var find func(n parse.Node)
-	find = func(n parse.Node) {
+	// syntaxQuoted says whether n is inside a syntax quote (and not
+	// unquoted), where symbols such as x# are auto-gensyms rather than
+	// references to anything.
+	var find func(n parse.Node, syntaxQuoted bool)
+	find = func(n parse.Node, syntaxQuoted bool) {
 		var name string
 		switch n := n.(type) {
 		case *parse.SymbolNode:
-			name = n.Val
+			if !syntaxQuoted || !strings.HasSuffix(n.Val, "#") {
+				name = n.Val
+			}
+		case *parse.SyntaxQuoteNode:
+			syntaxQuoted = true
+		case *parse.UnquoteNode, *parse.UnquoteSpliceNode:
+			syntaxQuoted = false
 		case *parse.VarQuoteNode:
 			name = n.Val
 		case *parse.KeywordNode:
@@ -37,10 +52,8 @@ func findSymbols(roots []parse.Node) *symbolCache {
 		case *parse.MapNode:
 			// Handle auto-resolving namespaced maps of the form
 			// #::ns{...}.
-			if ns, ok := trimPrefix(n.Namespace, "::"); ok {
-				if ns != "" {
-					syms.namespaces[ns] = struct{}{}
-				}
+			if ns := n.NamespaceName(); n.AutoResolved() && ns != "" {
+				syms.namespaces[ns] = struct{}{}
 			}
 		}
 		if name != "" {
@@ -50,11 +63,12 @@ func findSymbols(roots []parse.Node) *symbolCache {
 				syms.namespaces[name[:i]] = struct{}{}
 			}
 		}
-		for _, child := range n.Children() {
-			find(child)
+		children := n.Children()
+		for i, child := range children {
+			find(child, annotationSyntaxQuoted(children, i, syntaxQuoted))
 		}
 	}
-	for _, root := range roots {
+	for i, root := range roots {
 		if goclj.FnFormSymbol(root, "ns") {
 			for _, n := range root.Children()[1:] {
 				if goclj.FnFormKeyword(n, ":import") {
@@ -62,14 +76,32 @@ func findSymbols(roots []parse.Node) *symbolCache {
 						syms.findImports(n1)
 					}
 				}
+				if goclj.FnFormKeyword(n, ":refer-clojure") {
+					syms.findCoreExcludes(n)
+				}
 			}
 		} else {
-			find(root)
+			find(root, annotationSyntaxQuoted(roots, i, false))
 		}
 	}
 	return syms
 }
 
+// annotationSyntaxQuoted reports whether nodes[i] is inside a syntax quote,
+// given whether its parent is, taking into account the prefixes that apply to
+// it by way of its metadata or tag (see annotationPrefixes).
+func annotationSyntaxQuoted(nodes []parse.Node, i int, syntaxQuoted bool) bool {
+	for _, prefix := range annotationPrefixes(nodes, i) {
+		switch prefix.(type) {
+		case *parse.SyntaxQuoteNode:
+			syntaxQuoted = true
+		case *parse.UnquoteNode, *parse.UnquoteSpliceNode:
+			syntaxQuoted = false
+		}
+	}
+	return syntaxQuoted
+}
+
 func trimPrefix(s, prefix string) (string, bool) {
 	result := strings.TrimPrefix(s, prefix)
 	return result, result != s
@@ -91,11 +123,43 @@ func (sc *symbolCache) findImports(n parse.Node) {
 	}
 }
 
+// findCoreExcludes records the names listed by :exclude in the
+// (:refer-clojure ...) form n.
+func (sc *symbolCache) findCoreExcludes(n parse.Node) {
+	var nodes []parse.Node
+	for _, node := range n.Children() {
+		if goclj.Semantic(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	for i := 1; i+1 < len(nodes); i += 2 {
+		kw, ok := nodes[i].(*parse.KeywordNode)
+		if !ok || kw.Val != ":exclude" {
+			continue
+		}
+		for _, ex := range nodes[i+1].Children() {
+			if sym, ok := ex.(*parse.SymbolNode); ok {
+				sc.coreExcludes[sym.Val] = struct{}{}
+			}
+		}
+	}
+}
+
 func (sc *symbolCache) usesSym(name string) bool {
 	_, ok := sc.symbols[name]
 	return ok
 }
 
+// keepsRefer reports whether a referred symbol should be kept: either it is
+// used or it replaces an excluded clojure.core name.
+func (sc *symbolCache) keepsRefer(name string) bool {
+	if sc.usesSym(name) {
+		return true
+	}
+	_, ok := sc.coreExcludes[name]
+	return ok
+}
+
 func (sc *symbolCache) usesNamespace(name string) bool {
 	_, ok := sc.namespaces[name]
 	return ok
@@ -107,7 +171,7 @@ func (sc *symbolCache) usesRequireAsImport(name string) bool {
 	return ok
 }
 
-// unused removes unused :as and :refer aliases from r,
+// unused removes unused :as, :as-alias, and :refer aliases from r,
 // and also returns whether the require is no longer needed at all.
 func (sc *symbolCache) unused(r *require) bool {
 	for as := range r.as {
@@ -115,11 +179,17 @@ func (sc *symbolCache) unused(r *require) bool {
 			delete(r.as, as)
 		}
 	}
-	r.refer.removeUnused(sc)
-	r.referMacros.removeUnused(sc)
+	for as := range r.asAlias {
+		if !sc.usesNamespace(as) {
+			delete(r.asAlias, as)
+		}
+	}
+	r.refer.removeUnused(sc, &r.rename)
+	r.referMacros.removeUnused(sc, &r.rename)
 	return !sc.usesNamespace(r.name) &&
 		!sc.usesRequireAsImport(r.name) &&
 		len(r.as) == 0 &&
+		len(r.asAlias) == 0 &&
 		!r.referAll &&
 		r.refer.origRefer == nil && len(r.refer.refer) == 0 &&
 		r.referMacros.origRefer == nil && len(r.referMacros.refer) == 0
@@ -0,0 +1,156 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+const defaultMaxLineWidth = 80
+
+// wrapLongLine implements TransformWrapLongLines. If n is a sequence that is
+// written on a single line that begins at column w and would extend past the
+// maximum line width, wrapLongLine inserts newlines between the children of n
+// as appropriate for style.
+func (p *Printer) wrapLongLine(n parse.Node, w int, style IndentStyle) {
+	if !p.Transforms[TransformWrapLongLines] {
+		return
+	}
+	maxWidth := p.MaxLineWidth
+	if maxWidth <= 0 {
+		maxWidth = defaultMaxLineWidth
+	}
+	nodes := n.Children()
+	lead, group := wrapLayout(n, style)
+	// Commas don't count when laying out the children.
+	forms := 0
+	for _, node := range nodes {
+		if !goclj.Comma(node) {
+			forms++
+		}
+	}
+	if forms <= lead {
+		return
+	}
+	s, ok := p.printFlat(n)
+	if !ok || w+len(s) <= maxWidth {
+		return
+	}
+	wrapped := make([]parse.Node, 0, 2*len(nodes))
+	i := 0
+	for _, node := range nodes {
+		if goclj.Comma(node) {
+			wrapped = append(wrapped, node)
+			continue
+		}
+		if i >= lead && (i-lead)%group == 0 {
+			wrapped = append(wrapped, &parse.NewlineNode{})
+		}
+		wrapped = append(wrapped, node)
+		i++
+	}
+	n.SetChildren(wrapped)
+	p.forgetFlat(n)
+}
+
+// wrapLayout says how to break up the children of a sequence n indented with
+// style: the first lead children stay on the first line and each group of
+// the rest (a single child, a pair, or a row of an are table) begins a new
+// line.
+func wrapLayout(n parse.Node, style IndentStyle) (lead, group int) {
+	if args, ok := style.bodyArgs(); ok {
+		return args + 1, 1
+	}
+	switch style {
+	case IndentNormal:
+		return 1, 1
+	case IndentAre:
+		if arity := areArity(n); arity > 0 {
+			return 3, arity
+		}
+		return 3, 1
+	case indentBindings:
+		return 2, 2
+	case IndentCond0, IndentCond1, IndentCond2, IndentCond4:
+		return indentExtraOffsets[style], 2
+	}
+	return 2, 1
+}
+
+// A flatNode is the result of printFlat for a node.
+type flatNode struct {
+	s  string
+	ok bool
+}
+
+// printFlat renders n using a scratch Printer with p's settings. It returns
+// false if n is not written on a single line.
+//
+// The results are cached in p.flat. The children of n are rendered first, so
+// that rendering n only means putting together their cached text; otherwise
+// each enclosing form that is measured would render n again.
+func (p *Printer) printFlat(n parse.Node) (string, bool) {
+	if f, ok := p.flat[n]; ok {
+		return f.s, f.ok
+	}
+	f := flatNode{ok: true}
+	for _, child := range n.Children() {
+		if len(child.Children()) == 0 {
+			continue
+		}
+		if _, ok := p.printFlat(child); !ok {
+			// n contains child, newlines and all.
+			f.ok = false
+			break
+		}
+	}
+	if f.ok {
+		f.s = p.printScratch(n)
+		if strings.Contains(f.s, "\n") {
+			f = flatNode{}
+		}
+	}
+	p.flat[n] = f
+	return f.s, f.ok
+}
+
+// forgetFlat removes the cached flat renderings of n and the nodes which
+// contain it. It is called when the children of n are changed during
+// printing.
+func (p *Printer) forgetFlat(n parse.Node) {
+	for ; n != nil; n = n.Parent() {
+		delete(p.flat, n)
+	}
+}
+
+// printScratch renders n, as if it began at the start of a line, using a
+// scratch Printer with p's settings.
+func (p *Printer) printScratch(n parse.Node) string {
+	var buf bytes.Buffer
+	scratch := &Printer{
+		bufWriter:         &bufWriter{bw: bufio.NewWriter(&buf)},
+		IndentChar:        p.IndentChar,
+		IndentWidth:       p.IndentWidth,
+		indentStyles:      p.indentStyles,
+		threadFirstStyles: p.threadFirstStyles,
+		bodyPrefixes:      p.bodyPrefixes,
+		defnLike:          p.defnLike,
+		IndentArityBodies: p.IndentArityBodies,
+		specialIndent:     make(map[parse.Node]IndentStyle),
+		threadFirst:       make(map[parse.Node]struct{}),
+		docstrings:        make(map[*parse.StringNode]struct{}),
+		valuePads:         make(map[parse.Node]int),
+		requires:          p.requires,
+		refers:            p.refers,
+		flat:              p.flat,
+		reuseFlat:         p.flat,
+	}
+	scratch.printNode(n, 0)
+	if err := scratch.bw.Flush(); err != nil {
+		panic(bufErr{err})
+	}
+	return buf.String()
+}
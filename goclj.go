@@ -70,17 +70,25 @@ func Keyword(node parse.Node) bool {
 	return ok
 }
 
+func Comma(node parse.Node) bool {
+	_, ok := node.(*parse.CommaNode)
+	return ok
+}
+
 func Comment(node parse.Node) bool {
 	_, ok := node.(*parse.CommentNode)
 	return ok
 }
 
 // Semantic returns whether a node changes the semantics of the code.
-// NOTE: right now this is only used for let indenting.
-// It might have to be adjusted if used for other purposes.
+// Metadata and tags are not counted: the parser keeps them as separate nodes
+// preceding the form they annotate, and they are not values themselves, so
+// (for pairing up bindings and the like) ^:x foo counts as the one form foo.
+// This differs from the parser, which treats them as forms of their own.
 func Semantic(node parse.Node) bool {
 	switch node.(type) {
-	case *parse.NewlineNode, *parse.CommentNode, *parse.MetadataNode, *parse.TagNode:
+	case *parse.NewlineNode, *parse.CommaNode, *parse.CommentNode, *parse.MetadataNode, *parse.TagNode,
+		*parse.ShebangNode:
 		return false
 	}
 	return true
@@ -0,0 +1,210 @@
+package parse
+
+// Clone returns a deep copy of n. The copy shares no nodes or positions with
+// n, and the parent pointers within it refer to the copied nodes. The parent
+// of the returned node is nil.
+func Clone(n Node) Node {
+	if n == nil {
+		return nil
+	}
+	switch n := n.(type) {
+	case *BoolNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *CharacterNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *CommaNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *CommentNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *DerefNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *FnLiteralNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	case *KeywordNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *ListNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	case *MapNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	case *MetadataNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *NewlineNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *NilNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *NumberNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *QuoteNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *ReaderCondNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	case *ReaderCondSpliceNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	case *ReaderDiscardNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *ReaderEvalNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *RegexNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *SetNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	case *ShebangNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *StringNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *SymbolNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *SyntaxQuoteNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *TagNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *UnquoteNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *UnquoteSpliceNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Node = cloneChild(n.Node, &c)
+		return &c
+	case *VarQuoteNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		return &c
+	case *VectorNode:
+		c := *n
+		c.Pos = clonePos(n.Pos)
+		c.parent = nil
+		c.Nodes = cloneChildren(n.Nodes, &c)
+		return &c
+	}
+	panicf("Clone called on unknown node type %T", n)
+	panic("unreached")
+}
+
+// Clone returns a deep copy of t. Transforming or otherwise modifying the
+// copy does not affect t.
+func (t *Tree) Clone() *Tree {
+	t2 := &Tree{Roots: make([]Node, len(t.Roots))}
+	for i, root := range t.Roots {
+		t2.Roots[i] = Clone(root)
+	}
+	return t2
+}
+
+func cloneChild(n, parent Node) Node {
+	c := Clone(n)
+	if c != nil {
+		c.setParent(parent)
+	}
+	return c
+}
+
+func cloneChildren(nodes []Node, parent Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	cs := make([]Node, len(nodes))
+	for i, n := range nodes {
+		cs[i] = cloneChild(n, parent)
+	}
+	return cs
+}
+
+func clonePos(p *Pos) *Pos {
+	if p == nil {
+		return nil
+	}
+	return p.Copy()
+}
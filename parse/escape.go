@@ -0,0 +1,140 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Unescaped decodes the escape sequences in n's value, returning the string
+// that n represents. It understands the same escapes as the Clojure reader:
+// \t, \b, \n, \f, \r, \", \\, \uXXXX, and octal escapes from \0 to \377.
+func (n *StringNode) Unescaped() (string, error) {
+	s := n.Val
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		start := i
+		i++
+		if i == len(s) {
+			return "", n.escapeError(start, "unterminated escape sequence")
+		}
+		c = s[i]
+		i++
+		switch c {
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(c)
+		case 'u':
+			if i+4 > len(s) {
+				return "", n.escapeError(start, "invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(s[i:i+4], 16, 16)
+			if err != nil {
+				return "", n.escapeError(start, fmt.Sprintf("invalid unicode escape \\u%s", s[i:i+4]))
+			}
+			i += 4
+			if utf16.IsSurrogate(rune(r)) && i+6 <= len(s) && s[i:i+2] == `\u` {
+				// A surrogate pair encoding a single character.
+				if r2, err := strconv.ParseUint(s[i+2:i+6], 16, 16); err == nil {
+					if dec := utf16.DecodeRune(rune(r), rune(r2)); dec != utf8.RuneError {
+						b.WriteRune(dec)
+						i += 6
+						continue
+					}
+				}
+			}
+			b.WriteRune(rune(r))
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j < i+2 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			r, _ := strconv.ParseUint(s[i-1:j], 8, 16)
+			if r > 0377 {
+				return "", n.escapeError(start, fmt.Sprintf("octal escape \\%s out of range", s[i-1:j]))
+			}
+			i = j
+			b.WriteRune(rune(r))
+		default:
+			r, _ := utf8.DecodeRuneInString(s[i-1:])
+			return "", n.escapeError(start, fmt.Sprintf("unsupported escape character \\%c", r))
+		}
+	}
+	return b.String(), nil
+}
+
+// escapeError returns an error describing a bad escape sequence starting at
+// byte offset i of n's value.
+func (n *StringNode) escapeError(i int, msg string) error {
+	if n.Pos == nil {
+		return fmt.Errorf("string error: %s", msg)
+	}
+	pos := n.Pos.Copy()
+	// Skip over the opening quote.
+	pos.Offset++
+	pos.Col++
+	for _, c := range n.Val[:i] {
+		w := utf8.RuneLen(c)
+		pos.Offset += w
+		if c == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else {
+			pos.Col += w
+		}
+	}
+	return pos.FormatError("string", msg)
+}
+
+// EscapeString returns s with escape sequences substituted for characters
+// that cannot appear literally inside a Clojure string (or that would be
+// hard to read), suitable for use as the Val of a StringNode.
+// EscapeString(s) is the inverse of Unescaped.
+func EscapeString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
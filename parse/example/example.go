@@ -12,7 +12,7 @@ func main() {
 	if len(os.Args) != 2 {
 		log.Fatalf("usage: %s FILENAME", os.Args[0])
 	}
-	t, err := parse.File(os.Args[1], parse.IncludeNonSemantic)
+	t, err := parse.FileWithComments(os.Args[1])
 	if err != nil {
 		log.Fatal(err)
 	}
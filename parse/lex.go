@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"unicode"
 )
 
@@ -52,6 +53,7 @@ const (
 	tokBacktick     // `
 	tokCharLiteral  // \c, \newline, etc
 	tokCircumflex   // ^
+	tokComma        // , (only emitted if the lexer is asked to keep commas)
 	tokComment      // ; foobar
 	tokDispatch     // any dispatch macro token: #{, #(, #_, etc. Does not include tags.
 	tokKeyword      // :foo
@@ -77,6 +79,7 @@ var tokTypeToName = map[tokType]string{
 	tokBacktick:     "backtick",
 	tokCharLiteral:  "char-literal",
 	tokCircumflex:   "circumflex",
+	tokComma:        "comma",
 	tokComment:      "comment",
 	tokDispatch:     "dispatch",
 	tokEOF:          "eof",
@@ -120,6 +123,12 @@ func (t token) String() string {
 }
 
 // lexer holds the state of the scanner. A single rune of backup is supported.
+//
+// A lexer either runs in its own goroutine, sending tokens over a channel
+// (see lex), or synchronously, running its state functions on demand from
+// nextToken (see lexSync). The goroutine lets a large input be scanned
+// while it is parsed; for a small input, the synchronous lexer avoids the
+// cost of starting the goroutine and passing each token over a channel.
 type lexer struct {
 	name    string // the name of the input source
 	input   *bufio.Reader
@@ -127,21 +136,74 @@ type lexer struct {
 	start   *Pos // the start position of the token being scanned
 	lastPos *Pos // the position before the most recent next() call
 	tokens  chan token
+	done    chan struct{} // closed by stop to end the lexer's goroutine
+	stopped bool
 	val     []rune // the literal contents of the token
+	commas  bool   // whether to emit commas rather than treat them as whitespace
+	recover bool   // whether to keep scanning after an error
+
+	// For a synchronous lexer (tokens is nil):
+	state   stateFn // the next state to run, or nil when the lexer is done
+	pending []token // tokens emitted but not yet returned by nextToken
+}
+
+// syncLexLimit is the largest input, in bytes, for which newLexer returns
+// a synchronous lexer.
+const syncLexLimit = 64 << 10
+
+// newLexer returns a lexer for r: a synchronous one if r is known to be
+// small, and otherwise one which runs in its own goroutine.
+func newLexer(name string, r io.Reader, commas bool) *lexer {
+	if n, ok := inputSize(r); ok && n <= syncLexLimit {
+		return lexSync(name, bufio.NewReader(r), commas)
+	}
+	return lex(name, bufio.NewReader(r), commas)
+}
+
+// inputSize returns the number of bytes remaining in r, if that is cheap
+// to find out.
+func inputSize(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case *maxBytesReader:
+		return inputSize(r.r)
+	case interface{ Len() int }: // bytes.Reader, strings.Reader, etc.
+		return int64(r.Len()), true
+	case *os.File:
+		stat, err := r.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			return 0, false
+		}
+		return stat.Size(), true
+	}
+	return 0, false
 }
 
-func lex(name string, input *bufio.Reader) *lexer {
-	l := &lexer{
+func newLexerState(name string, input *bufio.Reader, commas bool) *lexer {
+	return &lexer{
 		name:   name,
 		input:  input,
+		commas: commas,
 		pos:    &Pos{Name: name, Line: 1, Col: 1},
 		start:  &Pos{Name: name, Line: 1, Col: 1},
-		tokens: make(chan token),
 	}
+}
+
+// lex returns a lexer which scans input in a new goroutine.
+func lex(name string, input *bufio.Reader, commas bool) *lexer {
+	l := newLexerState(name, input, commas)
+	l.tokens = make(chan token)
+	l.done = make(chan struct{})
 	go l.run()
 	return l
 }
 
+// lexSync returns a lexer which scans input as tokens are requested.
+func lexSync(name string, input *bufio.Reader, commas bool) *lexer {
+	l := newLexerState(name, input, commas)
+	l.state = lexOuter
+	return l
+}
+
 type inputReadErr struct {
 	err error
 }
@@ -210,8 +272,44 @@ func (l *lexer) scanUntil(set string) {
 	}
 }
 
+// lexStopped is the panic value used to unwind the lexer's goroutine
+// once the lexer has been stopped.
+type lexStopped struct{}
+
+// send delivers tok to the consumer of the lexer's tokens.
+func (l *lexer) send(tok token) {
+	if !l.trySend(tok) {
+		panic(lexStopped{})
+	}
+}
+
+// trySend is like send, but it returns false, rather than panicking, if
+// the lexer has been stopped.
+func (l *lexer) trySend(tok token) bool {
+	if l.tokens == nil {
+		l.pending = append(l.pending, tok)
+		return true
+	}
+	select {
+	case l.tokens <- tok:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// stop tells the lexer that no more tokens will be read, so that its
+// goroutine (if any) exits rather than blocking forever. It is safe to
+// call stop more than once, and after the lexer has finished.
+func (l *lexer) stop() {
+	if l.done != nil && !l.stopped {
+		l.stopped = true
+		close(l.done)
+	}
+}
+
 func (l *lexer) emit(typ tokType) {
-	l.tokens <- token{typ, l.start, string(l.val)}
+	l.send(token{typ, l.start, string(l.val)})
 	l.skip()
 }
 
@@ -221,23 +319,67 @@ func (l *lexer) skip() {
 }
 
 func (l *lexer) synth(typ tokType, val string) {
-	l.tokens <- token{typ, l.start, val}
+	l.send(token{typ, l.start, val})
 }
 
 func (l *lexer) nextToken() token {
-	return <-l.tokens
+	if l.tokens != nil {
+		return <-l.tokens
+	}
+	for len(l.pending) == 0 {
+		if l.state == nil {
+			// Like receiving from the closed channel.
+			return token{}
+		}
+		l.step()
+	}
+	tok := l.pending[0]
+	if len(l.pending) == 1 {
+		l.pending = l.pending[:0] // reuse the space
+	} else {
+		l.pending = l.pending[1:]
+	}
+	return tok
+}
+
+// nextTokenDone is like nextToken, but it returns false if done is closed
+// before a token is available.
+func (l *lexer) nextTokenDone(done <-chan struct{}) (token, bool) {
+	if l.tokens == nil {
+		select {
+		case <-done:
+			return token{}, false
+		default:
+			return l.nextToken(), true
+		}
+	}
+	select {
+	case tok := <-l.tokens:
+		return tok, true
+	case <-done:
+		return token{}, false
+	}
 }
 
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.tokens <- token{tokError, l.start, fmt.Sprintf(format, args...)}
+	l.send(token{tokError, l.start, fmt.Sprintf(format, args...)})
+	if l.recover {
+		// Drop the bad token and carry on.
+		l.skip()
+		return lexOuter
+	}
 	return nil
 }
 
 func (l *lexer) scanError(err error) stateFn {
-	l.tokens <- token{tokError, l.start, fmt.Sprintf("error while scanning: %s", err)}
+	l.send(l.scanErrorToken(err))
 	return nil
 }
 
+func (l *lexer) scanErrorToken(err error) token {
+	return token{tokError, l.start, fmt.Sprintf("error while scanning: %s", err)}
+}
+
 func (l *lexer) eof() stateFn {
 	l.emit(tokEOF)
 	return nil
@@ -249,11 +391,13 @@ type stateFn func(*lexer) stateFn
 func (l *lexer) run() {
 	defer func() {
 		if e := recover(); e != nil {
-			if e2, ok := e.(inputReadErr); ok {
-				l.scanError(e2.err)
-				return
+			switch e := e.(type) {
+			case lexStopped:
+			case inputReadErr:
+				l.trySend(l.scanErrorToken(e.err))
+			default:
+				panic(e)
 			}
-			panic(e)
 		}
 	}()
 
@@ -262,6 +406,21 @@ func (l *lexer) run() {
 	close(l.tokens)
 }
 
+// step runs the synchronous lexer's next state.
+func (l *lexer) step() {
+	defer func() {
+		if e := recover(); e != nil {
+			if e2, ok := e.(inputReadErr); ok {
+				l.scanError(e2.err)
+				l.state = nil
+				return
+			}
+			panic(e)
+		}
+	}()
+	l.state = l.state(l)
+}
+
 func lexOuter(l *lexer) stateFn {
 	r, eof := l.next()
 	if eof {
@@ -321,6 +480,11 @@ func lexOuter(l *lexer) stateFn {
 		l.emit(tokTilde)
 	case '\n':
 		l.emit(tokNewline)
+	case ',':
+		if !l.commas {
+			return lexWhitespace
+		}
+		l.emit(tokComma)
 	default:
 		goto afterSingles
 	}
@@ -339,7 +503,9 @@ afterSingles:
 }
 
 func lexWhitespace(l *lexer) stateFn {
-	l.scanWhile(isWhitespaceNotNL)
+	l.scanWhile(func(r rune) bool {
+		return isWhitespaceNotNL(r) && !(l.commas && r == ',')
+	})
 	l.skip()
 	return lexOuter
 }
@@ -414,6 +580,9 @@ func lexDispatch(l *lexer) stateFn {
 	// is emitted as a keyword token (including the leading :).
 	// So "#:foo{:bar 1}" is tokenized as "#:", ":foo", "{", "bar", 1, "}".
 	//
+	// The symbolic values ##Inf, ##-Inf, and ##NaN are emitted as single
+	// number tokens.
+	//
 	// Otherwise, the dispatch token is two chars and the following token is
 	// distinct.
 	r, eof := l.next()
@@ -452,15 +621,22 @@ func lexDispatch(l *lexer) stateFn {
 		l.synth(tokDispatch, val)
 		l.skip()
 		return lexOuter
+	case '#':
+		l.scanWhile(isSymbolChar)
+		switch val := string(l.val); val {
+		case "##Inf", "##-Inf", "##NaN":
+			l.emit(tokNumber)
+		default:
+			return l.errorf("invalid symbolic value %q", val)
+		}
 	case '!':
 		// #! is a reader dispatch macro for comments.
 		return lexComment
 	case '<':
 		// #< is the 'unreadable' reader dispatch macro.
-		l.errorf("unreadable dispatch macro")
+		return l.errorf("unreadable dispatch macro")
 	default:
 		l.back()
-		l.skip()
 		l.emit(tokOctothorpe)
 	}
 	return lexOuter
@@ -0,0 +1,98 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A Lexer splits Clojure source into a stream of Tokens.
+type Lexer struct {
+	lex *lexer
+	err error
+}
+
+// NewLexer creates a Lexer which reads from r. The name is used in the
+// positions of tokens and errors. The only ParseOpts flag which affects
+// lexing is IncludeCommas: if it is set, each comma is emitted as a
+// TokenComma; otherwise commas are treated as whitespace.
+func NewLexer(r io.Reader, name string, opts ParseOpts) *Lexer {
+	return &Lexer{lex: newLexer(name, r, opts&IncludeCommas != 0)}
+}
+
+// Next returns the next token in the stream. At the end of the input, Next
+// returns io.EOF. If the input cannot be tokenized, Next returns an error
+// describing the problem; once Next has returned an error, every subsequent
+// call returns the same error.
+func (l *Lexer) Next() (Token, error) {
+	if l.err != nil {
+		return Token{}, l.err
+	}
+	tok := l.lex.nextToken()
+	switch tok.typ {
+	case tokEOF:
+		l.err = io.EOF
+		return Token{}, l.err
+	case tokError:
+		l.err = tok.AsError()
+		return Token{}, l.err
+	}
+	return Token{Type: TokenType(tok.typ), Pos: tok.pos, Val: tok.val}, nil
+}
+
+// Close stops l. A caller which stops calling Next before it has returned
+// an error (including io.EOF) should call Close so that l stops reading its
+// input. After Close, Next returns ErrLexerClosed (unless it had already
+// returned an error).
+func (l *Lexer) Close() {
+	l.lex.stop()
+	if l.err == nil {
+		l.err = ErrLexerClosed
+	}
+}
+
+// ErrLexerClosed is returned by Lexer.Next after the Lexer is closed.
+var ErrLexerClosed = errors.New("parse: Lexer is closed")
+
+// A Token is a single lexeme. Val is the literal text of the token, except
+// for a dispatch token, for which Val is the dispatch macro (such as "#{",
+// "#?@", or "#_") while the delimiter that follows it, if any, is repeated
+// as the next token.
+type Token struct {
+	Type TokenType
+	Pos  *Pos
+	Val  string
+}
+
+func (t Token) String() string {
+	return fmt.Sprintf("%s(%q)@%s", t.Type, t.Val, t.Pos)
+}
+
+// A TokenType identifies the kind of a Token.
+type TokenType int
+
+const (
+	TokenApostrophe   = TokenType(tokApostrophe)   // '
+	TokenAtSign       = TokenType(tokAtSign)       // @
+	TokenBacktick     = TokenType(tokBacktick)     // `
+	TokenCharLiteral  = TokenType(tokCharLiteral)  // \c, \newline, etc
+	TokenCircumflex   = TokenType(tokCircumflex)   // ^
+	TokenComma        = TokenType(tokComma)        // , (only with IncludeCommas)
+	TokenComment      = TokenType(tokComment)      // ; foobar
+	TokenDispatch     = TokenType(tokDispatch)     // #{, #(, #_, etc. (not tags)
+	TokenKeyword      = TokenType(tokKeyword)      // :foo
+	TokenLeftBrace    = TokenType(tokLeftBrace)    // {
+	TokenLeftBracket  = TokenType(tokLeftBracket)  // [
+	TokenLeftParen    = TokenType(tokLeftParen)    // (
+	TokenNumber       = TokenType(tokNumber)       // any numeric literal; may be invalid
+	TokenOctothorpe   = TokenType(tokOctothorpe)   // # (only used for tags)
+	TokenRightBrace   = TokenType(tokRightBrace)   // }
+	TokenRightBracket = TokenType(tokRightBracket) // ]
+	TokenRightParen   = TokenType(tokRightParen)   // )
+	TokenString       = TokenType(tokString)       // string literal, including quotes
+	TokenSymbol       = TokenType(tokSymbol)       // foo, also lambda args (%, %N)
+	TokenTilde        = TokenType(tokTilde)        // ~
+	TokenNewline      = TokenType(tokNewline)      // \n
+)
+
+func (t TokenType) String() string { return tokType(t).String() }
@@ -1,6 +1,9 @@
 package parse
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type Node interface {
 	Position() *Pos
@@ -45,6 +48,17 @@ func (n *CharacterNode) setParent(p Node)   { n.parent = p }
 func (n *CharacterNode) Children() []Node   { return nil }
 func (n *CharacterNode) SetChildren([]Node) { panic("SetChildren called on CharacterNode") }
 
+type CommaNode struct {
+	*Pos
+	parent Node
+}
+
+func (n *CommaNode) String() string     { return "comma" }
+func (n *CommaNode) Parent() Node       { return n.parent }
+func (n *CommaNode) setParent(p Node)   { n.parent = p }
+func (n *CommaNode) Children() []Node   { return nil }
+func (n *CommaNode) SetChildren([]Node) { panic("SetChildren called on CommaNode") }
+
 type CommentNode struct {
 	*Pos
 	parent Node
@@ -125,6 +139,16 @@ func (n *MapNode) String() string {
 	semanticNodes := countSemantic(n.Nodes)
 	return fmt.Sprintf("map(%slength=%d)", ns, semanticNodes/2)
 }
+
+// AutoResolved reports whether n is an auto-resolved namespaced map:
+// either #::{...}, which uses the current namespace, or #::alias{...}.
+func (n *MapNode) AutoResolved() bool { return strings.HasPrefix(n.Namespace, "::") }
+
+// NamespaceName returns the namespace of n without its leading colons:
+// foo for #:foo{...} and alias for #::alias{...}. It returns "" if n is
+// not a namespaced map or if it is #::{...}.
+func (n *MapNode) NamespaceName() string { return strings.TrimLeft(n.Namespace, ":") }
+
 func (n *MapNode) Parent() Node     { return n.parent }
 func (n *MapNode) setParent(p Node) { n.parent = p }
 func (n *MapNode) Children() []Node { return n.Nodes }
@@ -234,6 +258,22 @@ func (n *StringNode) setParent(p Node)   { n.parent = p }
 func (n *StringNode) Children() []Node   { return nil }
 func (n *StringNode) SetChildren([]Node) { panic("SetChildren called on StringNode") }
 
+// End returns the position just after the closing quote of n. Since Val is
+// the string as written, a string containing newlines ends on a later line
+// than it starts.
+func (n *StringNode) End() *Pos {
+	end := n.Pos.Copy()
+	s := `"` + n.Val + `"`
+	end.Offset += len(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		end.Line += strings.Count(s, "\n")
+		end.Col = len(s) - i
+	} else {
+		end.Col += len(s)
+	}
+	return end
+}
+
 type SyntaxQuoteNode struct {
 	*Pos
 	parent Node
@@ -475,9 +515,28 @@ func (n *TagNode) setParent(p Node)   { n.parent = p }
 func (n *TagNode) Children() []Node   { return nil }
 func (n *TagNode) SetChildren([]Node) { panic("SetChildren called on TagNode") }
 
+// A ShebangNode is a #! line at the very beginning of the input, as in
+// #!/usr/bin/env bb. (A #! line anywhere else is a CommentNode.)
+type ShebangNode struct {
+	*Pos
+	parent Node
+	Text   string
+}
+
+func (n *ShebangNode) String() string     { return fmt.Sprintf("shebang(%q)", n.Text) }
+func (n *ShebangNode) Parent() Node       { return n.parent }
+func (n *ShebangNode) setParent(p Node)   { n.parent = p }
+func (n *ShebangNode) Children() []Node   { return nil }
+func (n *ShebangNode) SetChildren([]Node) { panic("SetChildren called on ShebangNode") }
+
+// isSemantic reports whether n is part of the code rather than whitespace
+// or a comment. Unlike goclj.Semantic, it counts metadata and tags. Because
+// they are separate nodes, the target of a prefix such as ' is the metadata
+// itself when the form is annotated: '^:x foo is a QuoteNode holding the
+// metadata :x, followed by foo as a sibling.
 func isSemantic(n Node) bool {
 	switch n.(type) {
-	case *CommentNode, *NewlineNode:
+	case *CommaNode, *CommentNode, *NewlineNode, *ShebangNode:
 		return false
 	}
 	return true
@@ -1,8 +1,8 @@
 package parse
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -15,14 +15,76 @@ type Tree struct {
 
 	// Config
 	includeNonSemantic  bool
+	includeCommas       bool
 	ignoreCommentForm   bool
 	ignoreReaderDiscard bool
+	ignoreMetadata      bool
+	ignoreTag           bool
+	recoverErrors       bool
 
 	// Parser state
 	tok       token // single-item lookahead
 	peekCount int
+	pushed    []token // a stack of tokens to be read again (see parsePrefixed)
+	// discarded is the number of forms following a stacked discard
+	// (#_ #_ a b) that parsePrefixed must still skip.
+	discarded int
 	lex       *lexer
+	ctx       context.Context
 	inLambda  bool
+	depth     int
+	maxDepth  int
+	nodes     int // the number of nodes begun so far
+	maxNodes  int
+	bytes     *maxBytesReader // non-nil if there is a MaxBytes limit
+}
+
+// MaxDepth is the deepest nesting of forms that Reader and File accept.
+// Input nested more deeply than this gives a parse error rather than
+// exhausting the stack (here or in code that walks the tree recursively).
+var MaxDepth = 10000
+
+// ParseLimits bounds the resources used to parse an input (see
+// ReaderLimits). A zero field means that there is no limit (or, for
+// MaxDepth, that the package's MaxDepth applies).
+//
+// Exceeding MaxBytes or MaxNodes ends the parse, even with RecoverErrors.
+// Exceeding MaxDepth only spoils the form which is nested too deeply.
+type ParseLimits struct {
+	// MaxBytes is the largest input accepted.
+	MaxBytes int64
+	// MaxNodes is the most nodes that the input may contain. Comments
+	// and newlines count even if they are not included in the tree.
+	MaxNodes int
+	// MaxDepth is the deepest nesting of forms accepted.
+	MaxDepth int
+}
+
+// maxBytesReader reads from r, failing if it has more than max bytes.
+type maxBytesReader struct {
+	r        io.Reader
+	max      int64
+	n        int64 // the number of bytes read so far
+	exceeded bool
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.n >= r.max {
+		// Check whether there is any more input.
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			r.exceeded = true
+			return 0, fmt.Errorf("input is larger than %d bytes", r.max)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.max-r.n {
+		p = p[:r.max-r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
 }
 
 // String pretty-prints the tree recursively using each Node's String().
@@ -40,30 +102,155 @@ func nodesToString(nodes []Node, depth int) string {
 }
 
 func (t *Tree) parse() (err error) {
-	defer t.recover(&err)
-	var linkParents func(Node)
-	linkParents = func(n Node) {
-		for _, c := range n.Children() {
-			c.setParent(n)
-			linkParents(c)
-		}
+	if t.recoverErrors {
+		return t.parseRecovering()
 	}
+	defer t.recover(&err)
 	for {
 		node := t.parseNext()
 		if node == nil {
 			break
 		}
-		linkParents(node)
-		if t.includeNode(node) {
-			t.Roots = append(t.Roots, node)
+		t.addRoot(node)
+	}
+	return nil
+}
+
+// parseRecovering is like parse, but when it encounters an error it records
+// it, skips ahead to the next top-level form, and continues. It returns an
+// ErrorList if there were any errors.
+func (t *Tree) parseRecovering() error {
+	var errs ErrorList
+	for {
+		node, err := t.tryParseNext()
+		if err != nil {
+			errs = append(errs, err)
+			if !t.skipToTopLevel(&errs) {
+				break
+			}
+			continue
 		}
+		if node == nil {
+			break
+		}
+		t.addRoot(node)
+	}
+	if len(errs) > 0 {
+		return errs
 	}
 	return nil
 }
 
+func (t *Tree) tryParseNext() (node Node, err error) {
+	defer t.recover(&err)
+	return t.parseNext(), nil
+}
+
+// skipToTopLevel discards tokens until it finds one which may begin a
+// top-level form: that is, a token in the first column which is not a
+// closing delimiter. Lex errors found along the way are added to errs.
+// It returns false if it reaches EOF first. The state of the form which was
+// abandoned (such as being inside a fn literal) is reset.
+func (t *Tree) skipToTopLevel(errs *ErrorList) bool {
+	t.peekCount = 0
+	t.pushed = t.pushed[:0]
+	t.discarded = 0
+	t.inLambda = false
+	for {
+		tok := t.lexToken()
+		switch tok.typ {
+		case tokEOF:
+			return false
+		case tokError:
+			*errs = append(*errs, tok.AsError())
+			continue
+		case tokNewline, tokRightParen, tokRightBracket, tokRightBrace:
+			continue
+		}
+		if tok.pos.Col == 1 {
+			t.tok = tok
+			t.peekCount = 1
+			return true
+		}
+	}
+}
+
+func (t *Tree) addRoot(node Node) {
+	if c, ok := node.(*CommentNode); ok && c.Offset == 0 && strings.HasPrefix(c.Text, "#!") {
+		node = &ShebangNode{Pos: c.Pos, Text: c.Text}
+	}
+	linkParents(node)
+	if t.includeNode(node) {
+		t.Roots = append(t.Roots, node)
+	}
+}
+
+func linkParents(n Node) {
+	for _, c := range n.Children() {
+		c.setParent(n)
+		linkParents(c)
+	}
+}
+
+// An ErrorList is the list of errors returned by Reader and File when
+// parsing with RecoverErrors.
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
 type lexError struct{ err error }
 type parseError struct{ err error }
 
+// canceled is the panic value used when the Tree's context is done. Unlike
+// lexError and parseError, it is not caught by recover, so that it ends a
+// parse even with RecoverErrors.
+type canceled struct{ err error }
+
+// limitExceeded is the panic value used when the input exceeds MaxBytes or
+// MaxNodes. Like canceled, it is not caught by recover: with RecoverErrors,
+// the parse would otherwise go on to read (and fail on) the rest of the
+// input, which is what the limits are meant to prevent.
+type limitExceeded struct{ err error }
+
+// parseContext is like parse, but it returns the context's error if the
+// context is done before parsing finishes (and the error for an exceeded
+// limit, whether or not errors are recovered).
+func (t *Tree) parseContext() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			switch e := e.(type) {
+			case canceled:
+				err = e.err
+			case limitExceeded:
+				err = e.err
+			default:
+				panic(e)
+			}
+		}
+	}()
+	return t.parse()
+}
+
+// lexToken returns the lexer's next token.
+func (t *Tree) lexToken() token {
+	tok, ok := t.lex.nextTokenDone(t.ctx.Done())
+	if !ok {
+		panic(canceled{t.ctx.Err()})
+	}
+	if tok.typ == tokError && t.bytes != nil && t.bytes.exceeded {
+		panic(limitExceeded{tok.AsError()})
+	}
+	return tok
+}
+
 func (t *Tree) recover(err *error) {
 	if e := recover(); e != nil {
 		switch e := e.(type) {
@@ -78,7 +265,7 @@ func (t *Tree) recover(err *error) {
 }
 
 func (t *Tree) nextToken() token {
-	tok := t.lex.nextToken()
+	tok := t.lexToken()
 	if tok.typ == tokError {
 		panic(lexError{tok.AsError()})
 	}
@@ -88,6 +275,9 @@ func (t *Tree) nextToken() token {
 func (t *Tree) next() token {
 	if t.peekCount > 0 {
 		t.peekCount--
+	} else if n := len(t.pushed); n > 0 {
+		t.tok = t.pushed[n-1]
+		t.pushed = t.pushed[:n-1]
 	} else {
 		t.tok = t.nextToken()
 	}
@@ -122,16 +312,69 @@ const (
 	IgnoreCommentForm
 	// IgnoreReaderDiscard makes the parser ignore forms preceded by #_.
 	IgnoreReaderDiscard
+	// IncludeCommas makes the parser include CommaNodes. (Clojure treats
+	// commas as whitespace, so they are otherwise discarded.)
+	IncludeCommas
+	// RecoverErrors makes the parser continue after a syntax error rather
+	// than stopping. The form containing the error is dropped and parsing
+	// resumes at the next top-level form (the next token in the first
+	// column). Reader and File then return the partial tree along with an
+	// ErrorList of all the errors encountered.
+	RecoverErrors
+	// IgnoreMetadata makes the parser drop metadata, such as the ^:x in
+	// ^:x foo, keeping only the form it is attached to.
+	IgnoreMetadata
+	// IgnoreTag makes the parser drop the tags of tagged literals, such
+	// as the #inst in #inst "2020-01-01", keeping only the tagged form.
+	IgnoreTag
 )
 
 func Reader(r io.Reader, filename string, opts ParseOpts) (*Tree, error) {
+	return ReaderContext(context.Background(), r, filename, opts)
+}
+
+// ReaderContext is like Reader, but it gives up and returns ctx.Err() if
+// ctx is done before parsing is finished. (A Read call on r which is in
+// progress when ctx is done is not interrupted.)
+func ReaderContext(ctx context.Context, r io.Reader, filename string, opts ParseOpts) (*Tree, error) {
+	return ReaderLimits(ctx, r, filename, opts, ParseLimits{})
+}
+
+// ReaderLimits is like ReaderContext, but it fails with an error if the
+// input exceeds any of the given limits.
+func ReaderLimits(ctx context.Context, r io.Reader, filename string, opts ParseOpts, limits ParseLimits) (*Tree, error) {
+	var bytes *maxBytesReader
+	if limits.MaxBytes > 0 {
+		bytes = &maxBytesReader{r: r, max: limits.MaxBytes}
+		r = bytes
+	}
+	maxDepth := MaxDepth
+	if limits.MaxDepth > 0 {
+		maxDepth = limits.MaxDepth
+	}
 	t := &Tree{
+		ctx:                 ctx,
+		maxDepth:            maxDepth,
+		maxNodes:            limits.MaxNodes,
+		bytes:               bytes,
 		includeNonSemantic:  opts&IncludeNonSemantic != 0,
+		includeCommas:       opts&IncludeCommas != 0,
 		ignoreCommentForm:   opts&IgnoreCommentForm != 0,
 		ignoreReaderDiscard: opts&IgnoreReaderDiscard != 0,
-		lex:                 lex(filename, bufio.NewReader(r)),
-	}
-	if err := t.parse(); err != nil {
+		ignoreMetadata:      opts&IgnoreMetadata != 0,
+		ignoreTag:           opts&IgnoreTag != 0,
+		recoverErrors:       opts&RecoverErrors != 0,
+		lex:                 newLexer(filename, r, opts&IncludeCommas != 0),
+	}
+	if t.recoverErrors {
+		t.lex.recover = true
+	}
+	// The parse may stop (at an error) before the lexer is done.
+	defer t.lex.stop()
+	if err := t.parseContext(); err != nil {
+		if _, ok := err.(ErrorList); ok && t.recoverErrors {
+			return t, err
+		}
 		return nil, err
 	}
 	return t, nil
@@ -146,11 +389,37 @@ func File(filename string, opts ParseOpts) (*Tree, error) {
 	return Reader(f, filename, opts)
 }
 
+// FileWithComments parses a file, including the non-semantic nodes
+// (comments and newlines) in the tree. It is the same as
+// File(filename, IncludeNonSemantic).
+func FileWithComments(filename string) (*Tree, error) {
+	return File(filename, IncludeNonSemantic)
+}
+
+// FileSemanticOnly parses a file, leaving comments and newlines out of the
+// tree. It is the same as File(filename, 0).
+func FileSemanticOnly(filename string) (*Tree, error) {
+	return File(filename, 0)
+}
+
 // parseNext parses the next top-level item from the token stream.
 // It returns nil if there are no non-EOF tokens left in the stream.
 func (t *Tree) parseNext() Node {
+	t.depth++
+	defer func() { t.depth-- }()
 	for {
-		switch tok := t.next(); tok.typ {
+		tok := t.next()
+		if tok.typ != tokEOF {
+			if t.depth > t.maxDepth {
+				t.errorf(tok.pos, "forms are nested more than %d deep", t.maxDepth)
+			}
+			t.nodes++
+			if t.maxNodes > 0 && t.nodes > t.maxNodes {
+				msg := fmt.Sprintf("input has more than %d nodes", t.maxNodes)
+				panic(limitExceeded{tok.pos.FormatError("parse", msg)})
+			}
+		}
+		switch tok.typ {
 		case tokSymbol:
 			switch val := tok.val; val {
 			case "nil":
@@ -165,7 +434,7 @@ func (t *Tree) parseNext() Node {
 		case tokComment:
 			return &CommentNode{Pos: tok.pos, Text: tok.val}
 		case tokAtSign:
-			return &DerefNode{Pos: tok.pos, Node: t.parseNextSemantic()}
+			return t.parsePrefixed(func(n Node) Node { return &DerefNode{Pos: tok.pos, Node: n} }, tok)
 		case tokKeyword:
 			return &KeywordNode{Pos: tok.pos, Val: tok.val}
 		case tokLeftParen:
@@ -176,25 +445,27 @@ func (t *Tree) parseNext() Node {
 			return t.parseMetadata(tok)
 		case tokNewline:
 			return &NewlineNode{Pos: tok.pos}
+		case tokComma:
+			return &CommaNode{Pos: tok.pos}
 		case tokNumber:
 			// TODO: need to parse the number here; a number token may not be valid.
 			return &NumberNode{Pos: tok.pos, Val: tok.val}
 		case tokApostrophe:
-			return &QuoteNode{Pos: tok.pos, Node: t.parseNextSemantic()}
+			return t.parsePrefixed(func(n Node) Node { return &QuoteNode{Pos: tok.pos, Node: n} }, tok)
 		case tokString:
 			return &StringNode{Pos: tok.pos, Val: tok.val[1 : len(tok.val)-1]}
 		case tokBacktick:
-			return &SyntaxQuoteNode{Pos: tok.pos, Node: t.parseNextSemantic()}
+			return t.parsePrefixed(func(n Node) Node { return &SyntaxQuoteNode{Pos: tok.pos, Node: n} }, tok)
 		case tokTilde:
 			next := t.next()
 			switch next.typ {
 			case tokAtSign:
-				return &UnquoteSpliceNode{Pos: tok.pos, Node: t.parseNextSemantic()}
+				return t.parsePrefixed(func(n Node) Node { return &UnquoteSpliceNode{Pos: tok.pos, Node: n} }, tok, next)
 			case tokEOF:
 				t.unexpectedEOF(next)
 			}
 			t.backup()
-			return &UnquoteNode{Pos: tok.pos, Node: t.parseNextSemantic()}
+			return t.parsePrefixed(func(n Node) Node { return &UnquoteNode{Pos: tok.pos, Node: n} }, tok)
 		case tokLeftBracket:
 			return t.parseVector(tok)
 		case tokDispatch:
@@ -210,6 +481,35 @@ func (t *Tree) parseNext() Node {
 	}
 }
 
+// parsePrefixed parses the target of a prefix such as ' or @ (made of the
+// tokens prefix) and returns wrap(target). The reader skips discarded forms
+// when looking for the target, so a discard in between, as in '#_a b, is
+// returned by itself and the prefix is read again afterward, attaching it
+// to b. (Likewise for the forms discarded by a stacked discard, and for a
+// comment, as in ' ; c\nb.)
+func (t *Tree) parsePrefixed(wrap func(Node) Node, prefix ...token) Node {
+	n := t.parseNextTarget()
+	if _, ok := n.(*CommentNode); ok {
+		t.pushBack(n, prefix...)
+		return n
+	}
+	if t.discarded > 0 {
+		t.discarded--
+	} else if d, ok := n.(*ReaderDiscardNode); ok {
+		if !t.ignoreReaderDiscard {
+			// The stacked discards were not consumed by
+			// parseReaderDiscard.
+			for inner, ok := d.Node.(*ReaderDiscardNode); ok; inner, ok = inner.Node.(*ReaderDiscardNode) {
+				t.discarded++
+			}
+		}
+	} else {
+		return wrap(n)
+	}
+	t.pushBack(n, prefix...)
+	return n
+}
+
 // parseNextSemantic parses the next top-level semantically meaningful item from
 // the token stream. It expects that such an item exists; if it reaches EOF
 // before such an item is found, it gives an unexpected EOF error.
@@ -220,12 +520,53 @@ func (t *Tree) parseNextSemantic() Node {
 		}
 		t.backup()
 		n := t.parseNext()
-		if isSemantic(n) {
+		if isSemantic(n) && !t.ignoreAnnotation(n) {
+			return n
+		}
+	}
+}
+
+// parseNextTarget is like parseNextSemantic, but if comments are kept in the
+// tree, it also stops at a comment (which the caller keeps as a sibling of
+// the form it is parsing).
+func (t *Tree) parseNextTarget() Node {
+	for {
+		if next := t.next(); next.typ == tokEOF {
+			t.unexpectedEOF(next)
+		}
+		t.backup()
+		n := t.parseNext()
+		if _, ok := n.(*CommentNode); ok && t.includeNonSemantic {
+			return n
+		}
+		if isSemantic(n) && !t.ignoreAnnotation(n) {
 			return n
 		}
 	}
 }
 
+// pushBack arranges for the tokens prefix to be read again after n, which
+// was parsed in place of the prefix's target. If n is a comment, the prefix
+// is read after the newline that ends it.
+func (t *Tree) pushBack(n Node, prefix ...token) {
+	var newline []token
+	if _, ok := n.(*CommentNode); ok {
+		if tok := t.next(); tok.typ == tokNewline {
+			newline = append(newline, tok)
+		} else {
+			t.backup()
+		}
+	}
+	if t.peekCount > 0 {
+		t.pushed = append(t.pushed, t.tok)
+		t.peekCount = 0
+	}
+	for i := len(prefix) - 1; i >= 0; i-- {
+		t.pushed = append(t.pushed, prefix[i])
+	}
+	t.pushed = append(t.pushed, newline...)
+}
+
 func (t *Tree) parseCharLiteral(tok token) *CharacterNode {
 	var r rune
 	val := tok.val[1:]
@@ -246,14 +587,15 @@ func (t *Tree) parseCharLiteral(tok token) *CharacterNode {
 		case "formfeed":
 			r = '\f'
 		case "backspace":
-			r = 0x7f
+			r = '\b'
 		case "return":
 			r = '\r'
 		default:
 			switch runes[0] {
 			case 'o':
+				// Like Clojure, allow 1-3 digits up to \o377.
 				n, err := strconv.ParseInt(val[1:], 8, 32)
-				if len(val) != 4 || err != nil || n < 0 {
+				if len(val) > 4 || err != nil || n < 0 || n > 0377 {
 					t.errorf(tok.pos, "invalid octal literal")
 				}
 				r = rune(n)
@@ -297,6 +639,9 @@ func (t *Tree) parseMap(start token) *MapNode {
 	for {
 		switch tok := t.next(); tok.typ {
 		case tokRightBrace:
+			if n, ok := countMapForms(nodes); ok && n%2 != 0 {
+				t.errorf(start.pos, "map literal must contain an even number of forms")
+			}
 			return &MapNode{Pos: start.pos, Nodes: nodes}
 		case tokEOF:
 			t.unexpectedEOF(tok)
@@ -309,6 +654,37 @@ func (t *Tree) parseMap(start token) *MapNode {
 	}
 }
 
+// countMapForms counts the forms in the map literal made of nodes. It
+// returns false if the count can't be known before the code is read by
+// Clojure because a reader conditional may add or remove forms.
+func countMapForms(nodes []Node) (int, bool) {
+	n := 0
+	skip := 0 // forms discarded by stacked #_s, as in #_ #_ a b
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *ReaderCondNode, *ReaderCondSpliceNode:
+			return 0, false
+		case *ReaderDiscardNode:
+			for d, ok := node.Node.(*ReaderDiscardNode); ok; d, ok = d.Node.(*ReaderDiscardNode) {
+				skip++
+			}
+			continue
+		case *TagNode, *MetadataNode:
+			// These are part of the following form.
+			continue
+		}
+		if !isSemantic(node) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+		} else {
+			n++
+		}
+	}
+	return n, true
+}
+
 func (t *Tree) parseVector(start token) *VectorNode {
 	var nodes []Node
 	for {
@@ -418,6 +794,12 @@ func (t *Tree) parseNamespacedMap(start token) *MapNode {
 		panic("should not happen")
 	}
 	ns := tok.val
+	// The namespace is :foo, ::alias, or :: (for the current namespace).
+	name := strings.TrimLeft(ns, ":")
+	colons := len(ns) - len(name)
+	if colons > 2 || (colons == 1 && name == "") || strings.ContainsRune(name, '/') {
+		t.errorf(tok.pos, "invalid namespace %s for namespaced map", ns)
+	}
 	tok = t.next()
 	if tok.typ == tokEOF {
 		t.unexpectedEOF(tok)
@@ -439,13 +821,23 @@ func (t *Tree) parseMetadata(start token) *MetadataNode {
 	return &MetadataNode{Pos: start.pos, Node: t.parseNext()}
 }
 
-func (t *Tree) parseReaderDiscard(start token) *ReaderDiscardNode {
-	tok := t.next()
-	if tok.typ == tokEOF {
-		t.unexpectedEOF(tok)
-	}
-	t.backup()
-	return &ReaderDiscardNode{Pos: start.pos, Node: t.parseNext()}
+func (t *Tree) parseReaderDiscard(start token) Node {
+	// The discarded form may be on a later line, as in #_\n(foo).
+	target := t.parseNextTarget()
+	if _, ok := target.(*CommentNode); ok {
+		// In #_ ; c\n(foo), the comment is returned by itself and #_
+		// is read again on the next line.
+		t.pushBack(target, start)
+		return target
+	}
+	n := &ReaderDiscardNode{Pos: start.pos, Node: target}
+	if _, ok := n.Node.(*ReaderDiscardNode); ok && t.ignoreReaderDiscard {
+		// Stacked discards (#_ #_ a b) discard one form each.
+		// Otherwise, the discarded b is left as a sibling of the
+		// outer discard.
+		t.parseNextSemantic()
+	}
+	return n
 }
 
 func (t *Tree) parseReaderEval(start token) *ReaderEvalNode {
@@ -512,8 +904,26 @@ func (t *Tree) includeNode(node Node) bool {
 	if _, ok := node.(*ReaderDiscardNode); ok && t.ignoreReaderDiscard {
 		return false
 	}
+	if t.ignoreAnnotation(node) {
+		return false
+	}
+	if _, ok := node.(*CommaNode); ok {
+		return t.includeCommas
+	}
 	if !t.includeNonSemantic && !isSemantic(node) {
 		return false
 	}
 	return true
 }
+
+// ignoreAnnotation reports whether node is metadata or a tag which is
+// dropped because of IgnoreMetadata or IgnoreTag.
+func (t *Tree) ignoreAnnotation(node Node) bool {
+	switch node.(type) {
+	case *MetadataNode:
+		return t.ignoreMetadata
+	case *TagNode:
+		return t.ignoreTag
+	}
+	return false
+}
@@ -1,10 +1,18 @@
 package parse
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testCases = []struct {
@@ -29,6 +37,9 @@ var testCases = []struct {
 	{"foo", "sym(foo)"},
 	{"'(foobar)", "quote"},
 	{`#"^asdf"`, `regex("^asdf")`},
+	{`#"\""`, `regex("\\\"")`},
+	{`#"a\\b\"c\nd"`, `regex("a\\\\b\\\"c\\nd")`},
+	{"#\"a\nb\"", `regex("a\nb")`},
 	{"#{1 2 3}", "set(length=3)"},
 	{"#?(:clj 1)", "reader-cond(length=2)"},
 	{"#?@(:clj :a :default :b)", "reader-cond-splice(length=4)"},
@@ -46,11 +57,17 @@ var testCases = []struct {
 	// issue 32
 	{"#=foo", "eval"},
 	{"#^foo", "metadata"},
-	{"#! hello!", `comment("#! hello!")`},
+	{"#! hello!", `shebang("#! hello!")`},
+	{" #! hello!", `comment("#! hello!")`},
 
 	// issue 35
 	{"a%b%", "sym(a%b%)"},
 	{":100%>50%", "keyword(:100%>50%)"},
+
+	// symbolic values
+	{"##Inf", "num(##Inf)"},
+	{"##-Inf", "num(##-Inf)"},
+	{"##NaN", "num(##NaN)"},
 }
 
 func TestAll(t *testing.T) {
@@ -118,6 +135,9 @@ func TestIgnoreReaderDiscard(t *testing.T) {
 		{"#_ignore", ""},
 		{"a #_ignore b", "sym(a) sym(b)"},
 		{"[a b #_ignore]", "vector(length=2) sym(a) sym(b)"},
+		{"a #_\nignore b", "sym(a) sym(b)"},
+		{"#_ #_ ignore ignore b", "sym(b)"},
+		{"[#_ #_ ignore\nignore a]", "vector(length=1) sym(a)"},
 	} {
 		tree, err := Reader(strings.NewReader(tc.s), "temp", IgnoreReaderDiscard)
 		if err != nil {
@@ -131,6 +151,83 @@ func TestIgnoreReaderDiscard(t *testing.T) {
 	}
 }
 
+func TestDiscardComment(t *testing.T) {
+	// A comment between #_ and the form it discards is kept as a sibling.
+	for _, tc := range []struct {
+		s    string
+		opts ParseOpts
+		want string
+	}{
+		{"(a #_ ; c\n b c)", IncludeNonSemantic, `list(length=3) sym(a) comment("; c") newline discard sym(b) sym(c)`},
+		{"#_ ; c\n; d\n\na", IncludeNonSemantic, `comment("; c") newline comment("; d") newline discard sym(a)`},
+		{"(a #_ ; c\n b c)", 0, "list(length=3) sym(a) discard sym(b) sym(c)"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", tc.opts)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		got := strings.Join(tree.flatStrings(), " ")
+		if got != tc.want {
+			t.Errorf("for %q: got %s; want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestPrefixDiscard(t *testing.T) {
+	// A discarded form between a prefix and its target is skipped.
+	for _, tc := range []struct {
+		s    string
+		opts ParseOpts
+		want string
+	}{
+		{"'#_a b", 0, "discard sym(a) quote sym(b)"},
+		{"@#_a b", 0, "discard sym(a) deref sym(b)"},
+		{"~#_a b", 0, "discard sym(a) unquote sym(b)"},
+		{"~@#_a b", 0, "discard sym(a) unquote splice sym(b)"},
+		{"`#_a b", 0, "discard sym(a) syntax quote sym(b)"},
+		{"'#_ #_ a b c", 0, "discard discard sym(a) sym(b) quote sym(c)"},
+		{"''#_a b", 0, "discard sym(a) quote quote sym(b)"},
+		{"[@#_(a) b c]", 0, "vector(length=3) discard list(length=1) sym(a) deref sym(b) sym(c)"},
+		{"'#_a b", IgnoreReaderDiscard, "quote sym(b)"},
+		{"(f @#_a b)", IgnoreReaderDiscard, "list(length=2) sym(f) deref sym(b)"},
+		{"'#_a ; c\nb", IncludeNonSemantic, `discard sym(a) comment("; c") newline quote sym(b)`},
+		{"(f ' ; c\n; d\nb)", IncludeNonSemantic, `list(length=2) sym(f) comment("; c") newline comment("; d") newline quote sym(b)`},
+		{"' ; c\nb", 0, "quote sym(b)"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", tc.opts)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		got := strings.Join(tree.flatStrings(), " ")
+		if got != tc.want {
+			t.Errorf("for %q: got %s; want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestPrefixIgnoredAnnotation(t *testing.T) {
+	// Dropped metadata or tags are skipped when looking for the target of
+	// a prefix.
+	for _, tc := range []struct {
+		s    string
+		opts ParseOpts
+		want string
+	}{
+		{"'^:x foo", IgnoreMetadata, "quote sym(foo)"},
+		{"@^:x ^:y foo", IgnoreMetadata, "deref sym(foo)"},
+		{`'#inst "x"`, IgnoreTag, `quote string("x")`},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", tc.opts)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		got := strings.Join(tree.flatStrings(), " ")
+		if got != tc.want {
+			t.Errorf("for %q: got %s; want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
 func TestIgnoreCommentForm(t *testing.T) {
 	for _, tc := range []struct {
 		s    string
@@ -153,6 +250,32 @@ func TestIgnoreCommentForm(t *testing.T) {
 	}
 }
 
+func TestIgnoreMetadataAndTag(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		opts ParseOpts
+		want string
+	}{
+		{"^:x foo", IgnoreMetadata, "sym(foo)"},
+		{"^:x ^{:y 1} foo", IgnoreMetadata, "sym(foo)"},
+		{"(defn ^String f [^long x])", IgnoreMetadata, "list(length=3) sym(defn) sym(f) vector(length=1) sym(x)"},
+		{"'^:x foo", IgnoreMetadata, "quote sym(foo)"},
+		{"#inst \"2020\"", IgnoreMetadata, `tag(inst) string("2020")`},
+		{"#inst \"2020\"", IgnoreTag, `string("2020")`},
+		{"[#foo/bar {:a 1} ^:x y]", IgnoreTag, "vector(length=3) map(length=1) keyword(:a) num(1) metadata keyword(:x) sym(y)"},
+		{"^:x #foo/bar [1]", IgnoreMetadata | IgnoreTag, "vector(length=1) num(1)"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", tc.opts)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		got := strings.Join(tree.flatStrings(), " ")
+		if got != tc.want {
+			t.Errorf("for %q: got %s; want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
 // Issue 32.
 func TestUnreadable(t *testing.T) {
 	_, err := Reader(strings.NewReader("#<X Y Z>"), "temp", IncludeNonSemantic)
@@ -164,6 +287,186 @@ func TestUnreadable(t *testing.T) {
 	}
 }
 
+func TestIncludeCommas(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		opts ParseOpts
+		want string
+	}{
+		{"{:a 1, :b 2}", 0, "map(length=2) keyword(:a) num(1) keyword(:b) num(2)"},
+		{"{:a 1, :b 2}", IncludeCommas, "map(length=2) keyword(:a) num(1) comma keyword(:b) num(2)"},
+		{"[a,,b ,c]", IncludeCommas, "vector(length=3) sym(a) comma comma sym(b) comma sym(c)"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", tc.opts)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		got := strings.Join(tree.flatStrings(), " ")
+		if got != tc.want {
+			t.Errorf("for %q: got %s; want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	const input = `(ok 1)
+(bad #<foo> x)
+[also-bad}
+(ok 2)
+{:a #(#(%))}
+"unterminated
+(never)`
+	tree, err := Reader(strings.NewReader(input), "temp", RecoverErrors)
+	if tree == nil {
+		t.Fatalf("got nil tree (err=%v)", err)
+	}
+	got := strings.Join(tree.flatStrings(), " ")
+	want := "list(length=2) sym(ok) num(1) list(length=2) sym(ok) num(2)"
+	if got != want {
+		t.Errorf("got roots %s; want %s", got, want)
+	}
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got error %#v; want ErrorList", err)
+	}
+	var gotErrs []string
+	for _, e := range errs {
+		gotErrs = append(gotErrs, e.Error())
+	}
+	wantErrs := []string{
+		"lex error at temp:2:6: unreadable dispatch macro",
+		`parse error at temp:3:10: unexpected token "}"`,
+		"parse error at temp:5:7: cannot nest fn literals",
+		"lex error at temp:6:1: reached EOF before string closing quote",
+	}
+	if !reflect.DeepEqual(gotErrs, wantErrs) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(gotErrs, "\n"), strings.Join(wantErrs, "\n"))
+	}
+
+	if _, err := Reader(strings.NewReader(input), "temp", 0); err == nil || err.Error() != wantErrs[0] {
+		t.Errorf("without RecoverErrors, got err=%v; want %s", err, wantErrs[0])
+	}
+	if _, err := Reader(strings.NewReader("(a) (b)"), "temp", RecoverErrors); err != nil {
+		t.Errorf("for valid input, got err=%v", err)
+	}
+
+	// An error inside a fn literal doesn't affect the fn literals which
+	// follow it.
+	tree, err = Reader(strings.NewReader("#(foo ]\n(bar)\n#(baz %)\n"), "temp", RecoverErrors)
+	if tree == nil {
+		t.Fatalf("got nil tree (err=%v)", err)
+	}
+	got = strings.Join(tree.flatStrings(), " ")
+	want = "list(length=1) sym(bar) lambda(length=2) sym(baz) sym(%)"
+	if got != want {
+		t.Errorf("got roots %s; want %s", got, want)
+	}
+	want = `parse error at temp:1:7: unexpected token "]"`
+	if errs, ok := err.(ErrorList); !ok || len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("got error %v; want %s", err, want)
+	}
+}
+
+func TestFileHelpers(t *testing.T) {
+	f, err := ioutil.TempFile("", "goclj-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("; comment\n(a)\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		parse func(string) (*Tree, error)
+		want  []string
+	}{
+		{FileWithComments, []string{`comment("; comment")`, "newline", "list(length=1)", "newline"}},
+		{FileSemanticOnly, []string{"list(length=1)"}},
+	} {
+		tree, err := tc.parse(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, root := range tree.Roots {
+			got = append(got, root.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("got roots %q; want %q", got, tc.want)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	var inputs []string
+	for _, tc := range testCases {
+		inputs = append(inputs, tc.s)
+	}
+	input := strings.Join(inputs, "\n")
+	tree, err := Reader(strings.NewReader(input), "temp", IncludeNonSemantic|IncludeCommas)
+	if err != nil {
+		t.Fatalf("error parsing %q: %s", input, err)
+	}
+	want := tree.String()
+	clone := tree.Clone()
+	if got := clone.String(); got != want {
+		t.Fatalf("clone differs from original: got\n%s\nwant\n%s", got, want)
+	}
+
+	orig := make(map[Node]struct{})
+	origPos := make(map[*Pos]struct{})
+	walkNodes(tree.Roots, func(n Node) {
+		orig[n] = struct{}{}
+		origPos[n.Position()] = struct{}{}
+	})
+	walkNodes(clone.Roots, func(n Node) {
+		if _, ok := orig[n]; ok {
+			t.Errorf("node %s is shared by the original and the clone", n)
+		}
+		if _, ok := origPos[n.Position()]; ok {
+			t.Errorf("position of node %s is shared by the original and the clone", n)
+		}
+		for _, c := range n.Children() {
+			if c.Parent() != n {
+				t.Errorf("parent of %s in clone is %v; want %s", c, c.Parent(), n)
+			}
+		}
+	})
+	// Mutating the clone must not affect the original.
+	walkNodes(clone.Roots, func(n Node) {
+		switch n := n.(type) {
+		case *SymbolNode:
+			n.Val = "changed"
+		case *MapNode:
+			n.Namespace = ":changed"
+		case *VectorNode:
+			n.SetChildren(nil)
+		}
+		if n.Position() != nil {
+			n.Position().Line = 1000
+		}
+	})
+	clone.Roots = clone.Roots[:1]
+	if got := tree.String(); got != want {
+		t.Errorf("original changed after mutating clone: got\n%s\nwant\n%s", got, want)
+	}
+	walkNodes(tree.Roots, func(n Node) {
+		if n.Position().Line == 1000 {
+			t.Errorf("position of %s changed after mutating clone", n)
+		}
+	})
+}
+
+func walkNodes(nodes []Node, f func(Node)) {
+	for _, n := range nodes {
+		f(n)
+		walkNodes(n.Children(), f)
+	}
+}
+
 // Issue 33.
 func TestCommentCarriageReturn(t *testing.T) {
 	const input = "3;a\r4"
@@ -207,10 +510,432 @@ func TestUnterminatedQuotes(t *testing.T) {
 		t.Fatalf("error parsing %q: %s", input, err)
 	}
 	got := tree.flatStrings()
-	want := []string{"quote", "sym(a)"}
+	// The comment is kept, and the quote applies to a.
+	want := []string{`comment(";hello")`, "newline", "quote", "sym(a)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("for %q: got %v; want %v", input, got, want)
+	}
+}
+
+// lexTestCases gives the expected token sequence for each input in testCases.
+var lexTestCases = map[string]string{
+	`true`:                     `symbol("true")`,
+	`\s`:                       `char-literal("\\s")`,
+	`; comment!`:               `comment("; comment!")`,
+	`@foo`:                     `at-sign("@") symbol("foo")`,
+	`#(+ % 3)`:                 `dispatch("#(") left-paren("(") symbol("+") symbol("%") number("3") right-paren(")")`,
+	`#_(a b c)`:                `dispatch("#_") left-paren("(") symbol("a") symbol("b") symbol("c") right-paren(")")`,
+	`:foobar`:                  `keyword(":foobar")`,
+	`(foo bar baz)`:            `left-paren("(") symbol("foo") symbol("bar") symbol("baz") right-paren(")")`,
+	`{:a b :c d}`:              `left-brace("{") keyword(":a") symbol("b") keyword(":c") symbol("d") right-brace("}")`,
+	`#:foo{:a 1}`:              `dispatch("#:") keyword(":foo") left-brace("{") keyword(":a") number("1") right-brace("}")`,
+	`#::{:b 1234}`:             `dispatch("#:") keyword("::") left-brace("{") keyword(":b") number("1234") right-brace("}")`,
+	`^String`:                  `circumflex("^") symbol("String")`,
+	`nil`:                      `symbol("nil")`,
+	`123.456`:                  `number("123.456")`,
+	`foo`:                      `symbol("foo")`,
+	`'(foobar)`:                `apostrophe("'") left-paren("(") symbol("foobar") right-paren(")")`,
+	`#"^asdf"`:                 `dispatch("#\"") string("\"^asdf\"")`,
+	`#"\""`:                    `dispatch("#\"") string("\"\\\"\"")`,
+	`#"a\\b\"c\nd"`:            `dispatch("#\"") string("\"a\\\\b\\\"c\\nd\"")`,
+	"#\"a\nb\"":                `dispatch("#\"") string("\"a\nb\"")`,
+	`#{1 2 3}`:                 `dispatch("#{") left-brace("{") number("1") number("2") number("3") right-brace("}")`,
+	`#?(:clj 1)`:               `dispatch("#?") left-paren("(") keyword(":clj") number("1") right-paren(")")`,
+	`#?@(:clj :a :default :b)`: `dispatch("#?@") left-paren("(") keyword(":clj") keyword(":a") keyword(":default") keyword(":b") right-paren(")")`,
+	`"foo"`:                    `string("\"foo\"")`,
+	"`(1 2 3)":                 "backtick(\"`\") left-paren(\"(\") number(\"1\") number(\"2\") number(\"3\") right-paren(\")\")",
+	`#foo`:                     `octothorpe("#") symbol("foo")`,
+	`~foo`:                     `tilde("~") symbol("foo")`,
+	`~@foo`:                    `tilde("~") at-sign("@") symbol("foo")`,
+	`#'asdf`:                   `dispatch("#'") symbol("asdf")`,
+	`[a b c]`:                  `left-bracket("[") symbol("a") symbol("b") symbol("c") right-bracket("]")`,
+	`#_foobar`:                 `dispatch("#_") symbol("foobar")`,
+	`#=foo`:                    `dispatch("#=") symbol("foo")`,
+	`#^foo`:                    `dispatch("#^") symbol("foo")`,
+	`#! hello!`:                `comment("#! hello!")`,
+	` #! hello!`:               `comment("#! hello!")`,
+	`a%b%`:                     `symbol("a%b%")`,
+	`:100%>50%`:                `keyword(":100%>50%")`,
+	`##Inf`:                    `number("##Inf")`,
+	`##-Inf`:                   `number("##-Inf")`,
+	`##NaN`:                    `number("##NaN")`,
+}
+
+func TestLexer(t *testing.T) {
+	for _, tc := range testCases {
+		want, ok := lexTestCases[tc.s]
+		if !ok {
+			t.Errorf("no lexer test case for %q", tc.s)
+			continue
+		}
+		l := NewLexer(strings.NewReader(tc.s), "temp", 0)
+		var toks []string
+		for {
+			tok, err := l.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("error lexing %q: %s", tc.s, err)
+			}
+			toks = append(toks, fmt.Sprintf("%s(%q)", tok.Type, tok.Val))
+		}
+		if got := strings.Join(toks, " "); got != want {
+			t.Errorf("for %q: got %s; want %s", tc.s, got, want)
+		}
+	}
+}
+
+func TestLexerPositions(t *testing.T) {
+	const input = "(a\n  #b, \"c\")"
+	l := NewLexer(strings.NewReader(input), "temp", IncludeCommas)
+	var got []string
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error lexing %q: %s", input, err)
+		}
+		got = append(got, tok.String())
+	}
+	want := []string{
+		`left-paren("(")@temp:1:1`,
+		`symbol("a")@temp:1:2`,
+		`newline("\n")@temp:1:3`,
+		`octothorpe("#")@temp:2:3`,
+		`symbol("b")@temp:2:4`,
+		`comma(",")@temp:2:5`,
+		`string("\"c\"")@temp:2:7`,
+		`right-paren(")")@temp:2:10`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("for %q: got %v; want %v", input, got, want)
+	}
+}
+
+func TestLexerError(t *testing.T) {
+	l := NewLexer(strings.NewReader("(a #<b>)"), "temp", 0)
+	var err error
+	for err == nil {
+		_, err = l.Next()
+	}
+	const want = "lex error at temp:1:4: unreadable dispatch macro"
+	if err.Error() != want {
+		t.Fatalf("got error %q; want %q", err, want)
+	}
+	if _, err2 := l.Next(); err2 != err {
+		t.Errorf("after error, Next returned %v; want %v", err2, err)
+	}
+}
+
+func TestLexSymbolicValues(t *testing.T) {
+	const input = "[##Inf ##-Inf,##NaN]"
+	l := lex("temp", bufio.NewReader(strings.NewReader(input)), false)
+	var got []string
+	for {
+		tok := l.nextToken()
+		if tok.typ == tokEOF {
+			break
+		}
+		got = append(got, tok.String())
+	}
+	want := []string{
+		"<left-bracket@temp:1:1>",
+		`<number@temp:1:2>("##Inf")`,
+		`<number@temp:1:8>("##-Inf")`,
+		`<number@temp:1:15>("##NaN")`,
+		"<right-bracket@temp:1:20>",
+	}
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("for %q: got %v; want %v", input, got, want)
 	}
+
+	for _, input := range []string{"##foo", "##", "(+ 1 ##inf)"} {
+		_, err := Reader(strings.NewReader(input), "temp", 0)
+		if err == nil || !strings.Contains(err.Error(), "invalid symbolic value") {
+			t.Errorf("for %q: got err=%v; want invalid symbolic value", input, err)
+		}
+	}
+}
+
+// lexAll returns all the tokens from l (including errors) as strings.
+func lexAll(l *lexer) []string {
+	var toks []string
+	for {
+		tok := l.nextToken()
+		if tok.typ == tokEOF {
+			return toks
+		}
+		toks = append(toks, tok.String())
+	}
+}
+
+func TestLexSync(t *testing.T) {
+	inputs := []string{
+		"",
+		"(a #<b>) c",
+		`"unterminated`,
+		"(a, b ,c)\r\n#_ #?@(:clj 1)",
+	}
+	for _, tc := range testCases {
+		inputs = append(inputs, tc.s)
+	}
+	paths, err := filepath.Glob("../format/testdata/*.clj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(b))
+	}
+	for _, input := range inputs {
+		for _, commas := range []bool{false, true} {
+			for _, recover := range []bool{false, true} {
+				l := lex("temp", bufio.NewReader(strings.NewReader(input)), commas)
+				l.recover = recover
+				want := lexAll(l)
+				ls := lexSync("temp", bufio.NewReader(strings.NewReader(input)), commas)
+				ls.recover = recover
+				if got := lexAll(ls); !reflect.DeepEqual(got, want) {
+					t.Errorf("for %q (commas=%t, recover=%t): synchronous lexer gave\n%v\nwant\n%v",
+						input, commas, recover, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestLexerGoroutineLeak(t *testing.T) {
+	// Hide the size of the input so that the lexer runs in a goroutine.
+	input := "(a ]\n" + strings.Repeat("(b c)\n", 1000)
+	newReader := func() io.Reader { return struct{ io.Reader }{strings.NewReader(input)} }
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if _, err := Reader(newReader(), "temp", 0); err == nil {
+			t.Fatal("expected parse error")
+		}
+		l := NewLexer(newReader(), "temp", 0)
+		if _, err := l.Next(); err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+		if _, err := l.Next(); err != ErrLexerClosed {
+			t.Fatalf("Next after Close: got err=%v; want ErrLexerClosed", err)
+		}
+	}
+	// The goroutines exit asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d goroutines after aborted parses; want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// endlessReader produces an unending stream of top-level forms.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = "(a)\n"[i%4]
+	}
+	return len(p), nil
+}
+
+func TestReaderContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := ReaderContext(ctx, endlessReader{}, "temp", 0)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got err=%v; want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("parsing took %s after the deadline", elapsed)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, opts := range []ParseOpts{0, RecoverErrors} {
+		tree, err := ReaderContext(canceled, strings.NewReader("(a) (b"), "temp", opts)
+		if tree != nil || err != context.Canceled {
+			t.Errorf("with opts %d: got (%v, %v); want (nil, %v)", opts, tree, err, context.Canceled)
+		}
+	}
+
+	tree, err := ReaderContext(context.Background(), strings.NewReader("(a) (b)"), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Roots) != 2 {
+		t.Errorf("got %d roots; want 2", len(tree.Roots))
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	const src = "(a [b c])\n(d)"
+	for _, tc := range []struct {
+		limits ParseLimits
+		err    string
+	}{
+		{ParseLimits{}, ""},
+		{ParseLimits{MaxBytes: int64(len(src)), MaxNodes: 8, MaxDepth: 3}, ""},
+		{ParseLimits{MaxBytes: 5}, "lex error at temp:1:5: error while scanning: input is larger than 5 bytes"},
+		{ParseLimits{MaxNodes: 5}, "parse error at temp:1:10: input has more than 5 nodes"},
+		{ParseLimits{MaxDepth: 2}, "parse error at temp:1:5: forms are nested more than 2 deep"},
+	} {
+		for _, opts := range []ParseOpts{0, RecoverErrors} {
+			for _, r := range []io.Reader{
+				strings.NewReader(src),
+				struct{ io.Reader }{strings.NewReader(src)}, // lexed in a goroutine
+			} {
+				_, err := ReaderLimits(context.Background(), r, "temp", opts, tc.limits)
+				var got string
+				if err != nil {
+					got = err.Error()
+				}
+				if got != tc.err {
+					t.Errorf("with limits %+v and opts %d: got err=%q; want %q",
+						tc.limits, opts, got, tc.err)
+				}
+			}
+		}
+	}
+
+	// With RecoverErrors, exceeding MaxNodes or MaxBytes stops the parse
+	// rather than failing again on each of the remaining forms.
+	big := strings.Repeat("(a b)\n", 100000)
+	for _, limits := range []ParseLimits{{MaxNodes: 5}, {MaxBytes: 10}} {
+		tree, err := ReaderLimits(context.Background(), strings.NewReader(big), "temp", RecoverErrors, limits)
+		if err == nil {
+			t.Fatalf("with limits %+v: got nil error", limits)
+		}
+		if _, ok := err.(ErrorList); ok || tree != nil {
+			t.Errorf("with limits %+v: got (%v, %q); want a single error and no tree",
+				limits, tree, err)
+		}
+	}
+}
+
+func BenchmarkLexTiny(b *testing.B) {
+	const input = "(defn f [x] (+ x 1))"
+	for _, bc := range []struct {
+		name string
+		lex  func(string, *bufio.Reader, bool) *lexer
+	}{
+		{"chan", lex},
+		{"sync", lexSync},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l := bc.lex("temp", bufio.NewReader(strings.NewReader(input)), false)
+				for l.nextToken().typ != tokEOF {
+				}
+			}
+		})
+	}
+}
+
+func TestCharLiterals(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want rune
+	}{
+		{`\a`, 'a'},
+		{`\(`, '('},
+		{`\\`, '\\'},
+		{`\newline`, '\n'},
+		{`\space`, ' '},
+		{`\tab`, '\t'},
+		{`\formfeed`, '\f'},
+		{`\backspace`, '\b'},
+		{`\return`, '\r'},
+		{`\u0041`, 'A'},
+		{`\u00e9`, 'é'},
+		{`\o101`, 'A'},
+		{`\o377`, 0377},
+		{`\o7`, 07},
+		{`\é`, 'é'},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", 0)
+		if err != nil {
+			t.Errorf("error parsing %s: %s", tc.s, err)
+			continue
+		}
+		n := tree.Roots[0].(*CharacterNode)
+		if n.Val != tc.want || n.Text != tc.s {
+			t.Errorf("for %s: got (%q, %q); want (%q, %q)", tc.s, n.Val, n.Text, tc.want, tc.s)
+		}
+	}
+	for _, s := range []string{`\o400`, `\o1234`, `\o8`, `\u12`, `\u12345`, `\foo`} {
+		if _, err := Reader(strings.NewReader(s), "temp", 0); err == nil {
+			t.Errorf("parsing %s: got no error", s)
+		}
+	}
+}
+
+func TestStringUnescaped(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{`"abc"`, "abc"},
+		{`"a\tb\nc\r\b\f"`, "a\tb\nc\r\b\f"},
+		{`"\"quoted\" \\ back"`, `"quoted" \ back`},
+		{`"\u00e9t\u00E9"`, "été"},
+		{`"\u2603"`, "☃"},
+		{`"\ud83d\ude00"`, "😀"},
+		{`"\0"`, "\x00"},
+		{`"\101\1012"`, "AA2"},
+		{`"\7\78\377"`, "\a\a8\u00ff"},
+		{`"é\n"`, "é\n"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", 0)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		got, err := tree.Roots[0].(*StringNode).Unescaped()
+		if err != nil {
+			t.Errorf("for %s: got error %s", tc.s, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("for %s: got %q; want %q", tc.s, got, tc.want)
+		}
+		esc := EscapeString(got)
+		if got2, err := (&StringNode{Val: esc}).Unescaped(); err != nil || got2 != got {
+			t.Errorf("EscapeString(%q) = %q, which does not round-trip", got, esc)
+		}
+	}
+}
+
+func TestStringUnescapedErrors(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{`"abc\q"`, "string error at temp:1:5: unsupported escape character \\q"},
+		{"\"a\nb\\u12\"", "string error at temp:2:2: invalid unicode escape"},
+		{`"\u12zz"`, "string error at temp:1:2: invalid unicode escape \\u12zz"},
+		{`"é\400"`, "string error at temp:1:4: octal escape \\400 out of range"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", 0)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", tc.s, err)
+		}
+		_, err = tree.Roots[0].(*StringNode).Unescaped()
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("for %s: got error %v; want %q", tc.s, err, tc.want)
+		}
+	}
 }
 
 // flatStrings gives a flattened string representation of t by calling String on
@@ -229,3 +954,129 @@ func (t *Tree) flatStrings() []string {
 	}
 	return nodes
 }
+
+func TestMaxDepth(t *testing.T) {
+	nested := func(n int) string {
+		return strings.Repeat("[", n) + strings.Repeat("]", n)
+	}
+	if _, err := Reader(strings.NewReader(nested(MaxDepth)), "temp", 0); err != nil {
+		t.Fatalf("parsing forms nested %d deep: %s", MaxDepth, err)
+	}
+	for _, n := range []int{MaxDepth + 1, 1000000} {
+		_, err := Reader(strings.NewReader(nested(n)), "temp", 0)
+		want := fmt.Sprintf("parse error at temp:1:%d: forms are nested more than %d deep", MaxDepth+1, MaxDepth)
+		if err == nil || err.Error() != want {
+			t.Errorf("parsing forms nested %d deep: got error %v; want %q", n, err, want)
+		}
+	}
+
+	// Quotes and other prefixes count toward the depth.
+	s := strings.Repeat("'", MaxDepth) + "x"
+	if _, err := Reader(strings.NewReader(s), "temp", 0); err == nil {
+		t.Errorf("parsing %d nested quotes: got nil error", MaxDepth)
+	}
+}
+
+func TestStringPosition(t *testing.T) {
+	const s = "(defn foo \"Line one.\n  Line two.\n  Line three.\"\n  [])"
+	tree, err := Reader(strings.NewReader(s), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := tree.Roots[0].Children()[2].(*StringNode)
+	if got, want := doc.Position().String(), "temp:1:11"; got != want {
+		t.Errorf("docstring starts at %s; want %s", got, want)
+	}
+	end := doc.End()
+	if got, want := end.String(), "temp:3:15"; got != want {
+		t.Errorf("docstring ends at %s; want %s", got, want)
+	}
+	if got, want := end.Offset, strings.Index(s, "\n  []"); got != want {
+		t.Errorf("docstring end offset is %d; want %d", got, want)
+	}
+	// The position of the next form accounts for the lines in the string.
+	vec := tree.Roots[0].Children()[3]
+	if got, want := vec.Position().String(), "temp:4:3"; got != want {
+		t.Errorf("arg vector starts at %s; want %s", got, want)
+	}
+
+	one, err := Reader(strings.NewReader(`x "abc"`), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := one.Roots[1].(*StringNode).End().String(), "temp:1:8"; got != want {
+		t.Errorf("one-line string ends at %s; want %s", got, want)
+	}
+}
+
+func TestNamespacedMaps(t *testing.T) {
+	for _, tc := range []struct {
+		s            string
+		namespace    string
+		autoResolved bool
+		name         string
+	}{
+		{"{:a 1}", "", false, ""},
+		{"#:foo.bar{:a 1}", ":foo.bar", false, "foo.bar"},
+		{"#::{:a 1}", "::", true, ""},
+		{"#::foo{:a 1}", "::foo", true, "foo"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", 0)
+		if err != nil {
+			t.Errorf("error parsing %q: %s", tc.s, err)
+			continue
+		}
+		m := tree.Roots[0].(*MapNode)
+		if m.Namespace != tc.namespace {
+			t.Errorf("%s: got Namespace %q; want %q", tc.s, m.Namespace, tc.namespace)
+		}
+		if got := m.AutoResolved(); got != tc.autoResolved {
+			t.Errorf("%s: got AutoResolved() = %t; want %t", tc.s, got, tc.autoResolved)
+		}
+		if got := m.NamespaceName(); got != tc.name {
+			t.Errorf("%s: got NamespaceName() = %q; want %q", tc.s, got, tc.name)
+		}
+	}
+
+	for _, s := range []string{
+		"#:{:a 1}",
+		"#:foo/bar{:a 1}",
+		"#::foo/bar{:a 1}",
+		"#:::foo{:a 1}",
+	} {
+		_, err := Reader(strings.NewReader(s), "temp", 0)
+		if err == nil || !strings.Contains(err.Error(), "invalid namespace") {
+			t.Errorf("parsing %q: got error %v; want invalid namespace error", s, err)
+		}
+	}
+}
+
+func TestOddMapLiterals(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{"{:a}", "parse error at temp:1:1: map literal must contain an even number of forms"},
+		{"[1 {:a 1 :b}]", "parse error at temp:1:4: map literal must contain an even number of forms"},
+		{"#:foo{:a}", "parse error at temp:1:6: map literal must contain an even number of forms"},
+		{"{:a #_ #_ 1 2}", "parse error at temp:1:1: map literal must contain an even number of forms"},
+	} {
+		_, err := Reader(strings.NewReader(tc.s), "temp", IncludeNonSemantic)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("parsing %q: got error %v; want %q", tc.s, err, tc.want)
+		}
+	}
+
+	for _, s := range []string{
+		"{:a ; comment\n 1}",
+		"{:a 1 #_:b}",
+		"{:a 1 #_ #_ :b 2}",
+		"{:a #inst \"2020-01-01\" :b ^:m c}",
+		"{:a 1 #?(:clj :b)}",
+		"{#?@(:clj [:a 1])}",
+	} {
+		if _, err := Reader(strings.NewReader(s), "temp", IncludeNonSemantic); err != nil {
+			t.Errorf("parsing %q: %s", s, err)
+		}
+	}
+}